@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/artifacts"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/job"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/notify"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/utils"
+	"github.com/Yaxhveer/wayback-discover-diff-go/pkg/simhash"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/cobra"
+)
+
+func newBackfillCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "backfill --file urls.txt [--year YEAR]",
+		Short: "Calculate the SimHashes of a list of URLs",
+		Long: `Calculate the SimHashes of each URL of a file, one "URL [YEAR]" per line,
+with at most --parallel jobs at once and at least --delay between the starts
+of two jobs, to stay polite with the Wayback Machine. Lines without a year
+use --year, blank lines and lines starting with # are ignored. Progress is
+printed to stderr and a JSON report of every line to stdout, or to --report.`,
+		Args: cobra.NoArgs,
+		RunE: runBackfill,
+	}
+	cmd.Flags().String("file", "", "file of URLs, - for stdin")
+	cmd.Flags().String("year", "", "year of the lines without one")
+	cmd.Flags().Int("parallel", 2, "number of jobs running at once")
+	cmd.Flags().Duration("delay", time.Second, "minimum delay between the starts of two jobs")
+	cmd.Flags().Int("simhash-size", 0, "SimHash size in bits, one of 64, 128, 256, 512 (default from the config)")
+	cmd.Flags().String("extractor", job.ExtractorDefault, "feature extractor, one of default, weighted")
+	cmd.Flags().Bool("override", false, "replace SimHashes stored with another algorithm or extractor")
+	cmd.Flags().String("report", "", "write the JSON report to this file instead of stdout")
+	cmd.MarkFlagRequired("file")
+	return cmd
+}
+
+// backfillTarget is a line of a backfill file.
+type backfillTarget struct {
+	Line int    `json:"line"`
+	URL  string `json:"url"`
+	Year string `json:"year"`
+}
+
+// backfillResult is the outcome of the job of a backfill line.
+type backfillResult struct {
+	backfillTarget
+	JobID    string  `json:"job_id,omitempty"`
+	State    string  `json:"state"`
+	Info     string  `json:"info,omitempty"`
+	Duration float64 `json:"duration,omitempty"`
+}
+
+// backfillReport summarizes a backfill.
+type backfillReport struct {
+	Started   time.Time        `json:"started"`
+	Duration  float64          `json:"duration"`
+	Total     int              `json:"total"`
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+	Results   []backfillResult `json:"results"`
+}
+
+func runBackfill(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+	file, _ := flags.GetString("file")
+	year, _ := flags.GetString("year")
+	parallel, _ := flags.GetInt("parallel")
+	delay, _ := flags.GetDuration("delay")
+	simhashSize, _ := flags.GetInt("simhash-size")
+	extractor, _ := flags.GetString("extractor")
+	override, _ := flags.GetBool("override")
+	reportPath, _ := flags.GetString("report")
+	if year != "" && !utils.YearIsValid(year) {
+		return fmt.Errorf("invalid year %q", year)
+	}
+	if !job.ValidExtractor(extractor) {
+		return fmt.Errorf("invalid extractor %q", extractor)
+	}
+
+	targets, err := readBackfillFile(file, year)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	if simhashSize == 0 {
+		simhashSize = cfg.Simhash.Size
+	} else if !simhash.ValidSize(simhashSize) {
+		return fmt.Errorf("invalid simhash-size %d", simhashSize)
+	}
+	redisClient, err := newRedisClient(cfg)
+	if err != nil {
+		return err
+	}
+	defer redisClient.Close()
+	shared := job.Options{Artifacts: artifacts.New(cfg.Artifacts), Notifier: notify.New(cfg.Notify)}
+	defer shared.Notifier.Wait()
+
+	report := backfillReport{Started: time.Now(), Total: len(targets), Results: make([]backfillResult, len(targets))}
+	var mu sync.Mutex
+	var done int
+	sem := make(chan struct{}, max(parallel, 1))
+	pacing := time.NewTicker(max(delay, time.Millisecond))
+	defer pacing.Stop()
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		sem <- struct{}{}
+		if i > 0 {
+			<-pacing.C
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			result := backfill(redisClient, shared, target, simhashSize, extractor, override)
+			mu.Lock()
+			defer mu.Unlock()
+			report.Results[i] = result
+			done++
+			if result.State == string(job.SUCCESS) {
+				report.Succeeded++
+			} else {
+				report.Failed++
+			}
+			fmt.Fprintf(os.Stderr, "[%d/%d] %s %s %s %s\n", done, len(targets), target.URL, target.Year, result.State, strings.TrimSpace(result.Info))
+		}()
+	}
+	wg.Wait()
+	report.Duration = time.Since(report.Started).Seconds()
+	fmt.Fprintf(os.Stderr, "backfilled %d URLs, %d succeeded, %d failed in %.0fs\n", report.Total, report.Succeeded, report.Failed, report.Duration)
+
+	out := io.Writer(os.Stdout)
+	if reportPath != "" {
+		f, err := os.Create(reportPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// backfill runs the job of target and waits for it. The artifacts uploader
+// and notifier of shared are used by every job.
+func backfill(redisClient *redis.Client, shared job.Options, target backfillTarget, simhashSize int, extractor string, override bool) backfillResult {
+	result := backfillResult{backfillTarget: target}
+	opts, err := jobOptions(redisClient, target.URL, simhashSize, extractor, override)
+	if err != nil {
+		result.State, result.Info = string(job.FAILURE), err.Error()
+		return result
+	}
+	opts.Artifacts, opts.Notifier = shared.Artifacts, shared.Notifier
+	j := job.NewJob()
+	result.JobID = j.RunJob(context.Background(), redisClient, target.URL, target.Year, opts)
+	<-j.Done()
+	result.State, result.Info, result.Duration = string(j.State()), j.Info(), j.Duration().Seconds()
+	return result
+}
+
+// readBackfillFile reads the targets of the backfill file at path, using
+// year for the lines without one.
+func readBackfillFile(path, year string) ([]backfillTarget, error) {
+	r := io.Reader(os.Stdin)
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var targets []backfillTarget
+	var problems []string
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		target := backfillTarget{Line: line, URL: fields[0], Year: year}
+		if len(fields) > 1 {
+			target.Year = fields[1]
+		}
+		urlErr := utils.CheckURL(target.URL)
+		switch {
+		case len(fields) > 2:
+			problems = append(problems, fmt.Sprintf("line %d: expected URL [YEAR]", line))
+		case urlErr != nil:
+			problems = append(problems, fmt.Sprintf("line %d: invalid url %q, %s", line, target.URL, urlErr))
+		case target.Year == "":
+			problems = append(problems, fmt.Sprintf("line %d: no year, pass --year", line))
+		case !utils.YearIsValid(target.Year):
+			problems = append(problems, fmt.Sprintf("line %d: invalid year %q", line, target.Year))
+		default:
+			targets = append(targets, target)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%s:\n  %s", path, strings.Join(problems, "\n  "))
+	}
+	return targets, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/backup"
+	"github.com/spf13/cobra"
+)
+
+func newBackupCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "backup [--output FILE]",
+		Short: "Back up the Redis keys of the service",
+		Long: `Dump every key of the configured Redis database but the transient ones, such
+as rate limits and cluster members, to a gzipped NDJSON file in backup.dir,
+removing the oldest files beyond backup.keep, or to --output. The file is
+restored with wdd restore. The counts of the backup are printed as JSON.`,
+		Args: cobra.NoArgs,
+		RunE: runBackup,
+	}
+	cmd.Flags().String("output", "", "file to write instead of a new file in backup.dir, - for stdout")
+	return cmd
+}
+
+func runBackup(cmd *cobra.Command, args []string) error {
+	output, _ := cmd.Flags().GetString("output")
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	redisClient, err := newRedisClient(cfg)
+	if err != nil {
+		return err
+	}
+	defer redisClient.Close()
+
+	b := backup.New(redisClient, cfg.Backup, cfg.Leader.Key)
+	var stats backup.Stats
+	switch output {
+	case "":
+		output, stats, err = b.Run(context.Background())
+	case "-":
+		stats, err = b.Write(context.Background(), os.Stdout)
+	default:
+		var f *os.File
+		if f, err = os.Create(output); err != nil {
+			return err
+		}
+		stats, err = b.Write(context.Background(), f)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "backed up %d keys to %s\n", stats.Keys, output)
+	if output == "-" {
+		return nil
+	}
+	return printJSON(stats)
+}
+
+func newRestoreCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "restore FILE",
+		Short: "Restore the Redis keys of a backup",
+		Long: `Write the keys of a file of wdd backup, - for stdin, to the configured Redis
+database with their remaining time to live, e.g. to repopulate a fresh
+Redis. Keys already present are left alone unless --replace is given. The
+counts of the restore are printed as JSON.`,
+		Args: cobra.ExactArgs(1),
+		RunE: runRestore,
+	}
+	cmd.Flags().Bool("replace", false, "replace the keys already present with those of the backup")
+	return cmd
+}
+
+func runRestore(cmd *cobra.Command, args []string) error {
+	replace, _ := cmd.Flags().GetBool("replace")
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	redisClient, err := newRedisClient(cfg)
+	if err != nil {
+		return err
+	}
+	defer redisClient.Close()
+
+	r := io.Reader(os.Stdin)
+	if args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	stats, err := backup.New(redisClient, cfg.Backup, cfg.Leader.Key).Restore(context.Background(), r, replace)
+	if printErr := printJSON(stats); err == nil {
+		err = printErr
+	}
+	return err
+}
+
+// printJSON prints v indented to stdout.
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
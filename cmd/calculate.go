@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/artifacts"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/job"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/notify"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/spn"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/utils"
+	"github.com/Yaxhveer/wayback-discover-diff-go/pkg/simhash"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/cobra"
+)
+
+func newCalculateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "calculate --url URL (--year YEAR | --save)",
+		Short: "Calculate the SimHashes of a year of captures and print them",
+		Long: `Calculate the SimHashes of the captures of a URL in a year like
+/calculate-simhash does, wait for the job and print the stored SimHashes, one
+"TIMESTAMP SIMHASH" line per capture or a JSON array with --json.
+
+With --save the URL is captured now with Save Page Now instead, like /save,
+and the SimHashes of the current year are printed.`,
+		Args: cobra.NoArgs,
+		RunE: runCalculate,
+	}
+	cmd.Flags().String("url", "", "URL of the captures")
+	cmd.Flags().String("year", "", "year of the captures")
+	cmd.Flags().Int("simhash-size", 0, "SimHash size in bits, one of 64, 128, 256, 512 (default from the config)")
+	cmd.Flags().String("extractor", job.ExtractorDefault, "feature extractor, one of default, weighted")
+	cmd.Flags().Bool("override", false, "replace SimHashes stored with another algorithm or extractor")
+	cmd.Flags().Bool("recalculate", false, "download every capture again instead of reusing known SimHashes")
+	cmd.Flags().Bool("save", false, "capture the URL now with Save Page Now and calculate the new capture")
+	addOutputFlags(cmd)
+	cmd.MarkFlagRequired("url")
+	cmd.MarkFlagsOneRequired("year", "save")
+	cmd.MarkFlagsMutuallyExclusive("year", "save")
+	return cmd
+}
+
+func runCalculate(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+	url, _ := flags.GetString("url")
+	year, _ := flags.GetString("year")
+	simhashSize, _ := flags.GetInt("simhash-size")
+	extractor, _ := flags.GetString("extractor")
+	override, _ := flags.GetBool("override")
+	recalculate, _ := flags.GetBool("recalculate")
+	save, _ := flags.GetBool("save")
+	if save {
+		year = time.Now().UTC().Format("2006")
+	}
+	if err := utils.CheckURL(url); err != nil {
+		return fmt.Errorf("invalid url %q, %w", url, err)
+	}
+	if !utils.YearIsValid(year) {
+		return fmt.Errorf("invalid year %q", year)
+	}
+	if !job.ValidExtractor(extractor) {
+		return fmt.Errorf("invalid extractor %q", extractor)
+	}
+	out, err := outputOptions(cmd)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	spnClient := spn.New(cfg.SPN)
+	if save && spnClient == nil {
+		return fmt.Errorf("save page now is disabled in the config")
+	}
+	if simhashSize == 0 {
+		simhashSize = cfg.Simhash.Size
+	} else if !simhash.ValidSize(simhashSize) {
+		return fmt.Errorf("invalid simhash-size %d", simhashSize)
+	}
+	redisClient, err := newRedisClient(cfg)
+	if err != nil {
+		return err
+	}
+	defer redisClient.Close()
+
+	opts, err := jobOptions(redisClient, url, simhashSize, extractor, override)
+	if err != nil {
+		return err
+	}
+	opts.Recalculate = recalculate || override
+	opts.Artifacts = artifacts.New(cfg.Artifacts)
+	opts.Notifier = notify.New(cfg.Notify)
+	defer opts.Notifier.Wait()
+
+	j := job.NewJob()
+	if save {
+		j.RunSnapshot(context.Background(), redisClient, url, opts, spnClient.Save)
+	} else {
+		j.RunJob(context.Background(), redisClient, url, year, opts)
+	}
+	<-j.Done()
+	if j.State() != job.SUCCESS {
+		return fmt.Errorf("job %s, %s", j.State(), j.Info())
+	}
+	fmt.Fprintf(os.Stderr, "%s in %s\n", j.Info(), j.Duration())
+
+	captures, err := utils.YearSimhash(redisClient, url, year, -1, -1)
+	if err != nil {
+		return err
+	}
+	return printCaptures(captures, out)
+}
+
+// jobOptions returns the options of a job calculating the simhashes of url,
+// replacing those stored with another algorithm or extractor only with
+// override, like /calculate-simhash.
+func jobOptions(redisClient *redis.Client, url string, simhashSize int, extractor string, override bool) (job.Options, error) {
+	meta, err := utils.StoredMetadata(redisClient, url)
+	if err != nil {
+		return job.Options{}, err
+	}
+	mixing := meta.Algorithm != "" && (meta.Algorithm != simhash.Algorithm(simhashSize) || meta.Extractor != extractor)
+	if mixing && !override {
+		return job.Options{}, fmt.Errorf("%s is stored with %s and the %s extractor, use --override to replace it", url, meta.Algorithm, meta.Extractor)
+	}
+	return job.Options{SimhashSize: simhashSize, Extractor: extractor, Replace: mixing}, nil
+}
+
+// output selects how captures are printed.
+type output struct {
+	encoding string
+	json     bool
+}
+
+// addOutputFlags adds the flags selecting the output of captures to cmd.
+func addOutputFlags(cmd *cobra.Command) {
+	cmd.Flags().String("encoding", simhash.EncodingBase64, "SimHash encoding, one of hex, base64, base64url")
+	cmd.Flags().Bool("json", false, "print a JSON array of {timestamp, simhash} objects")
+}
+
+func outputOptions(cmd *cobra.Command) (output, error) {
+	encoding, _ := cmd.Flags().GetString("encoding")
+	asJSON, _ := cmd.Flags().GetBool("json")
+	if !simhash.ValidEncoding(encoding) {
+		return output{}, fmt.Errorf("invalid encoding %q", encoding)
+	}
+	return output{encoding: encoding, json: asJSON}, nil
+}
+
+// printCaptures prints the timestamps and SimHashes of captures to stdout.
+func printCaptures(captures []utils.CaptureResult, out output) error {
+	type capture struct {
+		Timestamp string `json:"timestamp"`
+		Simhash   string `json:"simhash"`
+	}
+	encoded := make([]capture, len(captures))
+	for i, c := range captures {
+		hash, err := simhash.Reencode(c.Simhash, simhash.EncodingBase64, out.encoding)
+		if err != nil {
+			return fmt.Errorf("cannot decode simhash of %s, %w", c.Timestamp, err)
+		}
+		encoded[i] = capture{Timestamp: c.Timestamp, Simhash: hash}
+	}
+
+	if out.json {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(encoded)
+	}
+	for _, c := range encoded {
+		fmt.Println(c.Timestamp, c.Simhash)
+	}
+	return nil
+}
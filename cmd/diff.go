@@ -0,0 +1,184 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/job"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/utils"
+	"github.com/Yaxhveer/wayback-discover-diff-go/pkg/simhash"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/cobra"
+)
+
+func newDiffCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff --url URL --a TIMESTAMP --b TIMESTAMP",
+		Short: "Compare two captures of a URL",
+		Long: `Print the hamming distance and similarity of the SimHashes of two captures
+of a URL. Stored SimHashes are used, and missing ones are calculated from the
+Wayback Machine without being stored. With --words N both captures are
+downloaded and the N feature words whose weights differ most are printed too,
+"+" for words gained by b and "-" for words lost.`,
+		Args: cobra.NoArgs,
+		RunE: runDiff,
+	}
+	cmd.Flags().String("url", "", "URL of the captures")
+	cmd.Flags().String("a", "", "14-digit timestamp of the first capture")
+	cmd.Flags().String("b", "", "14-digit timestamp of the second capture")
+	cmd.Flags().Int("words", 0, "number of most differing feature words to print")
+	cmd.Flags().Int("simhash-size", 0, "SimHash size in bits of calculated SimHashes (default the stored size or the config)")
+	cmd.Flags().String("extractor", "", "feature extractor of calculated SimHashes (default the stored extractor)")
+	cmd.Flags().Bool("json", false, "print the comparison as JSON")
+	cmd.MarkFlagRequired("url")
+	cmd.MarkFlagRequired("a")
+	cmd.MarkFlagRequired("b")
+	return cmd
+}
+
+// featureDiff is the change of the weight of a feature word between two
+// captures.
+type featureDiff struct {
+	Word  string `json:"word"`
+	A     int    `json:"a"`
+	B     int    `json:"b"`
+	Delta int    `json:"delta"`
+}
+
+// captureDiff is the comparison of two captures.
+type captureDiff struct {
+	URL         string        `json:"url"`
+	A           string        `json:"a"`
+	B           string        `json:"b"`
+	SimhashSize int           `json:"simhash_size"`
+	Distance    int           `json:"distance"`
+	Similarity  float64       `json:"similarity"`
+	Words       []featureDiff `json:"words,omitempty"`
+}
+
+func runDiff(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+	url, _ := flags.GetString("url")
+	a, _ := flags.GetString("a")
+	b, _ := flags.GetString("b")
+	words, _ := flags.GetInt("words")
+	simhashSize, _ := flags.GetInt("simhash-size")
+	extractor, _ := flags.GetString("extractor")
+	asJSON, _ := flags.GetBool("json")
+	if err := utils.CheckURL(url); err != nil {
+		return fmt.Errorf("invalid url %q, %w", url, err)
+	}
+	for _, ts := range []string{a, b} {
+		if !utils.CaptureTimestampIsValid(ts) {
+			return fmt.Errorf("invalid timestamp %q", ts)
+		}
+	}
+	if simhashSize != 0 && !simhash.ValidSize(simhashSize) {
+		return fmt.Errorf("invalid simhash-size %d", simhashSize)
+	}
+	if extractor != "" && !job.ValidExtractor(extractor) {
+		return fmt.Errorf("invalid extractor %q", extractor)
+	}
+
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	redisClient, err := newRedisClient(cfg)
+	if err != nil {
+		return err
+	}
+	defer redisClient.Close()
+
+	// Calculated simhashes follow the stored ones so they compare.
+	meta, err := utils.StoredMetadata(redisClient, url)
+	if err != nil {
+		return err
+	}
+	opts := job.Options{SimhashSize: cmp.Or(simhashSize, meta.SimhashSize, cfg.Simhash.Size), Extractor: cmp.Or(extractor, meta.Extractor, job.ExtractorDefault)}
+
+	ctx := context.Background()
+	diff := captureDiff{URL: url, A: a, B: b}
+	var hashA, hashB []byte
+	if words > 0 {
+		featuresA, err := job.NewJob().CaptureFeatures(ctx, url, a, opts)
+		if err != nil {
+			return err
+		}
+		featuresB, err := job.NewJob().CaptureFeatures(ctx, url, b, opts)
+		if err != nil {
+			return err
+		}
+		hashA, _ = simhash.Decode(simhash.GetSimhash(featuresA, opts.SimhashSize), simhash.EncodingBase64)
+		hashB, _ = simhash.Decode(simhash.GetSimhash(featuresB, opts.SimhashSize), simhash.EncodingBase64)
+		diff.Words = diffFeatures(featuresA, featuresB, words)
+	} else {
+		if hashA, err = captureSimhash(ctx, redisClient, url, a, opts); err != nil {
+			return err
+		}
+		if hashB, err = captureSimhash(ctx, redisClient, url, b, opts); err != nil {
+			return err
+		}
+	}
+	if diff.Distance, err = simhash.Hamming(hashA, hashB); err != nil {
+		return err
+	}
+	diff.Similarity, _ = simhash.Similarity(hashA, hashB)
+	diff.SimhashSize = len(hashA) * 8
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(diff)
+	}
+	fmt.Printf("distance:   %d of %d bits\n", diff.Distance, diff.SimhashSize)
+	fmt.Printf("similarity: %.1f%%\n", diff.Similarity*100)
+	if len(diff.Words) > 0 {
+		fmt.Println("words:")
+		for _, w := range diff.Words {
+			fmt.Printf("  %+d %s\n", w.Delta, w.Word)
+		}
+	}
+	return nil
+}
+
+// captureSimhash returns the stored simhash of the capture of url at
+// timestamp, or calculates it when none is stored.
+func captureSimhash(ctx context.Context, redisClient *redis.Client, url, timestamp string, opts job.Options) ([]byte, error) {
+	stored, err := utils.SimhashesAt(redisClient, url, []string{timestamp})
+	if err != nil {
+		return nil, err
+	}
+	hash, ok := stored[timestamp]
+	if !ok {
+		if hash, err = job.NewJob().CalculateCapture(ctx, url, timestamp, opts); err != nil {
+			return nil, err
+		}
+	}
+	return simhash.Decode(hash, simhash.EncodingBase64)
+}
+
+// diffFeatures returns the n feature words whose weight differs most between
+// a and b.
+func diffFeatures(a, b map[string]int, n int) []featureDiff {
+	var diffs []featureDiff
+	for word, weight := range a {
+		if weight != b[word] {
+			diffs = append(diffs, featureDiff{Word: word, A: weight, B: b[word], Delta: b[word] - weight})
+		}
+	}
+	for word, weight := range b {
+		if _, ok := a[word]; !ok {
+			diffs = append(diffs, featureDiff{Word: word, B: weight, Delta: weight})
+		}
+	}
+	slices.SortFunc(diffs, func(x, y featureDiff) int {
+		abs := func(d int) int { return max(d, -d) }
+		return cmp.Or(cmp.Compare(abs(y.Delta), abs(x.Delta)), cmp.Compare(x.Word, y.Word))
+	})
+	return diffs[:min(n, len(diffs))]
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/artifacts"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+func newExportCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export (--url URL... | --file urls.txt) [--year YEAR] --output FILE|s3://BUCKET/KEY",
+		Short: "Export stored SimHashes to a Parquet file",
+		Long: `Write the SimHashes stored in Redis for each URL, of every year or of --year,
+to a Parquet file with the url, timestamp, simhash, simhash_size, algo and
+extractor columns, sorted by URL and timestamp. --file lists one URL per
+line, blank lines and lines starting with # are ignored. An s3:// output is
+uploaded with the endpoint, region and credentials of the artifacts
+configuration.`,
+		Args: cobra.NoArgs,
+		RunE: runExport,
+	}
+	cmd.Flags().StringArray("url", nil, "URL to export, may be repeated")
+	cmd.Flags().String("file", "", "file of URLs to export, - for stdin")
+	cmd.Flags().String("year", "", "export only the captures of this year")
+	cmd.Flags().String("output", "", "Parquet file to write, - for stdout, or s3://BUCKET/KEY")
+	cmd.MarkFlagsOneRequired("url", "file")
+	cmd.MarkFlagRequired("output")
+	return cmd
+}
+
+func runExport(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+	urls, _ := flags.GetStringArray("url")
+	file, _ := flags.GetString("file")
+	year, _ := flags.GetString("year")
+	output, _ := flags.GetString("output")
+	if file != "" {
+		listed, err := readURLFile(file)
+		if err != nil {
+			return err
+		}
+		urls = append(urls, listed...)
+	}
+	for _, url := range urls {
+		if err := utils.CheckURL(url); err != nil {
+			return fmt.Errorf("invalid url %q, %w", url, err)
+		}
+	}
+	if year != "" && !utils.YearIsValid(year) {
+		return fmt.Errorf("invalid year %q", year)
+	}
+
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	redisClient, err := newRedisClient(cfg)
+	if err != nil {
+		return err
+	}
+	defer redisClient.Close()
+
+	var rows []artifacts.Row
+	for _, url := range urls {
+		simhashes, err := utils.AllSimhashes(redisClient, url)
+		if err != nil {
+			return err
+		}
+		meta, err := utils.StoredMetadata(redisClient, url)
+		if err != nil {
+			return err
+		}
+		for ts := range simhashes {
+			if !strings.HasPrefix(ts, year) {
+				delete(simhashes, ts)
+			}
+		}
+		for _, row := range artifacts.SortedRows(map[string]map[string]string{url: simhashes}) {
+			row.SimhashSize, row.Algo, row.Extractor = meta.SimhashSize, meta.Algorithm, meta.Extractor
+			rows = append(rows, row)
+		}
+	}
+	metadata := map[string]string{"exported_at": time.Now().UTC().Format(time.RFC3339)}
+	if year != "" {
+		metadata["year"] = year
+	}
+
+	if strings.HasPrefix(output, "s3://") {
+		var buf bytes.Buffer
+		if err := artifacts.WriteParquet(&buf, rows, metadata); err != nil {
+			return err
+		}
+		if err := artifacts.Put(context.Background(), cfg.Artifacts, output, artifacts.PARQUET_CONTENT_TYPE, buf.Bytes()); err != nil {
+			return err
+		}
+	} else {
+		out := io.Writer(os.Stdout)
+		if output != "-" {
+			f, err := os.Create(output)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+		w := bufio.NewWriter(out)
+		if err := artifacts.WriteParquet(w, rows, metadata); err != nil {
+			return err
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "exported %d captures of %d URLs to %s\n", len(rows), len(urls), output)
+	return nil
+}
+
+// readURLFile reads the URLs of the file at path, one per line.
+func readURLFile(path string) ([]string, error) {
+	r := io.Reader(os.Stdin)
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	var urls []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			urls = append(urls, line)
+		}
+	}
+	return urls, scanner.Err()
+}
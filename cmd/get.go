@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+func newGetCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "get --url URL (--timestamp TIMESTAMP | --year YEAR)",
+		Short: "Print stored SimHashes of a capture or a year",
+		Long: `Print the SimHash stored in Redis for one capture of a URL, or for all
+captures of a year, like /simhash does, without running the HTTP server.`,
+		Args: cobra.NoArgs,
+		RunE: runGet,
+	}
+	cmd.Flags().String("url", "", "URL of the captures")
+	cmd.Flags().String("timestamp", "", "14-digit timestamp of a capture")
+	cmd.Flags().String("year", "", "year of the captures")
+	addOutputFlags(cmd)
+	cmd.MarkFlagRequired("url")
+	cmd.MarkFlagsOneRequired("timestamp", "year")
+	cmd.MarkFlagsMutuallyExclusive("timestamp", "year")
+	return cmd
+}
+
+func runGet(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+	url, _ := flags.GetString("url")
+	timestamp, _ := flags.GetString("timestamp")
+	year, _ := flags.GetString("year")
+	if err := utils.CheckURL(url); err != nil {
+		return fmt.Errorf("invalid url %q, %w", url, err)
+	}
+	out, err := outputOptions(cmd)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	redisClient, err := newRedisClient(cfg)
+	if err != nil {
+		return err
+	}
+	defer redisClient.Close()
+
+	if year != "" {
+		captures, err := utils.YearSimhash(redisClient, url, year, -1, -1)
+		if err != nil {
+			return err
+		}
+		return printCaptures(captures, out)
+	}
+
+	result, err := utils.TimestampSimHash(redisClient, url, timestamp)
+	if err != nil {
+		return err
+	}
+	hash, ok := result["simhash"]
+	if !ok {
+		return fmt.Errorf("%s", result["message"])
+	}
+	return printCaptures([]utils.CaptureResult{{Timestamp: timestamp, Simhash: hash}}, out)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/job"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/offline"
+	"github.com/Yaxhveer/wayback-discover-diff-go/pkg/simhash"
+	"github.com/spf13/cobra"
+)
+
+func newHashCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "hash PATH...",
+		Short: "Calculate the SimHashes of local HTML files and directories",
+		Long: `Calculate the SimHashes of local HTML files, and of the HTML files below
+directories, with the same extraction and algorithm as the service uses for
+captures, and print one {"path", "simhash"} JSON object per line. Files that
+cannot be hashed are printed with an "error" instead. Neither the
+configuration nor Redis is needed.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: runHash,
+	}
+	cmd.Flags().Int("simhash-size", simhash.DefaultSize, "SimHash size in bits, one of 64, 128, 256, 512")
+	cmd.Flags().String("extractor", job.ExtractorDefault, "feature extractor, one of default, weighted")
+	cmd.Flags().StringSlice("ext", offline.EXTENSIONS, "extensions of the files hashed in directories")
+	cmd.Flags().Bool("all", false, "hash every file in directories, whatever its extension")
+	cmd.Flags().Int("workers", runtime.NumCPU(), "number of files hashed at once")
+	cmd.Flags().String("encoding", simhash.EncodingBase64, "SimHash encoding, one of hex, base64, base64url")
+	return cmd
+}
+
+func runHash(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+	simhashSize, _ := flags.GetInt("simhash-size")
+	extractor, _ := flags.GetString("extractor")
+	extensions, _ := flags.GetStringSlice("ext")
+	all, _ := flags.GetBool("all")
+	workers, _ := flags.GetInt("workers")
+	encoding, _ := flags.GetString("encoding")
+	if !simhash.ValidSize(simhashSize) {
+		return fmt.Errorf("invalid simhash-size %d", simhashSize)
+	}
+	if !job.ValidExtractor(extractor) {
+		return fmt.Errorf("invalid extractor %q", extractor)
+	}
+	if !simhash.ValidEncoding(encoding) {
+		return fmt.Errorf("invalid encoding %q", encoding)
+	}
+	if all {
+		extensions = nil
+	}
+	for i, ext := range extensions {
+		extensions[i] = "." + strings.TrimPrefix(strings.ToLower(ext), ".")
+	}
+
+	opts := offline.Options{SimhashSize: simhashSize, Extractor: extractor, Extensions: extensions, Workers: workers}
+	enc := json.NewEncoder(os.Stdout)
+	var hashed, failed int
+	err := offline.Hash(context.Background(), args, opts, func(r offline.Result) error {
+		if r.Error != "" {
+			failed++
+		} else {
+			hashed++
+			hash, err := simhash.Reencode(r.Simhash, simhash.EncodingBase64, encoding)
+			if err != nil {
+				return err
+			}
+			r.Simhash = hash
+		}
+		return enc.Encode(r)
+	})
+	fmt.Fprintf(os.Stderr, "hashed %d files, %d failed\n", hashed, failed)
+	return err
+}
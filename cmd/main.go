@@ -2,59 +2,95 @@ package main
 
 import (
 	"context"
-	"log"
-	"net/http"
+	"errors"
+	"fmt"
 	"os"
-	"os/signal"
-	"syscall"
 	"time"
 
-	"github.com/Yaxhveer/wayback-discover-diff-go/internal/handlers"
-	"github.com/gin-gonic/gin"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/buildinfo"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/config"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/job"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/logging"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/utils"
 	"github.com/redis/go-redis/v9"
+	"github.com/spf13/cobra"
 )
 
 func main() {
-	redisOpts, err := redis.ParseURL("redis://localhost:6379/5")
-	if err != nil {
-		log.Fatalf("Failed to parse Redis URL: %v", err)
+	root := &cobra.Command{
+		Use:           "wdd",
+		Short:         "Calculate and query the SimHashes of Wayback Machine captures",
+		Version:       buildinfo.Version,
+		Args:          cobra.NoArgs,
+		RunE:          runServe,
+		SilenceUsage:  true,
+		SilenceErrors: true,
 	}
-	redisClient := redis.NewClient(redisOpts)
+	root.PersistentFlags().String("config", "config.yml", "path to the YAML configuration file")
+	addServeFlags(root)
+	root.AddCommand(newServeCommand(), newCalculateCommand(), newGetCommand(), newHashCommand(), newWARCCommand(), newBackfillCommand(), newDiffCommand(), newExportCommand(), newBackupCommand(), newRestoreCommand())
 
-	router := gin.Default()
-	diffHandler := handlers.NewHandler(redisClient)
-	router.GET("/", diffHandler.Root)
-	router.GET("/simhash", diffHandler.GetSimhash)
-	router.GET("/calculate-simhash", diffHandler.CalculateSimhash)
-	router.GET("/job", diffHandler.GetJobStatus)
+	if err := root.Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
 
-	// Create an HTTP server with the Gin router.
-	srv := &http.Server{
-		Addr:    ":8080",
-		Handler: router,
+// loadConfig loads and checks the configuration named by the config flag of
+// cmd, and sets up the job settings and logging from it.
+func loadConfig(cmd *cobra.Command) (*config.Config, error) {
+	configPath, _ := cmd.Flags().GetString("config")
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config, %w", err)
 	}
+	if err := checkConfig(cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", configPath, err)
+	}
+	job.Configure(cfg)
+	utils.SetCanonicalization(cfg.Canonicalize)
 
-	// Start the server in a goroutine.
-	go func() {
-		log.Println("Server is running on :8080")
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("listen: %s", err)
-		}
-	}()
+	if _, err := logging.Setup(cfg.Logging); err != nil {
+		return nil, fmt.Errorf("failed to set up logging, %w", err)
+	}
+	return cfg, nil
+}
 
-	// Create a channel to listen for OS interrupt signals.
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
-	<-quit // Block until an interrupt signal is received.
-	log.Println("Shutdown signal received, shutting down server...")
+// newRedisClient returns a client of the configured Redis.
+func newRedisClient(cfg *config.Config) (*redis.Client, error) {
+	opts, err := redis.ParseURL(cfg.Redis.URL)
+	if err != nil {
+		return nil, err
+	}
+	return redis.NewClient(opts), nil
+}
+
+// checkConfig validates cfg and checks that Redis answers, reporting every
+// problem at once.
+func checkConfig(cfg *config.Config) error {
+	err := cfg.Validate()
+	var invalid *config.ValidationError
+	if err != nil && !errors.As(err, &invalid) {
+		return err
+	}
+	if invalid == nil {
+		invalid = &config.ValidationError{}
+	}
 
-	// Create a context with a timeout for graceful shutdown.
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	if opts, err := redis.ParseURL(cfg.Redis.URL); err == nil {
+		client := redis.NewClient(opts)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := client.Ping(ctx).Err(); err != nil {
+			invalid.Problems = append(invalid.Problems, fmt.Sprintf("redis at %s is unreachable, %s", cfg.Redis.URL, err))
+		}
+		cancel()
+		client.Close()
+	} else if len(invalid.Problems) == 0 {
+		invalid.Problems = append(invalid.Problems, fmt.Sprintf("redis.url is invalid, %s", err))
+	}
 
-	// Attempt graceful shutdown.
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+	if len(invalid.Problems) > 0 {
+		return invalid
 	}
-	log.Println("Server exiting")
+	return nil
 }
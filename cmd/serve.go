@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/backup"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/buildinfo"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/config"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/handlers"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/ingest"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/job"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/leader"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/logging"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/metrics"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/profiling"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/reporting"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/server"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/tracing"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/ui"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/extra/redisotel/v9"
+	"github.com/spf13/cobra"
+)
+
+func newServeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Run the HTTP API",
+		Args:  cobra.NoArgs,
+		RunE:  runServe,
+	}
+	addServeFlags(cmd)
+	return cmd
+}
+
+// addServeFlags adds the flags of serve to cmd, which is also the root
+// command so that running wdd without a subcommand serves the API.
+func addServeFlags(cmd *cobra.Command) {
+	cmd.Flags().String("pprof", "", "serve pprof endpoints on this address, overriding the config")
+}
+
+func runServe(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	pprofAddr, _ := cmd.Flags().GetString("pprof")
+	serve(cfg, pprofAddr)
+	return nil
+}
+
+// serve runs the API until an interrupt or SIGTERM, then shuts it down
+// gracefully.
+func serve(cfg *config.Config, pprofAddr string) {
+	if pprofAddr != "" {
+		cfg.Profiling.Enabled = true
+		cfg.Profiling.Addr = pprofAddr
+	}
+	var profilingSrv *http.Server
+	if cfg.Profiling.Enabled {
+		profilingSrv = profiling.Start(cfg.Profiling)
+	}
+
+	flushReports, err := reporting.Setup(cfg.Sentry, buildinfo.Version)
+	if err != nil {
+		slog.Error("failed to set up error reporting", "error", err)
+		os.Exit(1)
+	}
+
+	closeMetrics, err := metrics.Setup(cfg.Statsd)
+	if err != nil {
+		slog.Error("failed to set up metrics", "error", err)
+		os.Exit(1)
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		slog.Error("failed to set up tracing", "error", err)
+		os.Exit(1)
+	}
+
+	redisClient, err := newRedisClient(cfg)
+	if err != nil {
+		slog.Error("failed to parse Redis URL", "error", err)
+		os.Exit(1)
+	}
+	if cfg.Tracing.Enabled {
+		if err := redisotel.InstrumentTracing(redisClient); err != nil {
+			slog.Error("failed to instrument Redis client", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	router := gin.Default()
+	// Only the configured load balancers are trusted to report the client
+	// address, which rate limiting, IP filtering and the logs rely on.
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		slog.Error("invalid trusted proxies", "error", err)
+		os.Exit(1)
+	}
+	router.RemoteIPHeaders = cfg.Server.RemoteIPHeaders
+	router.TrustedPlatform = cfg.Server.TrustedPlatform
+	router.Use(handlers.Tracing(), handlers.RequestID(), handlers.ErrorReporting())
+	if cfg.CORS.Enabled {
+		router.Use(handlers.CORS(cfg.CORS))
+	}
+	if cfg.PythonCompat {
+		router.Use(handlers.PythonCompat())
+	}
+	if cfg.CacheControl.Enabled {
+		router.Use(handlers.CacheControl(cfg.CacheControl))
+	}
+	if cfg.AccessLog.Enabled {
+		accessLog, err := logging.NewAccessLog(cfg.AccessLog)
+		if err != nil {
+			slog.Error("failed to open access log", "error", err)
+			os.Exit(1)
+		}
+		defer accessLog.Close()
+		router.Use(handlers.AccessLog(accessLog.Logger))
+	}
+	diffHandler := handlers.NewHandler(redisClient, cfg)
+	if cfg.Ingest.Enabled {
+		consumer, err := ingest.Start(cfg.Ingest, func(ctx context.Context, source string, r ingest.Request) (string, error) {
+			return diffHandler.Submit(ctx, source, r.URL, r.Year, r.SimhashSize, r.Extractor, r.Override)
+		})
+		if err != nil {
+			slog.Error("failed to start ingestion", "error", err)
+			os.Exit(1)
+		}
+		defer consumer.Close()
+	}
+
+	// Background tasks that must run once across the cluster run on the
+	// elected leader only.
+	background, stopBackground := context.WithCancel(context.Background())
+	elector := leader.New(redisClient, cfg.Leader)
+	go elector.Run(background)
+	go diffHandler.Cluster().Run(background)
+	job.StartAutoscaler(background)
+	if cfg.Audit.Enabled && cfg.Audit.TrimInterval > 0 {
+		elector.Every(background, "audit-trim", cfg.Audit.TrimInterval, diffHandler.TrimAudit)
+	}
+	if cfg.Backup.Enabled {
+		backups := backup.New(redisClient, cfg.Backup, cfg.Leader.Key)
+		elector.Every(background, "backup", cfg.Backup.Interval, func(ctx context.Context) error {
+			path, stats, err := backups.Run(ctx)
+			if err == nil {
+				slog.Info("backed up redis keys", "path", path, "keys", stats.Keys, "skipped", stats.Skipped)
+			}
+			return err
+		})
+	}
+
+	router.GET("/", diffHandler.Root)
+	router.GET("/healthz", diffHandler.Healthz)
+	router.GET("/readyz", diffHandler.Readyz)
+	router.GET("/info", diffHandler.Info)
+
+	// Calculations and reads are restricted to the configured networks, their
+	// params are validated, and they require an API key when configured.
+	// Both are rate limited once the key is known.
+	calculations := router.Group("", handlers.IPFilter(cfg.IPFilter.Calculations), handlers.ValidateParams())
+	reads := router.Group("", handlers.IPFilter(cfg.IPFilter.Reads), handlers.ValidateParams(), handlers.SelectFields())
+	if cfg.APIKeys.Enabled {
+		calculations.Use(diffHandler.APIKeyAuth())
+		if cfg.APIKeys.Reads {
+			reads.Use(diffHandler.APIKeyAuth())
+		}
+	}
+	if cfg.RateLimit.Enabled {
+		calculations.Use(diffHandler.RateLimit())
+		reads.Use(diffHandler.RateLimit())
+	}
+	calculations.GET("/calculate-simhash", diffHandler.CalculateSimhash)
+	calculations.POST("/calculate-simhash", diffHandler.CalculateBatch)
+	calculations.POST("/save", diffHandler.SaveCapture)
+	calculations.GET("/calculate-sitemap", diffHandler.CalculateSitemap)
+	router.GET("/usage", diffHandler.APIKeyAuth(), diffHandler.GetUsage)
+	reads.GET("/simhash", diffHandler.GetSimhash)
+	reads.GET("/simhash/duplicates", diffHandler.GetDuplicates)
+	reads.GET("/simhash/calendar", diffHandler.GetCalendar)
+	reads.GET("/job", diffHandler.GetJobStatus)
+	reads.POST("/job/status", diffHandler.PostJobStatus)
+	reads.GET("/job/logs", diffHandler.GetJobLogs)
+	reads.GET("/distance", diffHandler.GetDistance)
+	reads.POST("/diff/matrix", diffHandler.PostDistanceMatrix)
+	reads.GET("/nearest", diffHandler.GetNearest)
+	reads.GET("/clusters", diffHandler.GetClusters)
+	reads.GET("/similar", diffHandler.GetSimilar)
+	reads.GET("/volatility", diffHandler.GetVolatility)
+	reads.GET("/verify", diffHandler.VerifySimhash)
+
+	// Operator endpoints, guarded by the admin token.
+	admin := router.Group("/admin", handlers.IPFilter(cfg.IPFilter.Admin), handlers.AdminAuth(cfg.Admin.Token))
+	admin.GET("", diffHandler.Dashboard)
+	admin.GET("/audit", diffHandler.GetAudit)
+	admin.GET("/stats", diffHandler.GetStats)
+	admin.GET("/usage", diffHandler.GetAllUsage)
+	admin.DELETE("/simhash", diffHandler.DeleteSimhashes)
+	admin.POST("/cache/flush", diffHandler.FlushCaches)
+	admin.GET("/apikeys", diffHandler.ListAPIKeys)
+	admin.POST("/apikeys", diffHandler.CreateAPIKey)
+	admin.POST("/apikeys/:name/enable", diffHandler.EnableAPIKey)
+	admin.POST("/apikeys/:name/disable", diffHandler.DisableAPIKey)
+	admin.PUT("/apikeys/:name/quota", diffHandler.SetAPIKeyQuota)
+	admin.DELETE("/apikeys/:name", diffHandler.DeleteAPIKey)
+	admin.Any("/debug/pprof/*profile", gin.WrapH(http.StripPrefix("/admin", profiling.Handler())))
+
+	router.StaticFS("/ui", ui.FS())
+
+	// Create an HTTP server with the Gin router.
+	srv := server.New(cfg.Server, router)
+
+	// Start the server in a goroutine.
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("listen failed", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	// Create a channel to listen for OS interrupt signals.
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit // Block until an interrupt signal is received.
+	slog.Info("shutdown signal received, shutting down server")
+	diffHandler.Cluster().Leave()
+
+	// Create a context with a timeout for graceful shutdown.
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Shutdown.Timeout)
+	defer cancel()
+
+	// Attempt graceful shutdown.
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Error("server forced to shutdown", "error", err)
+	}
+	if profilingSrv != nil {
+		profilingSrv.Shutdown(ctx)
+	}
+
+	stopBackground()
+	elector.Resign()
+
+	// Let running jobs finish within the same deadline, then checkpoint the rest.
+	report := diffHandler.Drain(ctx)
+	slog.Info("shutdown drain report",
+		"drained", report.Drained, "checkpointed", report.Checkpointed, "abandoned", report.Abandoned)
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Warn("failed to flush traces", "error", err)
+	}
+	flushReports(2 * time.Second)
+	closeMetrics()
+	slog.Info("server exiting")
+}
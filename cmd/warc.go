@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/job"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/warc"
+	"github.com/Yaxhveer/wayback-discover-diff-go/pkg/simhash"
+	"github.com/spf13/cobra"
+)
+
+func newWARCCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "warc FILE...",
+		Short: "Store the SimHashes of the HTML responses of WARC files",
+		Long: `Read the response records of WARC and WARC.GZ files, calculate the SimHashes
+of their HTML payloads and store them in Redis under the URL and timestamp of
+each record, as jobs store the captures they download. URLs are stored
+without their scheme, e.g. example.com/page. The counts of the import are
+printed as JSON.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: runWARC,
+	}
+	cmd.Flags().Int("simhash-size", 0, "SimHash size in bits, one of 64, 128, 256, 512 (default from the config)")
+	cmd.Flags().String("extractor", job.ExtractorDefault, "feature extractor, one of default, weighted")
+	cmd.Flags().Bool("override", false, "replace SimHashes stored with another algorithm or extractor instead of skipping their URL")
+	cmd.Flags().Int("workers", runtime.NumCPU(), "number of payloads hashed at once")
+	return cmd
+}
+
+func runWARC(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+	simhashSize, _ := flags.GetInt("simhash-size")
+	extractor, _ := flags.GetString("extractor")
+	override, _ := flags.GetBool("override")
+	workers, _ := flags.GetInt("workers")
+	if !job.ValidExtractor(extractor) {
+		return fmt.Errorf("invalid extractor %q", extractor)
+	}
+
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	if simhashSize == 0 {
+		simhashSize = cfg.Simhash.Size
+	} else if !simhash.ValidSize(simhashSize) {
+		return fmt.Errorf("invalid simhash-size %d", simhashSize)
+	}
+	redisClient, err := newRedisClient(cfg)
+	if err != nil {
+		return err
+	}
+	defer redisClient.Close()
+
+	stats, err := warc.Import(context.Background(), redisClient, args, warc.Options{
+		SimhashSize: simhashSize,
+		Extractor:   extractor,
+		Override:    override,
+		Workers:     workers,
+	})
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if encErr := enc.Encode(stats); encErr != nil && err == nil {
+		err = encErr
+	}
+	return err
+}
@@ -0,0 +1,207 @@
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// JOBS_KEY_PREFIX prefixes the Redis counters of the jobs started by each
+// key per day.
+const JOBS_KEY_PREFIX = "quota:jobs:"
+
+// APIKEYS_KEY is the Redis hash of the keys created at runtime, mapping the
+// SHA-256 of each key to its JSON record. Keys themselves are not stored.
+const APIKEYS_KEY = "apikeys"
+
+// ErrNotFound is returned for a key name that does not exist.
+var ErrNotFound = errors.New("api key not found")
+
+// Key describes an API key.
+type Key struct {
+	Name     string    `json:"name"`
+	Disabled bool      `json:"disabled"`
+	Created  time.Time `json:"created,omitzero"`
+	// Quota limits the key, the default quota applies when it is nil.
+	Quota *config.Quota `json:"quota,omitempty"`
+	// Static keys come from the configuration and cannot be changed at
+	// runtime.
+	Static bool `json:"static,omitempty"`
+}
+
+// Store looks API keys up in the configuration, then in Redis.
+type Store struct {
+	redisClient  *redis.Client
+	static       map[string]Key
+	defaultQuota config.Quota
+}
+
+// New returns a store of the keys of cfg and of the keys in Redis.
+func New(redisClient *redis.Client, cfg config.APIKeysConfig) *Store {
+	s := &Store{redisClient: redisClient, static: make(map[string]Key, len(cfg.Keys)), defaultQuota: cfg.DefaultQuota}
+	for _, k := range cfg.Keys {
+		s.static[hash(k.Key)] = Key{Name: k.Name, Disabled: k.Disabled, Quota: k.Quota, Static: true}
+	}
+	return s
+}
+
+// Lookup returns the key matching secret and whether it exists.
+func (s *Store) Lookup(ctx context.Context, secret string) (Key, bool, error) {
+	h := hash(secret)
+	if k, ok := s.static[h]; ok {
+		return k, true, nil
+	}
+	data, err := s.redisClient.HGet(ctx, APIKEYS_KEY, h).Bytes()
+	if err == redis.Nil {
+		return Key{}, false, nil
+	} else if err != nil {
+		return Key{}, false, fmt.Errorf("cannot look api key up, %w", err)
+	}
+	var k Key
+	if err := json.Unmarshal(data, &k); err != nil {
+		return Key{}, false, err
+	}
+	return k, true, nil
+}
+
+// List returns every key, sorted by name.
+func (s *Store) List(ctx context.Context) ([]Key, error) {
+	records, err := s.redisClient.HGetAll(ctx, APIKEYS_KEY).Result()
+	if err != nil {
+		return nil, fmt.Errorf("cannot list api keys, %w", err)
+	}
+	keys := make([]Key, 0, len(s.static)+len(records))
+	for _, k := range s.static {
+		keys = append(keys, k)
+	}
+	for _, data := range records {
+		var k Key
+		if err := json.Unmarshal([]byte(data), &k); err == nil {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Name < keys[j].Name })
+	return keys, nil
+}
+
+// QuotaOf returns the quota of k.
+func (s *Store) QuotaOf(k Key) config.Quota {
+	if k.Quota != nil {
+		return *k.Quota
+	}
+	return s.defaultQuota
+}
+
+// CountJob counts a job started today by the key called name, unless limit
+// jobs were already started today. It reports whether the job was counted.
+func (s *Store) CountJob(ctx context.Context, name string, limit int) (bool, error) {
+	key := JOBS_KEY_PREFIX + name + ":" + time.Now().UTC().Format("20060102")
+	pipe := s.redisClient.TxPipeline()
+	count := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, 48*time.Hour)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, fmt.Errorf("cannot count jobs of api key %s, %w", name, err)
+	}
+	if limit > 0 && count.Val() > int64(limit) {
+		s.redisClient.Decr(ctx, key)
+		return false, nil
+	}
+	return true, nil
+}
+
+// Create stores a new enabled key called name with quota, nil for the
+// default quota, and returns its secret, which cannot be retrieved
+// afterwards.
+func (s *Store) Create(ctx context.Context, name string, quota *config.Quota) (string, error) {
+	if _, _, err := s.find(ctx, name); err == nil {
+		return "", fmt.Errorf("api key %s already exists", name)
+	} else if !errors.Is(err, ErrNotFound) {
+		return "", err
+	}
+
+	b := make([]byte, 24)
+	rand.Read(b)
+	secret := hex.EncodeToString(b)
+	data, err := json.Marshal(Key{Name: name, Created: time.Now().UTC(), Quota: quota})
+	if err != nil {
+		return "", err
+	}
+	if err := s.redisClient.HSet(ctx, APIKEYS_KEY, hash(secret), data).Err(); err != nil {
+		return "", fmt.Errorf("cannot create api key %s, %w", name, err)
+	}
+	return secret, nil
+}
+
+// SetDisabled enables or disables the key called name.
+func (s *Store) SetDisabled(ctx context.Context, name string, disabled bool) error {
+	return s.update(ctx, name, func(k *Key) { k.Disabled = disabled })
+}
+
+// SetQuota sets the quota of the key called name, nil for the default quota.
+func (s *Store) SetQuota(ctx context.Context, name string, quota *config.Quota) error {
+	return s.update(ctx, name, func(k *Key) { k.Quota = quota })
+}
+
+// update applies change to the Redis key called name.
+func (s *Store) update(ctx context.Context, name string, change func(*Key)) error {
+	h, k, err := s.find(ctx, name)
+	if err != nil {
+		return err
+	}
+	change(&k)
+	data, err := json.Marshal(k)
+	if err != nil {
+		return err
+	}
+	if err := s.redisClient.HSet(ctx, APIKEYS_KEY, h, data).Err(); err != nil {
+		return fmt.Errorf("cannot update api key %s, %w", name, err)
+	}
+	return nil
+}
+
+// Delete removes the key called name.
+func (s *Store) Delete(ctx context.Context, name string) error {
+	h, _, err := s.find(ctx, name)
+	if err != nil {
+		return err
+	}
+	if err := s.redisClient.HDel(ctx, APIKEYS_KEY, h).Err(); err != nil {
+		return fmt.Errorf("cannot delete api key %s, %w", name, err)
+	}
+	return nil
+}
+
+// find returns the hash and record of the Redis key called name. Static keys
+// are reported as errors as they cannot be changed.
+func (s *Store) find(ctx context.Context, name string) (string, Key, error) {
+	for _, k := range s.static {
+		if k.Name == name {
+			return "", Key{}, fmt.Errorf("api key %s is set in the configuration", name)
+		}
+	}
+	records, err := s.redisClient.HGetAll(ctx, APIKEYS_KEY).Result()
+	if err != nil {
+		return "", Key{}, fmt.Errorf("cannot read api keys, %w", err)
+	}
+	for h, data := range records {
+		var k Key
+		if err := json.Unmarshal([]byte(data), &k); err == nil && k.Name == name {
+			return h, k, nil
+		}
+	}
+	return "", Key{}, ErrNotFound
+}
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,200 @@
+// Package artifacts uploads the results of completed jobs to an S3 bucket,
+// so data pipelines can consume them without querying the API or Redis.
+package artifacts
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/config"
+)
+
+// Manifest describes the artifacts of a job.
+type Manifest struct {
+	JobID       string    `json:"job_id"`
+	URL         string    `json:"url"`
+	Year        string    `json:"year"`
+	SimhashSize int       `json:"simhash_size"`
+	Algo        string    `json:"algo"`
+	Extractor   string    `json:"extractor"`
+	Captures    int       `json:"captures"`
+	URLs        int       `json:"urls"`
+	CompletedAt time.Time `json:"completed_at"`
+	Duration    float64   `json:"duration"`
+	Files       []File    `json:"files"`
+}
+
+// File is an uploaded result file.
+type File struct {
+	Key    string `json:"key"`
+	Format string `json:"format"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Uploader uploads job results. A nil Uploader uploads nothing.
+type Uploader struct {
+	s3      *s3Client
+	prefix  string
+	formats []string
+	timeout time.Duration
+}
+
+// New returns an uploader for cfg, or nil when artifacts are disabled.
+func New(cfg config.ArtifactsConfig) *Uploader {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &Uploader{
+		s3:      newS3Client(cfg, cfg.Bucket),
+		prefix:  cfg.Prefix,
+		formats: cfg.Formats,
+		timeout: cfg.Timeout,
+	}
+}
+
+// newS3Client returns a client of bucket with the endpoint, region and
+// credentials of cfg.
+func newS3Client(cfg config.ArtifactsConfig, bucket string) *s3Client {
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	u, _ := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	return &s3Client{
+		httpClient:   &http.Client{},
+		endpoint:     u,
+		bucket:       bucket,
+		region:       cfg.Region,
+		pathStyle:    cfg.PathStyle,
+		accessKey:    withEnv(cfg.AccessKeyID, "AWS_ACCESS_KEY_ID"),
+		secretKey:    withEnv(cfg.SecretAccessKey, "AWS_SECRET_ACCESS_KEY"),
+		sessionToken: withEnv(cfg.SessionToken, "AWS_SESSION_TOKEN"),
+	}
+}
+
+// Put uploads data to dest, an s3://BUCKET/KEY URL, with the endpoint, region
+// and credentials of cfg, whether artifacts are enabled or not.
+func Put(ctx context.Context, cfg config.ArtifactsConfig, dest, contentType string, data []byte) error {
+	bucket, key, ok := strings.Cut(strings.TrimPrefix(dest, "s3://"), "/")
+	if !strings.HasPrefix(dest, "s3://") || !ok || bucket == "" || key == "" {
+		return fmt.Errorf("invalid S3 URL %q, expected s3://BUCKET/KEY", dest)
+	}
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+	}
+	return newS3Client(cfg, bucket).put(ctx, key, contentType, data)
+}
+
+func withEnv(value, env string) string {
+	if value != "" {
+		return value
+	}
+	return os.Getenv(env)
+}
+
+// Upload writes results, url -> timestamp -> simhash, in each configured
+// format under PREFIX/JOB_ID/, then the manifest m completed with the files.
+// It returns the key of the manifest.
+func (u *Uploader) Upload(ctx context.Context, m Manifest, results map[string]map[string]string) (string, error) {
+	if u == nil {
+		return "", nil
+	}
+	dir := u.prefix + m.JobID + "/"
+	rows := SortedRows(results)
+	for i := range rows {
+		rows[i].SimhashSize, rows[i].Algo, rows[i].Extractor = m.SimhashSize, m.Algo, m.Extractor
+	}
+	m.Captures, m.URLs = len(rows), len(results)
+
+	for _, format := range u.formats {
+		data, contentType, err := encode(format, rows, map[string]string{"job_id": m.JobID, "url": m.URL, "year": m.Year})
+		if err != nil {
+			return "", err
+		}
+		key := dir + "simhashes." + format
+		if err := u.put(ctx, key, contentType, data); err != nil {
+			return "", err
+		}
+		m.Files = append(m.Files, File{Key: key, Format: format, Size: len(data), SHA256: sha256Hex(data)})
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	key := dir + "manifest.json"
+	return key, u.put(ctx, key, "application/json", data)
+}
+
+func (u *Uploader) put(ctx context.Context, key, contentType string, data []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, u.timeout)
+	defer cancel()
+	return u.s3.put(ctx, key, contentType, data)
+}
+
+// Row is a simhash of the results. The NDJSON and CSV files only hold its
+// URL, timestamp and simhash.
+type Row struct {
+	URL         string `json:"url"`
+	Timestamp   string `json:"timestamp"`
+	Simhash     string `json:"simhash"`
+	SimhashSize int    `json:"-"`
+	Algo        string `json:"-"`
+	Extractor   string `json:"-"`
+}
+
+// SortedRows flattens results, url -> timestamp -> simhash, sorted by URL and
+// timestamp.
+func SortedRows(results map[string]map[string]string) []Row {
+	var rows []Row
+	for u, hashes := range results {
+		for ts, hash := range hashes {
+			rows = append(rows, Row{URL: u, Timestamp: ts, Simhash: hash})
+		}
+	}
+	slices.SortFunc(rows, func(a, b Row) int {
+		if c := strings.Compare(a.URL, b.URL); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Timestamp, b.Timestamp)
+	})
+	return rows
+}
+
+// encode writes rows as NDJSON, CSV with a url,timestamp,simhash header or
+// Parquet with metadata.
+func encode(format string, rows []Row, metadata map[string]string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	if format == "parquet" {
+		err := WriteParquet(&buf, rows, metadata)
+		return buf.Bytes(), PARQUET_CONTENT_TYPE, err
+	}
+	if format == "csv" {
+		w := csv.NewWriter(&buf)
+		w.Write([]string{"url", "timestamp", "simhash"})
+		for _, r := range rows {
+			w.Write([]string{r.URL, r.Timestamp, r.Simhash})
+		}
+		w.Flush()
+		return buf.Bytes(), "text/csv", w.Error()
+	}
+	enc := json.NewEncoder(&buf)
+	for _, r := range rows {
+		if err := enc.Encode(r); err != nil {
+			return nil, "", err
+		}
+	}
+	return buf.Bytes(), "application/x-ndjson", nil
+}
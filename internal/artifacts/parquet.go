@@ -0,0 +1,33 @@
+package artifacts
+
+import (
+	"io"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/parquet"
+)
+
+// PARQUET_CONTENT_TYPE is the media type of Parquet files.
+const PARQUET_CONTENT_TYPE = "application/vnd.apache.parquet"
+
+// PARQUET_COLUMNS are the columns of the Parquet files of simhashes.
+var PARQUET_COLUMNS = []parquet.Column{
+	{Name: "url", Type: parquet.STRING},
+	{Name: "timestamp", Type: parquet.STRING},
+	{Name: "simhash", Type: parquet.STRING},
+	{Name: "simhash_size", Type: parquet.INT32},
+	{Name: "algo", Type: parquet.STRING},
+	{Name: "extractor", Type: parquet.STRING},
+}
+
+// WriteParquet writes rows to w as a Parquet file with the url, timestamp,
+// simhash, simhash_size, algo and extractor columns and metadata as its
+// key-value metadata.
+func WriteParquet(w io.Writer, rows []Row, metadata map[string]string) error {
+	pw := parquet.NewWriter(w, PARQUET_COLUMNS, metadata)
+	for _, r := range rows {
+		if err := pw.Write(r.URL, r.Timestamp, r.Simhash, r.SimhashSize, r.Algo, r.Extractor); err != nil {
+			return err
+		}
+	}
+	return pw.Close()
+}
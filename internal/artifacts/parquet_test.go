@@ -0,0 +1,47 @@
+package artifacts
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/parquet"
+)
+
+func TestWriteParquet(t *testing.T) {
+	rows := SortedRows(map[string]map[string]string{
+		"example.com": {"20200101000000": "AAAA", "20200201000000": "AAAB"},
+	})
+	for i := range rows {
+		rows[i].SimhashSize, rows[i].Algo, rows[i].Extractor = 256, "simhash", "text"
+	}
+	var buf bytes.Buffer
+	if err := WriteParquet(&buf, rows, map[string]string{"year": "2020"}); err != nil {
+		t.Fatal(err)
+	}
+
+	file := buf.Bytes()
+	if !bytes.HasPrefix(file, []byte(parquet.MAGIC)) || !bytes.HasSuffix(file, []byte(parquet.MAGIC)) {
+		t.Fatalf("file does not start and end with %s", parquet.MAGIC)
+	}
+	footerLen := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	if footerLen <= 0 || footerLen > len(file)-12 {
+		t.Fatalf("footer length %d in a file of %d bytes", footerLen, len(file))
+	}
+	footer := file[len(file)-8-footerLen : len(file)-8]
+	// FileMetaData opens with version 1 (field 1, i32, zigzag 2) and the
+	// schema list (field 2) of the root and the six columns.
+	if want := []byte{0x15, 0x02, 0x19, 0x7C}; !bytes.HasPrefix(footer, want) {
+		t.Errorf("footer starts % x, want % x", footer[:len(want)], want)
+	}
+	// num_rows (field 3, i64) follows the schema, whose last element ends
+	// with the extractor name and its UTF8 annotation: 2 rows, zigzag 4.
+	if !bytes.Contains(footer, []byte{'t', 'o', 'r', 0x25, 0x00, 0x00, 0x16, 0x04}) {
+		t.Errorf("footer does not record 2 rows after the extractor column")
+	}
+	for _, s := range []string{"url", "timestamp", "simhash", "simhash_size", "algo", "extractor", "year", "2020", parquet.CREATED_BY} {
+		if !bytes.Contains(footer, []byte(s)) {
+			t.Errorf("footer lacks %q", s)
+		}
+	}
+}
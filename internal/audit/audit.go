@@ -0,0 +1,126 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// AUDIT_KEY is the sorted set holding audit entries scored by their time.
+const AUDIT_KEY = "audit:calculations"
+
+// Entry records who requested a calculation of which URL and year, and when.
+type Entry struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	ClientIP  string    `json:"client_ip"`
+	APIKey    string    `json:"api_key,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	URL       string    `json:"url"`
+	Year      string    `json:"year"`
+	JobID     string    `json:"job_id,omitempty"`
+	// Status is STARTED for a new job, PENDING when an active job was reused
+	// or NO_CAPTURES when CDX listed nothing to calculate.
+	Status string `json:"status"`
+}
+
+// Filter selects audit entries, empty fields match everything.
+type Filter struct {
+	URL      string
+	ClientIP string
+	APIKey   string
+	Since    time.Time
+	Until    time.Time
+	Limit    int
+}
+
+// Log stores audit entries in Redis, dropping those older than retention and
+// the oldest beyond maxEntries.
+type Log struct {
+	redisClient *redis.Client
+	retention   time.Duration
+	maxEntries  int64
+}
+
+// New returns an audit log on redisClient.
+func New(redisClient *redis.Client, retention time.Duration, maxEntries int64) *Log {
+	return &Log{redisClient: redisClient, retention: retention, maxEntries: maxEntries}
+}
+
+// Record stores e and enforces the retention limits.
+func (l *Log) Record(ctx context.Context, e Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	pipe := l.redisClient.Pipeline()
+	pipe.ZAdd(ctx, AUDIT_KEY, redis.Z{Score: float64(e.Time.UnixMilli()), Member: data})
+	l.trim(ctx, pipe, e.Time)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("cannot record audit entry, %w", err)
+	}
+	return nil
+}
+
+// Trim enforces the retention limits and returns the number of dropped
+// entries.
+func (l *Log) Trim(ctx context.Context) (int64, error) {
+	pipe := l.redisClient.Pipeline()
+	l.trim(ctx, pipe, time.Now())
+	cmds, err := pipe.Exec(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("cannot trim audit log, %w", err)
+	}
+	var dropped int64
+	for _, cmd := range cmds {
+		dropped += cmd.(*redis.IntCmd).Val()
+	}
+	return dropped, nil
+}
+
+// trim queues on pipe the removal of the entries beyond the retention limits
+// at now.
+func (l *Log) trim(ctx context.Context, pipe redis.Pipeliner, now time.Time) {
+	if l.retention > 0 {
+		pipe.ZRemRangeByScore(ctx, AUDIT_KEY, "-inf", "("+strconv.FormatInt(now.Add(-l.retention).UnixMilli(), 10))
+	}
+	if l.maxEntries > 0 {
+		pipe.ZRemRangeByRank(ctx, AUDIT_KEY, 0, -l.maxEntries-1)
+	}
+}
+
+// Query returns the entries matching f, newest first.
+func (l *Log) Query(ctx context.Context, f Filter) ([]Entry, error) {
+	max := "+inf"
+	if !f.Until.IsZero() {
+		max = strconv.FormatInt(f.Until.UnixMilli(), 10)
+	}
+	min := "-inf"
+	if !f.Since.IsZero() {
+		min = strconv.FormatInt(f.Since.UnixMilli(), 10)
+	}
+	members, err := l.redisClient.ZRevRangeByScore(ctx, AUDIT_KEY, &redis.ZRangeBy{Min: min, Max: max}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read audit log, %w", err)
+	}
+
+	entries := []Entry{}
+	for _, member := range members {
+		var e Entry
+		if err := json.Unmarshal([]byte(member), &e); err != nil {
+			continue
+		}
+		if (f.URL != "" && e.URL != f.URL) || (f.ClientIP != "" && e.ClientIP != f.ClientIP) || (f.APIKey != "" && e.APIKey != f.APIKey) {
+			continue
+		}
+		entries = append(entries, e)
+		if f.Limit > 0 && len(entries) == f.Limit {
+			break
+		}
+	}
+	return entries, nil
+}
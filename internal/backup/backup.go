@@ -0,0 +1,346 @@
+// Package backup dumps the Redis keys of the service to gzipped NDJSON files
+// and restores them, independent of the RDB and AOF persistence of Redis,
+// which operators may not control. Values are written per type, so a dump
+// restores into any Redis version.
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/apikeys"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/cluster"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/config"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/ratelimit"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// FORMAT identifies backup files in their header.
+const FORMAT = "wayback-discover-diff-backup"
+
+// VERSION is the version of the format of the backup files written.
+const VERSION = 1
+
+// FILE_PREFIX and FILE_SUFFIX surround the UTC time of a backup in the name
+// of its file.
+const (
+	FILE_PREFIX = "wdd-backup-"
+	FILE_SUFFIX = ".ndjson.gz"
+)
+
+// SCAN_COUNT is the number of keys read at once.
+const SCAN_COUNT = 1000
+
+// WRITE_BATCH is the number of members written by one command on restore.
+const WRITE_BATCH = 1000
+
+// header is the first line of a backup file.
+type header struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// record is a key of a backup file. Value holds a string for strings, an
+// object for hashes, an array of members for sets and lists and an array of
+// {member, score} objects for sorted sets.
+type record struct {
+	Key   string          `json:"key"`
+	Type  string          `json:"type"`
+	TTL   int64           `json:"ttl_ms,omitempty"`
+	Value json.RawMessage `json:"value"`
+}
+
+type scored struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+}
+
+// Stats counts the keys of a backup or restore.
+type Stats struct {
+	Keys int `json:"keys"`
+	// Skipped counts the transient keys and keys of unsupported types left
+	// out of a backup, or the keys already present left alone by a restore.
+	Skipped int `json:"skipped"`
+}
+
+// Backup dumps and restores the keys of the service.
+type Backup struct {
+	redisClient *redis.Client
+	cfg         config.BackupConfig
+	// transient are the keys, or key prefixes ending with a colon, that
+	// only matter while the service runs and are left out of backups.
+	transient []string
+}
+
+// New returns a backup of the keys of redisClient. leaderKey is the lease of
+// the leader election, left out of backups.
+func New(redisClient *redis.Client, cfg config.BackupConfig, leaderKey string) *Backup {
+	return &Backup{
+		redisClient: redisClient,
+		cfg:         cfg,
+		transient:   []string{ratelimit.KEY_PREFIX, apikeys.JOBS_KEY_PREFIX, cluster.MEMBERS_KEY, leaderKey},
+	}
+}
+
+func (b *Backup) isTransient(key string) bool {
+	for _, t := range b.transient {
+		if key == t || strings.HasSuffix(t, ":") && strings.HasPrefix(key, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Run writes a new backup file to the configured directory and removes the
+// oldest files beyond the configured number kept. It returns the path of
+// the file.
+func (b *Backup) Run(ctx context.Context) (string, Stats, error) {
+	if err := os.MkdirAll(b.cfg.Dir, 0o755); err != nil {
+		return "", Stats{}, err
+	}
+	name := FILE_PREFIX + time.Now().UTC().Format("20060102T150405Z") + FILE_SUFFIX
+	path := filepath.Join(b.cfg.Dir, name)
+	// Write to a temporary file first, so that a failed backup never
+	// replaces a good one nor counts toward those kept.
+	tmp, err := os.CreateTemp(b.cfg.Dir, "."+name+".*")
+	if err != nil {
+		return "", Stats{}, err
+	}
+	defer os.Remove(tmp.Name())
+	stats, err := b.Write(ctx, tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", stats, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", stats, err
+	}
+	return path, stats, b.prune()
+}
+
+// prune removes the oldest backup files beyond the configured number kept.
+func (b *Backup) prune() error {
+	files, err := filepath.Glob(filepath.Join(b.cfg.Dir, FILE_PREFIX+"*"+FILE_SUFFIX))
+	if err != nil {
+		return err
+	}
+	// Names sort by the time of their backup.
+	slices.Sort(files)
+	var errs []error
+	for len(files) > b.cfg.Keep {
+		errs = append(errs, os.Remove(files[0]))
+		files = files[1:]
+	}
+	return errors.Join(errs...)
+}
+
+// Write dumps every key of the Redis database but the transient ones to w.
+// Keys written while the backup runs may or may not be included.
+func (b *Backup) Write(ctx context.Context, w io.Writer) (Stats, error) {
+	var stats Stats
+	zw := gzip.NewWriter(w)
+	enc := json.NewEncoder(zw)
+	if err := enc.Encode(header{Format: FORMAT, Version: VERSION, CreatedAt: time.Now().UTC()}); err != nil {
+		return stats, err
+	}
+
+	var cursor uint64
+	for {
+		keys, next, err := b.redisClient.Scan(ctx, cursor, "*", SCAN_COUNT).Result()
+		if err != nil {
+			return stats, err
+		}
+		for _, key := range keys {
+			if b.isTransient(key) {
+				stats.Skipped++
+				continue
+			}
+			r, err := b.dump(ctx, key)
+			if errors.Is(err, redis.Nil) {
+				// Expired or deleted since the scan.
+				continue
+			}
+			if err != nil {
+				return stats, err
+			}
+			if r == nil {
+				stats.Skipped++
+				continue
+			}
+			if err := enc.Encode(r); err != nil {
+				return stats, err
+			}
+			stats.Keys++
+		}
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	return stats, zw.Close()
+}
+
+// dump reads key into a record, nil for types that are not backed up such
+// as streams.
+func (b *Backup) dump(ctx context.Context, key string) (*record, error) {
+	typ, err := b.redisClient.Type(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	var value any
+	switch typ {
+	case "none":
+		return nil, redis.Nil
+	case "string":
+		value, err = b.redisClient.Get(ctx, key).Result()
+	case "hash":
+		value, err = b.redisClient.HGetAll(ctx, key).Result()
+	case "set":
+		value, err = b.redisClient.SMembers(ctx, key).Result()
+	case "list":
+		value, err = b.redisClient.LRange(ctx, key, 0, -1).Result()
+	case "zset":
+		var members []redis.Z
+		members, err = b.redisClient.ZRangeWithScores(ctx, key, 0, -1).Result()
+		list := make([]scored, len(members))
+		for i, m := range members {
+			list[i] = scored{Member: fmt.Sprint(m.Member), Score: m.Score}
+		}
+		value = list
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	r := &record{Key: key, Type: typ, Value: raw}
+	if ttl, err := b.redisClient.PTTL(ctx, key).Result(); err == nil && ttl > 0 {
+		r.TTL = ttl.Milliseconds()
+	}
+	return r, nil
+}
+
+// Restore writes the keys of the backup read from r. Keys already present
+// are left alone unless replace is set, which replaces them with the keys
+// of the backup.
+func (b *Backup) Restore(ctx context.Context, r io.Reader, replace bool) (Stats, error) {
+	var stats Stats
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return stats, fmt.Errorf("not a backup file, %w", err)
+	}
+	defer zr.Close()
+	dec := json.NewDecoder(bufio.NewReader(zr))
+	var h header
+	if err := dec.Decode(&h); err != nil || h.Format != FORMAT {
+		return stats, fmt.Errorf("not a backup file")
+	}
+	if h.Version > VERSION {
+		return stats, fmt.Errorf("backup format version %d is newer than the supported version %d", h.Version, VERSION)
+	}
+
+	for {
+		var rec record
+		if err := dec.Decode(&rec); err == io.EOF {
+			return stats, nil
+		} else if err != nil {
+			return stats, fmt.Errorf("corrupt backup after %d keys, %w", stats.Keys, err)
+		}
+		if !replace {
+			n, err := b.redisClient.Exists(ctx, rec.Key).Result()
+			if err != nil {
+				return stats, err
+			}
+			if n > 0 {
+				stats.Skipped++
+				continue
+			}
+		}
+		if err := b.restore(ctx, rec); err != nil {
+			return stats, fmt.Errorf("cannot restore %s, %w", rec.Key, err)
+		}
+		stats.Keys++
+	}
+}
+
+// restore writes rec in place of its key.
+func (b *Backup) restore(ctx context.Context, rec record) error {
+	pipe := b.redisClient.TxPipeline()
+	pipe.Del(ctx, rec.Key)
+	switch rec.Type {
+	case "string":
+		var value string
+		if err := json.Unmarshal(rec.Value, &value); err != nil {
+			return err
+		}
+		pipe.Set(ctx, rec.Key, value, 0)
+	case "hash":
+		var value map[string]string
+		if err := json.Unmarshal(rec.Value, &value); err != nil {
+			return err
+		}
+		fields := make([]any, 0, 2*WRITE_BATCH)
+		for field, v := range value {
+			fields = append(fields, field, v)
+			if len(fields) == 2*WRITE_BATCH {
+				pipe.HSet(ctx, rec.Key, fields...)
+				fields = fields[:0]
+			}
+		}
+		if len(fields) > 0 {
+			pipe.HSet(ctx, rec.Key, fields...)
+		}
+	case "set", "list":
+		var value []string
+		if err := json.Unmarshal(rec.Value, &value); err != nil {
+			return err
+		}
+		for chunk := range slices.Chunk(value, WRITE_BATCH) {
+			members := make([]any, len(chunk))
+			for i, m := range chunk {
+				members[i] = m
+			}
+			if rec.Type == "set" {
+				pipe.SAdd(ctx, rec.Key, members...)
+			} else {
+				pipe.RPush(ctx, rec.Key, members...)
+			}
+		}
+	case "zset":
+		var value []scored
+		if err := json.Unmarshal(rec.Value, &value); err != nil {
+			return err
+		}
+		for chunk := range slices.Chunk(value, WRITE_BATCH) {
+			members := make([]redis.Z, len(chunk))
+			for i, m := range chunk {
+				members[i] = redis.Z{Member: m.Member, Score: m.Score}
+			}
+			pipe.ZAdd(ctx, rec.Key, members...)
+		}
+	default:
+		return fmt.Errorf("unsupported type %s", rec.Type)
+	}
+	if rec.TTL > 0 {
+		pipe.PExpire(ctx, rec.Key, time.Duration(rec.TTL)*time.Millisecond)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
@@ -0,0 +1,163 @@
+package bktree
+
+import (
+	"sort"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/pkg/simhash"
+)
+
+// Tree is a BK-tree over packed simhashes of equal size using the hamming
+// distance. Captures with identical simhashes share a node.
+type Tree struct {
+	root *node
+	size int
+}
+
+type node struct {
+	hash       []byte
+	timestamps []string
+	children   map[int]*node
+}
+
+// Result is a capture found by Search.
+type Result struct {
+	Timestamp string `json:"timestamp"`
+	Distance  int    `json:"distance"`
+}
+
+// New returns an empty tree.
+func New() *Tree {
+	return &Tree{}
+}
+
+// Len returns the number of captures in the tree.
+func (t *Tree) Len() int {
+	return t.size
+}
+
+// Insert adds a capture to the tree. Hashes of a different size than the
+// ones already inserted are ignored.
+func (t *Tree) Insert(hash []byte, timestamp string) {
+	if t.root == nil {
+		t.root = &node{hash: hash, timestamps: []string{timestamp}}
+		t.size++
+		return
+	}
+	if len(hash) != len(t.root.hash) {
+		return
+	}
+
+	n := t.root
+	for {
+		distance, _ := simhash.Hamming(n.hash, hash)
+		if distance == 0 {
+			n.timestamps = append(n.timestamps, timestamp)
+			t.size++
+			return
+		}
+		child, ok := n.children[distance]
+		if !ok {
+			if n.children == nil {
+				n.children = make(map[int]*node)
+			}
+			n.children[distance] = &node{hash: hash, timestamps: []string{timestamp}}
+			t.size++
+			return
+		}
+		n = child
+	}
+}
+
+// Search returns the captures within maxDistance of hash, closest first.
+func (t *Tree) Search(hash []byte, maxDistance int) []Result {
+	var results []Result
+	for _, m := range t.searchNodes(hash, maxDistance) {
+		for _, ts := range m.node.timestamps {
+			results = append(results, Result{Timestamp: ts, Distance: m.distance})
+		}
+	}
+
+	sort.Slice(results, func(a, b int) bool {
+		if results[a].Distance != results[b].Distance {
+			return results[a].Distance < results[b].Distance
+		}
+		return results[a].Timestamp < results[b].Timestamp
+	})
+	return results
+}
+
+type nodeMatch struct {
+	node     *node
+	distance int
+}
+
+// searchNodes returns the nodes within maxDistance of hash.
+func (t *Tree) searchNodes(hash []byte, maxDistance int) []nodeMatch {
+	if t.root == nil || len(hash) != len(t.root.hash) {
+		return nil
+	}
+
+	var matches []nodeMatch
+	stack := []*node{t.root}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		distance, _ := simhash.Hamming(n.hash, hash)
+		if distance <= maxDistance {
+			matches = append(matches, nodeMatch{node: n, distance: distance})
+		}
+		// By the triangle inequality only children at a distance within
+		// [distance-maxDistance, distance+maxDistance] can hold matches.
+		for d, child := range n.children {
+			if d >= distance-maxDistance && d <= distance+maxDistance {
+				stack = append(stack, child)
+			}
+		}
+	}
+	return matches
+}
+
+// Clusters groups the captures into connected components in which every
+// capture is within maxDistance of at least one other member. Each cluster
+// is sorted chronologically and clusters are ordered by their first capture.
+func (t *Tree) Clusters(maxDistance int) [][]string {
+	if t.root == nil {
+		return nil
+	}
+
+	visited := make(map[*node]bool)
+	var clusters [][]string
+	stack := []*node{t.root}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, child := range n.children {
+			stack = append(stack, child)
+		}
+		if visited[n] {
+			continue
+		}
+
+		// Breadth-first expansion of the component containing n.
+		visited[n] = true
+		var cluster []string
+		queue := []*node{n}
+		for len(queue) > 0 {
+			cur := queue[0]
+			queue = queue[1:]
+			cluster = append(cluster, cur.timestamps...)
+			for _, m := range t.searchNodes(cur.hash, maxDistance) {
+				if !visited[m.node] {
+					visited[m.node] = true
+					queue = append(queue, m.node)
+				}
+			}
+		}
+		sort.Strings(cluster)
+		clusters = append(clusters, cluster)
+	}
+
+	sort.Slice(clusters, func(a, b int) bool { return clusters[a][0] < clusters[b][0] })
+	return clusters
+}
@@ -0,0 +1,69 @@
+package bktree
+
+import (
+	"sync"
+	"time"
+)
+
+// Cache keeps the trees of recently queried URLs. An entry is reused as long
+// as the revision of the stored simhashes it was built from is unchanged.
+type Cache struct {
+	mu         sync.Mutex
+	entries    map[string]*cacheEntry
+	maxEntries int
+}
+
+type cacheEntry struct {
+	tree     *Tree
+	revision int64
+	lastUsed time.Time
+}
+
+// NewCache returns a cache holding the trees of up to maxEntries URLs.
+func NewCache(maxEntries int) *Cache {
+	return &Cache{
+		entries:    make(map[string]*cacheEntry),
+		maxEntries: maxEntries,
+	}
+}
+
+// Get returns the cached tree of key if it was built at revision.
+func (c *Cache) Get(key string, revision int64) (*Tree, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || entry.revision != revision {
+		return nil, false
+	}
+	entry.lastUsed = time.Now()
+	return entry.tree, true
+}
+
+// Put stores the tree of key built at revision, evicting the least recently
+// used entry when the cache is full.
+func (c *Cache) Put(key string, revision int64, tree *Tree) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.maxEntries {
+		var oldestKey string
+		var oldest time.Time
+		for k, e := range c.entries {
+			if oldestKey == "" || e.lastUsed.Before(oldest) {
+				oldestKey, oldest = k, e.lastUsed
+			}
+		}
+		delete(c.entries, oldestKey)
+	}
+	c.entries[key] = &cacheEntry{tree: tree, revision: revision, lastUsed: time.Now()}
+}
+
+// Clear drops every cached tree and returns how many there were.
+func (c *Cache) Clear() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := len(c.entries)
+	c.entries = make(map[string]*cacheEntry)
+	return n
+}
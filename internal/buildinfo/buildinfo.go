@@ -0,0 +1,37 @@
+package buildinfo
+
+import (
+	"runtime/debug"
+)
+
+// Build metadata, set at link time with
+//
+//	go build -ldflags "-X github.com/Yaxhveer/wayback-discover-diff-go/internal/buildinfo.Version=1.2.0 \
+//		-X github.com/Yaxhveer/wayback-discover-diff-go/internal/buildinfo.Commit=$(git rev-parse HEAD) \
+//		-X github.com/Yaxhveer/wayback-discover-diff-go/internal/buildinfo.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd
+//
+// Commit and Date default to the VCS information Go records in the binary.
+var (
+	Version = "1.0.0"
+	Commit  = ""
+	Date    = ""
+)
+
+func init() {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if Commit == "" {
+				Commit = setting.Value
+			}
+		case "vcs.time":
+			if Date == "" {
+				Date = setting.Value
+			}
+		}
+	}
+}
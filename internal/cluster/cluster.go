@@ -0,0 +1,140 @@
+package cluster
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// MEMBERS_KEY is the sorted set of the advertised URLs of the instances,
+// scored by their last heartbeat.
+const MEMBERS_KEY = "cluster:members"
+
+// MISSED_HEARTBEATS is the number of heartbeats an instance may miss before
+// it is dropped from the ring.
+const MISSED_HEARTBEATS = 3
+
+// Membership tracks the live instances of the cluster through heartbeats in
+// Redis and assigns URLs to them. A nil Membership, used when clustering is
+// disabled, owns every URL.
+type Membership struct {
+	redisClient *redis.Client
+	self        string
+	interval    time.Duration
+
+	mu      sync.RWMutex
+	members []string
+	ring    *Ring
+}
+
+// New returns the membership of this instance for cfg, or nil when
+// clustering is disabled.
+func New(redisClient *redis.Client, cfg config.ClusterConfig) *Membership {
+	if !cfg.Enabled {
+		return nil
+	}
+	self := []string{strings.TrimSuffix(cfg.AdvertiseURL, "/")}
+	return &Membership{
+		redisClient: redisClient,
+		self:        self[0],
+		interval:    cfg.HeartbeatInterval,
+		members:     self,
+		ring:        NewRing(self),
+	}
+}
+
+// Self returns the advertised URL of this instance.
+func (m *Membership) Self() string {
+	if m == nil {
+		return ""
+	}
+	return m.self
+}
+
+// Members returns the advertised URLs of the live instances.
+func (m *Membership) Members() []string {
+	if m == nil {
+		return nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return slices.Clone(m.members)
+}
+
+// Owner returns the advertised URL of the instance owning key and whether it
+// is this instance.
+func (m *Membership) Owner(key string) (string, bool) {
+	if m == nil {
+		return "", true
+	}
+	m.mu.RLock()
+	owner := m.ring.Owner(key)
+	m.mu.RUnlock()
+	return owner, owner == m.self
+}
+
+// Run sends heartbeats and refreshes the ring until ctx is done.
+func (m *Membership) Run(ctx context.Context) {
+	if m == nil {
+		return
+	}
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		if err := m.heartbeat(ctx); err != nil {
+			slog.Warn("cluster heartbeat failed", "self", m.self, "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// heartbeat records this instance as alive, drops the instances that missed
+// too many heartbeats and rebuilds the ring when the members changed.
+func (m *Membership) heartbeat(ctx context.Context) error {
+	now := time.Now()
+	deadline := strconv.FormatInt(now.Add(-MISSED_HEARTBEATS*m.interval).UnixMilli(), 10)
+
+	pipe := m.redisClient.TxPipeline()
+	pipe.ZAdd(ctx, MEMBERS_KEY, redis.Z{Score: float64(now.UnixMilli()), Member: m.self})
+	pipe.ZRemRangeByScore(ctx, MEMBERS_KEY, "-inf", "("+deadline)
+	live := pipe.ZRange(ctx, MEMBERS_KEY, 0, -1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	members := live.Val()
+	slices.Sort(members)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if slices.Equal(members, m.members) {
+		return nil
+	}
+	slog.Info("cluster members changed", "members", members)
+	m.members = members
+	m.ring = NewRing(members)
+	return nil
+}
+
+// Leave removes this instance from the cluster so its URLs move to the
+// other instances at their next heartbeat.
+func (m *Membership) Leave() {
+	if m == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := m.redisClient.ZRem(ctx, MEMBERS_KEY, m.self).Err(); err != nil {
+		slog.Warn("cannot leave cluster", "self", m.self, "error", err)
+	}
+}
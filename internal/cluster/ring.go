@@ -0,0 +1,45 @@
+package cluster
+
+import (
+	"hash/crc32"
+	"slices"
+	"strconv"
+)
+
+// VNODES is the number of points each member owns on the ring, which evens
+// out the share of keys between members.
+const VNODES = 128
+
+// Ring assigns keys to members by consistent hashing, so adding or removing a
+// member only moves the keys of its neighbours.
+type Ring struct {
+	points  []uint32
+	members map[uint32]string
+}
+
+// NewRing returns a ring of members.
+func NewRing(members []string) *Ring {
+	r := &Ring{members: make(map[uint32]string, len(members)*VNODES)}
+	for _, m := range members {
+		for i := 0; i < VNODES; i++ {
+			p := crc32.ChecksumIEEE([]byte(m + "#" + strconv.Itoa(i)))
+			r.points = append(r.points, p)
+			r.members[p] = m
+		}
+	}
+	slices.Sort(r.points)
+	return r
+}
+
+// Owner returns the member owning key, or "" when the ring is empty.
+func (r *Ring) Owner(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	h := crc32.ChecksumIEEE([]byte(key))
+	i, _ := slices.BinarySearch(r.points, h)
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.members[r.points[i]]
+}
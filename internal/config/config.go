@@ -0,0 +1,765 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/netip"
+	"net/url"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the service configuration loaded from a YAML file.
+type Config struct {
+	Server    ServerConfig    `yaml:"server"`
+	Redis     RedisConfig     `yaml:"redis"`
+	Simhash   SimhashConfig   `yaml:"simhash"`
+	Snapshots SnapshotsConfig `yaml:"snapshots"`
+	Archive   ArchiveConfig   `yaml:"archive"`
+	// Canonicalize rewrites URLs before they are stored and listed in CDX.
+	Canonicalize CanonicalizeConfig `yaml:"canonicalize"`
+	// Concurrency is the number of captures a job downloads at once.
+	Concurrency int `yaml:"concurrency"`
+	// AdaptiveConcurrency lowers the concurrency of a job while the archive
+	// is slow or failing.
+	AdaptiveConcurrency AdaptiveConcurrencyConfig `yaml:"adaptive_concurrency"`
+	// CDXAuthToken is sent as the cdx_auth_token cookie to the Wayback Machine.
+	CDXAuthToken string `yaml:"cdx_auth_token"`
+	// MemoryBudgetMB bounds the capture bodies held in memory across all
+	// jobs, 0 for no bound.
+	MemoryBudgetMB int `yaml:"memory_budget_mb"`
+	// PythonCompat answers with the field names, states and response shapes
+	// of the original Python service, for clients such as the Wayback
+	// Machine Changes UI.
+	PythonCompat bool               `yaml:"python_compat"`
+	Logging      LoggingConfig      `yaml:"logging"`
+	AccessLog    AccessLogConfig    `yaml:"access_log"`
+	Tracing      TracingConfig      `yaml:"tracing"`
+	Profiling    ProfilingConfig    `yaml:"profiling"`
+	Sentry       SentryConfig       `yaml:"sentry"`
+	Audit        AuditConfig        `yaml:"audit"`
+	Statsd       StatsdConfig       `yaml:"statsd"`
+	Events       EventsConfig       `yaml:"events"`
+	Ingest       IngestConfig       `yaml:"ingest"`
+	Admin        AdminConfig        `yaml:"admin"`
+	Shutdown     ShutdownConfig     `yaml:"shutdown"`
+	Leader       LeaderConfig       `yaml:"leader"`
+	Cluster      ClusterConfig      `yaml:"cluster"`
+	Workers      WorkersConfig      `yaml:"workers"`
+	CORS         CORSConfig         `yaml:"cors"`
+	APIKeys      APIKeysConfig      `yaml:"api_keys"`
+	RateLimit    RateLimitConfig    `yaml:"rate_limit"`
+	IPFilter     IPFilterConfig     `yaml:"ip_filter"`
+	CacheControl CacheControlConfig `yaml:"cache_control"`
+	SPN          SPNConfig          `yaml:"spn"`
+	Artifacts    ArtifactsConfig    `yaml:"artifacts"`
+	Notify       NotifyConfig       `yaml:"notify"`
+	Backup       BackupConfig       `yaml:"backup"`
+}
+
+// ServerConfig configures the HTTP server of the API.
+type ServerConfig struct {
+	// Addr is the TCP address to listen on, e.g. :8080 or 127.0.0.1:8080, or
+	// empty to only listen on UnixSocket.
+	Addr       string           `yaml:"addr"`
+	UnixSocket UnixSocketConfig `yaml:"unix_socket"`
+	// ReadHeaderTimeout bounds reading the request headers, which stops
+	// clients from holding connections open by sending them slowly.
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes"`
+	TLS               TLSConfig     `yaml:"tls"`
+	HTTP2             HTTP2Config   `yaml:"http2"`
+	// TrustedProxies lists the CIDRs, or addresses, of the load balancers in
+	// front of the service. The client address is read from RemoteIPHeaders
+	// only on requests coming from them.
+	TrustedProxies  []string `yaml:"trusted_proxies"`
+	RemoteIPHeaders []string `yaml:"remote_ip_headers"`
+	// TrustedPlatform is a header set by the platform with the client
+	// address, e.g. CF-Connecting-IP behind Cloudflare, trusted on every
+	// request.
+	TrustedPlatform string `yaml:"trusted_platform"`
+}
+
+// HTTP2Config configures HTTP/2, which lets clients multiplex many requests
+// over one connection.
+type HTTP2Config struct {
+	// Enabled serves HTTP/2 to TLS clients that negotiate it.
+	Enabled bool `yaml:"enabled"`
+	// H2C serves cleartext HTTP/2 to clients with prior knowledge, e.g.
+	// behind a proxy speaking h2c to the service.
+	H2C                  bool `yaml:"h2c"`
+	MaxConcurrentStreams int  `yaml:"max_concurrent_streams"`
+}
+
+// UnixSocketConfig configures listening on a Unix socket, e.g. for a reverse
+// proxy on the same host.
+type UnixSocketConfig struct {
+	// Path is the socket file, the socket is disabled when it is empty.
+	Path string `yaml:"path"`
+	// Mode is the octal permissions of the socket file, e.g. "0660".
+	Mode string `yaml:"mode"`
+}
+
+// TLSConfig configures HTTPS. It is served with CertFile and KeyFile, or with
+// certificates obtained from Let's Encrypt when Autocert is enabled, and
+// plain HTTP is served otherwise.
+type TLSConfig struct {
+	CertFile string         `yaml:"cert_file"`
+	KeyFile  string         `yaml:"key_file"`
+	Autocert AutocertConfig `yaml:"autocert"`
+}
+
+// AutocertConfig configures obtaining certificates from Let's Encrypt.
+type AutocertConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Domains are the host names certificates are requested for.
+	Domains []string `yaml:"domains"`
+	// CacheDir keeps the certificates across restarts.
+	CacheDir string `yaml:"cache_dir"`
+	Email    string `yaml:"email"`
+	// HTTPAddr answers the HTTP-01 challenges and redirects other requests
+	// to HTTPS, Let's Encrypt expects it on port 80.
+	HTTPAddr string `yaml:"http_addr"`
+}
+
+// CORSConfig configures cross-origin requests from browser frontends hosted
+// on other origins.
+type CORSConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// AllowedOrigins lists the origins allowed to call the API, e.g.
+	// https://web.archive.org, or * for any.
+	AllowedOrigins   []string      `yaml:"allowed_origins"`
+	AllowedMethods   []string      `yaml:"allowed_methods"`
+	AllowedHeaders   []string      `yaml:"allowed_headers"`
+	ExposedHeaders   []string      `yaml:"exposed_headers"`
+	AllowCredentials bool          `yaml:"allow_credentials"`
+	MaxAge           time.Duration `yaml:"max_age"`
+}
+
+// APIKeysConfig configures the API keys required by the calculation
+// endpoints. Keys are listed here or created at runtime through the admin
+// endpoints.
+type APIKeysConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Reads also requires a key for the read endpoints.
+	Reads bool           `yaml:"reads"`
+	Keys  []StaticAPIKey `yaml:"keys"`
+	// DefaultQuota applies to keys without a quota of their own.
+	DefaultQuota Quota `yaml:"default_quota"`
+}
+
+// RateLimitConfig configures rate limiting of the API endpoints with token
+// buckets shared by all instances through Redis.
+type RateLimitConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// PerIP limits each client address.
+	PerIP RateConfig `yaml:"per_ip"`
+	// PerKey limits each API key, whatever the addresses it is used from.
+	PerKey RateConfig `yaml:"per_key"`
+}
+
+// RateConfig is a token bucket refilled with Rate tokens per second up to
+// Burst tokens, each request taking one. A Rate of 0 disables the bucket.
+type RateConfig struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+// IPFilterConfig restricts the client addresses allowed to call each group
+// of endpoints, e.g. calculations to internal networks while reads stay
+// public.
+type IPFilterConfig struct {
+	Calculations IPListConfig `yaml:"calculations"`
+	Reads        IPListConfig `yaml:"reads"`
+	Admin        IPListConfig `yaml:"admin"`
+}
+
+// IPListConfig lists CIDRs, or single addresses, allowed and denied. Any
+// address is allowed when Allow is empty, and Deny wins over Allow.
+type IPListConfig struct {
+	Allow []string `yaml:"allow"`
+	Deny  []string `yaml:"deny"`
+	// DenyUnix refuses the requests on Unix sockets, which have no client
+	// address and are allowed otherwise.
+	DenyUnix bool `yaml:"deny_unix"`
+}
+
+// ParsePrefix parses a CIDR such as 10.0.0.0/8, or a single address as the
+// prefix of its full length.
+func ParsePrefix(s string) (netip.Prefix, error) {
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return prefix.Masked(), nil
+}
+
+// CacheControlConfig configures the Cache-Control headers of successful
+// responses, so CDNs and browsers can serve repeat reads of popular URLs.
+type CacheControlConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Endpoints maps routes, e.g. /distance, to their Cache-Control policy.
+	Endpoints map[string]string  `yaml:"endpoints"`
+	Simhash   SimhashCacheConfig `yaml:"simhash"`
+}
+
+// SimhashCacheConfig sets the Cache-Control policies of /simhash.
+type SimhashCacheConfig struct {
+	// Historical applies to past years, which gain no new captures.
+	Historical string `yaml:"historical"`
+	// Current applies to the current year.
+	Current string `yaml:"current"`
+	// InProgress applies while a job calculates the year.
+	InProgress string `yaml:"in_progress"`
+}
+
+// SPNConfig configures Save Page Now, which archives a URL on demand so its
+// simhash can be calculated from a fresh capture.
+type SPNConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// AccessKey and SecretKey are the archive.org keys authenticating the
+	// captures.
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+	// URL is the Save Page Now endpoint, its status endpoint is URL/status.
+	URL string `yaml:"url"`
+	// PollInterval is the time between status checks of a capture.
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// Timeout bounds the wait for a capture to complete.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// ArtifactsConfig configures the upload of the results of completed jobs to
+// an S3 bucket.
+type ArtifactsConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Bucket  string `yaml:"bucket"`
+	// Prefix is prepended to the keys of the artifacts, e.g. simhashes/.
+	Prefix string `yaml:"prefix"`
+	Region string `yaml:"region"`
+	// Endpoint is the S3 endpoint, https://s3.REGION.amazonaws.com when
+	// empty. Other S3 compatible stores such as MinIO need PathStyle.
+	Endpoint  string `yaml:"endpoint"`
+	PathStyle bool   `yaml:"path_style"`
+	// AccessKeyID and SecretAccessKey default to the AWS_ACCESS_KEY_ID and
+	// AWS_SECRET_ACCESS_KEY environment variables, SessionToken to
+	// AWS_SESSION_TOKEN.
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+	SessionToken    string `yaml:"session_token"`
+	// Formats are the formats of the results uploaded, ndjson, csv and
+	// parquet.
+	Formats []string      `yaml:"formats"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// NotifyConfig configures the notifications of job outcomes to operators.
+type NotifyConfig struct {
+	// OnFailure notifies every failed job.
+	OnFailure bool `yaml:"on_failure"`
+	// OnCompletion notifies the completed jobs that ran for at least
+	// MinDuration.
+	OnCompletion bool          `yaml:"on_completion"`
+	MinDuration  time.Duration `yaml:"min_duration"`
+	// Template is the text/template of the messages, executed with the
+	// JobID, URL, Year, State, Duration, Processed, Total, Failed and Info
+	// of the job.
+	Template string      `yaml:"template"`
+	Slack    SlackConfig `yaml:"slack"`
+	Email    EmailConfig `yaml:"email"`
+}
+
+// BackupConfig configures the scheduled backups of the Redis keys of the
+// service.
+type BackupConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Dir is the directory the backup files are written to.
+	Dir      string        `yaml:"dir"`
+	Interval time.Duration `yaml:"interval"`
+	// Keep is the number of most recent backup files kept in Dir.
+	Keep int `yaml:"keep"`
+}
+
+// SlackConfig configures notifications posted to a Slack incoming webhook.
+type SlackConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	WebhookURL string `yaml:"webhook_url"`
+}
+
+// EmailConfig configures notifications sent by email through an SMTP
+// server.
+type EmailConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Addr is the host:port of the SMTP server.
+	Addr string `yaml:"addr"`
+	// Username and Password authenticate with PLAIN auth when set.
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+}
+
+// StaticAPIKey is an API key set in the configuration.
+type StaticAPIKey struct {
+	Name     string `yaml:"name"`
+	Key      string `yaml:"key"`
+	Disabled bool   `yaml:"disabled"`
+	// Quota overrides DefaultQuota for this key.
+	Quota *Quota `yaml:"quota"`
+}
+
+// Quota limits what an API key may run, 0 for no limit.
+type Quota struct {
+	JobsPerDay     int `yaml:"jobs_per_day" json:"jobs_per_day"`
+	CapturesPerJob int `yaml:"captures_per_job" json:"captures_per_job"`
+	ConcurrentJobs int `yaml:"concurrent_jobs" json:"concurrent_jobs"`
+}
+
+// RedisConfig configures the Redis connection.
+type RedisConfig struct {
+	URL string `yaml:"url"`
+}
+
+// SimhashConfig configures the simhashes computed by jobs.
+type SimhashConfig struct {
+	// Size is the simhash size in bits used when a request does not pick one.
+	Size int `yaml:"size"`
+	// ExpireAfter is how long stored simhashes are kept.
+	ExpireAfter time.Duration `yaml:"expire_after"`
+}
+
+// SnapshotsConfig limits the captures handled per request.
+type SnapshotsConfig struct {
+	// NumberPerYear limits the captures fetched from CDX per job, -1 for all.
+	NumberPerYear int `yaml:"number_per_year"`
+	// NumberPerPage is the page size of paginated /simhash results.
+	NumberPerPage int `yaml:"number_per_page"`
+}
+
+// ArchiveConfig selects the Wayback deployment captures are listed and
+// downloaded from, the Wayback Machine or another OpenWayback or pywb archive.
+type ArchiveConfig struct {
+	// TimemapURL is the CDX endpoint listing the captures of a URL.
+	TimemapURL string `yaml:"timemap_url"`
+	// ReplayURL is the URL of the original bytes of a capture, with
+	// {timestamp} and {url} replaced by those of the capture.
+	ReplayURL string `yaml:"replay_url"`
+	// ArchiveItURL is the Wayback of Archive-It, serving the collection=
+	// captures below /COLLECTION.
+	ArchiveItURL string `yaml:"archive_it_url"`
+	// CDXFallbackURL is the classic CDX API queried when TimemapURL fails
+	// or truncates its answer, none when empty.
+	CDXFallbackURL string `yaml:"cdx_fallback_url"`
+	// SplitMonths lists the captures of huge years with a query per month.
+	SplitMonths SplitMonthsConfig `yaml:"split_months"`
+	// Name labels the captures of the archive above when Sources are set.
+	Name string `yaml:"name"`
+	// Sources are further archives whose captures of a URL are merged with
+	// those of the archive above, for URLs covered unevenly across archives.
+	Sources []ArchiveSource `yaml:"sources"`
+}
+
+// SplitMonthsConfig selects when the captures of a year are listed with
+// concurrent queries per month instead of a single query, whose answer may
+// take longer than CDX allows for URLs with enormous numbers of captures.
+type SplitMonthsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// MinCaptures is the number of captures of a year from which it is
+	// split.
+	MinCaptures int `yaml:"min_captures"`
+	// Concurrency is the number of months listed at once.
+	Concurrency int `yaml:"concurrency"`
+}
+
+// ArchiveSource is a further archive captures are listed and downloaded from.
+type ArchiveSource struct {
+	// Name labels the simhashes of the captures of the archive.
+	Name       string `yaml:"name"`
+	TimemapURL string `yaml:"timemap_url"`
+	ReplayURL  string `yaml:"replay_url"`
+}
+
+// CanonicalizeConfig selects the rewrites applied to URLs before they are
+// stored and listed in CDX, so that variants of a URL share a timeline.
+type CanonicalizeConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// StripFragment removes the #fragment.
+	StripFragment bool `yaml:"strip_fragment"`
+	// StripParams are the query params removed, with * globs, e.g. utm_*.
+	StripParams []string `yaml:"strip_params"`
+	// LowercaseHost lowercases the scheme and host.
+	LowercaseHost bool `yaml:"lowercase_host"`
+	// DefaultPorts removes :80 from http and :443 from https URLs, and both
+	// from URLs without a scheme.
+	DefaultPorts bool `yaml:"default_ports"`
+}
+
+// LoggingConfig configures application logs.
+type LoggingConfig struct {
+	// Level is one of debug, info, warn, error.
+	Level string `yaml:"level"`
+	// Format is text or json.
+	Format string `yaml:"format"`
+}
+
+// AccessLogConfig configures the HTTP access log.
+type AccessLogConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Path    string `yaml:"path"`
+	// Format is text or json.
+	Format string `yaml:"format"`
+	// MaxSizeMB rotates the file once it grows over this size.
+	MaxSizeMB int `yaml:"max_size_mb"`
+	// RotateInterval rotates the file on this interval, e.g. 24h. Zero
+	// disables time based rotation.
+	RotateInterval time.Duration `yaml:"rotate_interval"`
+	MaxAgeDays     int           `yaml:"max_age_days"`
+	MaxBackups     int           `yaml:"max_backups"`
+	Compress       bool          `yaml:"compress"`
+}
+
+// TracingConfig configures OpenTelemetry tracing.
+type TracingConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Endpoint is the host:port of an OTLP/HTTP collector (Jaeger, OTel collector).
+	Endpoint    string  `yaml:"endpoint"`
+	Insecure    bool    `yaml:"insecure"`
+	ServiceName string  `yaml:"service_name"`
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+// ProfilingConfig configures the pprof endpoints.
+type ProfilingConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Addr is the admin-only address serving /debug/pprof/.
+	Addr string `yaml:"addr"`
+	// BlockProfileRate and MutexProfileFraction enable the block and mutex
+	// profiles, see runtime.SetBlockProfileRate and runtime.SetMutexProfileFraction.
+	BlockProfileRate     int `yaml:"block_profile_rate"`
+	MutexProfileFraction int `yaml:"mutex_profile_fraction"`
+}
+
+// SentryConfig configures error reporting to Sentry or a compatible service.
+type SentryConfig struct {
+	// DSN of the project, reporting is disabled when empty.
+	DSN         string  `yaml:"dsn"`
+	Environment string  `yaml:"environment"`
+	SampleRate  float64 `yaml:"sample_rate"`
+}
+
+// AuditConfig configures the audit log of calculation requests.
+type AuditConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Retention drops entries older than this, e.g. 720h.
+	Retention  time.Duration `yaml:"retention"`
+	MaxEntries int64         `yaml:"max_entries"`
+	// TrimInterval is how often the retention limits are enforced when no
+	// entries are recorded.
+	TrimInterval time.Duration `yaml:"trim_interval"`
+}
+
+// StatsdConfig configures shipping metrics to a statsd server.
+type StatsdConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Address string `yaml:"address"`
+	Prefix  string `yaml:"prefix"`
+}
+
+// EventsConfig configures the job lifecycle events published to Redis.
+type EventsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Channel is the pub/sub channel, events are not published when empty.
+	Channel string `yaml:"channel"`
+	// Stream is the stream events are appended to, none when empty.
+	Stream       string `yaml:"stream"`
+	StreamMaxLen int64  `yaml:"stream_max_len"`
+}
+
+// IngestConfig configures the consumer of calculation requests from NATS.
+type IngestConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	URL     string `yaml:"url"`
+	Subject string `yaml:"subject"`
+	// Queue is the queue group shared by the instances consuming Subject.
+	Queue string `yaml:"queue"`
+}
+
+// AdminConfig configures the operator endpoints.
+type AdminConfig struct {
+	// Token is the bearer token required by the admin endpoints, which are
+	// disabled when it is empty.
+	Token string `yaml:"token"`
+}
+
+// ShutdownConfig configures graceful shutdown.
+type ShutdownConfig struct {
+	// Timeout bounds how long shutdown waits for in-flight requests and
+	// running jobs before checkpointing or abandoning them.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// LeaderConfig configures the election of the instance running the
+// background tasks that must run once per cluster.
+type LeaderConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Key is the Redis key holding the ID of the current leader.
+	Key string `yaml:"key"`
+	// TTL is how long leadership lasts without being renewed, so a crashed
+	// leader is replaced after at most TTL.
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// ClusterConfig configures the assignment of URLs to the instances of a
+// cluster.
+type ClusterConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// AdvertiseURL is the base URL other instances and clients reach this
+	// instance at, e.g. http://10.0.0.12:8080.
+	AdvertiseURL      string        `yaml:"advertise_url"`
+	HeartbeatInterval time.Duration `yaml:"heartbeat_interval"`
+	// Secret is shared by the instances. It authenticates the requests they
+	// forward to each other and signs the routed param of redirects.
+	Secret string `yaml:"secret"`
+}
+
+// WorkersConfig configures the pool of workers downloading and extracting
+// captures across jobs.
+type WorkersConfig struct {
+	// Adaptive resizes the pool between Min and Max every Interval instead
+	// of running Concurrency workers per job.
+	Adaptive bool          `yaml:"adaptive"`
+	Min      int           `yaml:"min"`
+	Max      int           `yaml:"max"`
+	Interval time.Duration `yaml:"interval"`
+	// TargetCPU is the share of the CPU above which the pool shrinks.
+	TargetCPU float64 `yaml:"target_cpu"`
+	// MaxHeapMB is the heap size above which the pool shrinks.
+	MaxHeapMB int `yaml:"max_heap_mb"`
+	// TargetLatency is the average web.archive.org response time above
+	// which the pool shrinks.
+	TargetLatency time.Duration `yaml:"target_latency"`
+}
+
+// AdaptiveConcurrencyConfig adjusts the captures a job downloads at once
+// AIMD-style: the limit is halved, down to Min, when a download fails or
+// takes longer than TargetLatency, and grows back by one per limit
+// downloads answered in time, up to the concurrency of the job.
+type AdaptiveConcurrencyConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	Min           int           `yaml:"min"`
+	TargetLatency time.Duration `yaml:"target_latency"`
+}
+
+// Default returns the configuration used when no file is given.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr: ":8080",
+			UnixSocket: UnixSocketConfig{
+				Mode: "0660",
+			},
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			WriteTimeout:      60 * time.Second,
+			IdleTimeout:       120 * time.Second,
+			MaxHeaderBytes:    1 << 20,
+			RemoteIPHeaders:   []string{"X-Forwarded-For", "X-Real-IP"},
+			TLS: TLSConfig{
+				Autocert: AutocertConfig{
+					CacheDir: "certs",
+					HTTPAddr: ":80",
+				},
+			},
+			HTTP2: HTTP2Config{
+				Enabled:              true,
+				MaxConcurrentStreams: 250,
+			},
+		},
+		Redis: RedisConfig{
+			URL: "redis://localhost:6379/5",
+		},
+		CORS: CORSConfig{
+			AllowedMethods: []string{"GET", "POST", "DELETE"},
+			AllowedHeaders: []string{"Authorization", "Content-Type", "X-Request-ID"},
+			ExposedHeaders: []string{"X-Request-ID"},
+			MaxAge:         10 * time.Minute,
+		},
+		RateLimit: RateLimitConfig{
+			PerIP:  RateConfig{Rate: 10, Burst: 20},
+			PerKey: RateConfig{Rate: 50, Burst: 100},
+		},
+		CacheControl: CacheControlConfig{
+			Endpoints: map[string]string{
+				"/job":      "no-store",
+				"/job/logs": "no-store",
+			},
+			Simhash: SimhashCacheConfig{
+				Historical: "public, max-age=86400",
+				Current:    "public, max-age=300",
+				InProgress: "no-store",
+			},
+		},
+		Notify: NotifyConfig{
+			OnFailure:    true,
+			OnCompletion: true,
+			MinDuration:  10 * time.Minute,
+			Template:     "Job {{.JobID}} {{.State}}: {{.URL}}{{if .Year}} {{.Year}}{{end}} in {{.Duration}}, {{.Processed}} of {{.Total}} done, {{.Failed}} failed.{{if .Info}} {{.Info}}{{end}}",
+		},
+		Backup: BackupConfig{
+			Dir:      "backups",
+			Interval: 24 * time.Hour,
+			Keep:     7,
+		},
+		Artifacts: ArtifactsConfig{
+			Region:  "us-east-1",
+			Formats: []string{"ndjson"},
+			Timeout: time.Minute,
+		},
+		SPN: SPNConfig{
+			URL:          "https://web.archive.org/save",
+			PollInterval: 5 * time.Second,
+			Timeout:      5 * time.Minute,
+		},
+		Simhash: SimhashConfig{
+			Size:        256,
+			ExpireAfter: 24 * time.Hour,
+		},
+		Snapshots: SnapshotsConfig{
+			NumberPerYear: -1,
+			NumberPerPage: 600,
+		},
+		Archive: ArchiveConfig{
+			TimemapURL:     "https://web.archive.org/web/timemap",
+			ReplayURL:      "https://web.archive.org/web/{timestamp}id_/{url}",
+			ArchiveItURL:   "https://wayback.archive-it.org",
+			CDXFallbackURL: "https://web.archive.org/cdx/search/cdx",
+			SplitMonths: SplitMonthsConfig{
+				MinCaptures: 10000,
+				Concurrency: 4,
+			},
+			Name: "wayback",
+		},
+		Canonicalize: CanonicalizeConfig{
+			StripFragment: true,
+			StripParams:   []string{"utm_*", "fbclid", "gclid"},
+			LowercaseHost: true,
+			DefaultPorts:  true,
+		},
+		Concurrency: 20,
+		AdaptiveConcurrency: AdaptiveConcurrencyConfig{
+			Min:           2,
+			TargetLatency: 10 * time.Second,
+		},
+		CDXAuthToken:   "xxxx-yyy-zzz-www-xxxxx",
+		MemoryBudgetMB: 256,
+		Logging: LoggingConfig{
+			Level:  "info",
+			Format: "text",
+		},
+		AccessLog: AccessLogConfig{
+			Path:       "access.log",
+			Format:     "json",
+			MaxSizeMB:  100,
+			MaxAgeDays: 30,
+			MaxBackups: 10,
+		},
+		Tracing: TracingConfig{
+			Endpoint:    "localhost:4318",
+			Insecure:    true,
+			ServiceName: "wayback-discover-diff",
+			SampleRatio: 1,
+		},
+		Profiling: ProfilingConfig{
+			Addr: "localhost:6060",
+		},
+		Sentry: SentryConfig{
+			Environment: "production",
+			SampleRate:  1,
+		},
+		Audit: AuditConfig{
+			Enabled:      true,
+			Retention:    30 * 24 * time.Hour,
+			MaxEntries:   100000,
+			TrimInterval: time.Hour,
+		},
+		Statsd: StatsdConfig{
+			Address: "localhost:8125",
+			Prefix:  "wayback-discover-diff",
+		},
+		Events: EventsConfig{
+			Channel:      "wayback-discover-diff:jobs",
+			StreamMaxLen: 10000,
+		},
+		Ingest: IngestConfig{
+			URL:     "nats://localhost:4222",
+			Subject: "wayback-discover-diff.calculate",
+			Queue:   "wayback-discover-diff",
+		},
+		Shutdown: ShutdownConfig{
+			Timeout: 30 * time.Second,
+		},
+		Leader: LeaderConfig{
+			Key: "wayback-discover-diff:leader",
+			TTL: 15 * time.Second,
+		},
+		Cluster: ClusterConfig{
+			HeartbeatInterval: 5 * time.Second,
+		},
+		Workers: WorkersConfig{
+			Min:           4,
+			Max:           200,
+			Interval:      5 * time.Second,
+			TargetCPU:     0.8,
+			MaxHeapMB:     1024,
+			TargetLatency: 5 * time.Second,
+		},
+	}
+}
+
+// redacted is the placeholder of secrets in Redacted.
+const redacted = "REDACTED"
+
+// Redacted returns a copy of cfg with its secrets masked, suitable for
+// display.
+func (cfg *Config) Redacted() *Config {
+	c := *cfg
+	if u, err := url.Parse(c.Redis.URL); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+			c.Redis.URL = u.String()
+		}
+	}
+	if c.Sentry.DSN != "" {
+		c.Sentry.DSN = redacted
+	}
+	if c.Admin.Token != "" {
+		c.Admin.Token = redacted
+	}
+	return &c
+}
+
+// Load reads the configuration at path on top of the defaults. A missing
+// file yields the defaults.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot read config %s, %w", path, err)
+	}
+
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("cannot parse config %s, %w", path, err)
+	}
+	return cfg, nil
+}
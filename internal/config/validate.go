@@ -0,0 +1,253 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/pkg/simhash"
+)
+
+// ValidationError lists every problem found in a configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate checks the whole configuration and returns a *ValidationError
+// listing every problem, or nil.
+func (cfg *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+	hostPort := func(addr string) bool {
+		_, _, err := net.SplitHostPort(addr)
+		return err == nil
+	}
+	urlWithScheme := func(raw string, schemes ...string) bool {
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			return false
+		}
+		for _, s := range schemes {
+			if u.Scheme == s {
+				return true
+			}
+		}
+		return false
+	}
+
+	check(cfg.Server.Addr != "" || cfg.Server.UnixSocket.Path != "", "server.addr or server.unix_socket.path is required")
+	check(cfg.Server.Addr == "" || hostPort(cfg.Server.Addr), "server.addr %q must be host:port, e.g. :8080", cfg.Server.Addr)
+	if mode := cfg.Server.UnixSocket.Mode; cfg.Server.UnixSocket.Path != "" && mode != "" {
+		perm, err := strconv.ParseUint(mode, 8, 32)
+		check(err == nil && perm <= 0777, "server.unix_socket.mode %q must be octal permissions, e.g. 0660", mode)
+	}
+	check(cfg.Server.ReadHeaderTimeout > 0, "server.read_header_timeout must be positive, e.g. 10s")
+	check(cfg.Server.ReadTimeout >= 0 && cfg.Server.WriteTimeout >= 0 && cfg.Server.IdleTimeout >= 0,
+		"server.read_timeout, write_timeout and idle_timeout must not be negative")
+	check(cfg.Server.MaxHeaderBytes >= 0, "server.max_header_bytes must not be negative")
+	for _, proxy := range cfg.Server.TrustedProxies {
+		_, err := ParsePrefix(proxy)
+		check(err == nil, "server.trusted_proxies %q must be a CIDR or an IP address", proxy)
+	}
+	check(cfg.Server.HTTP2.MaxConcurrentStreams >= 0, "server.http2.max_concurrent_streams must not be negative")
+	if tls := cfg.Server.TLS; tls.Autocert.Enabled {
+		check(tls.CertFile == "", "server.tls.cert_file and server.tls.autocert are exclusive")
+		check(len(tls.Autocert.Domains) > 0, "server.tls.autocert.domains is required when autocert is enabled")
+		check(tls.Autocert.CacheDir != "", "server.tls.autocert.cache_dir is required when autocert is enabled")
+		check(hostPort(tls.Autocert.HTTPAddr), "server.tls.autocert.http_addr %q must be host:port, e.g. :80", tls.Autocert.HTTPAddr)
+	} else if tls.CertFile != "" || tls.KeyFile != "" {
+		check(tls.CertFile != "" && tls.KeyFile != "", "server.tls.cert_file and server.tls.key_file must be set together")
+		for _, path := range []string{tls.CertFile, tls.KeyFile} {
+			_, err := os.Stat(path)
+			check(path == "" || err == nil, "server.tls: %v", err)
+		}
+	}
+	if cfg.CORS.Enabled {
+		check(len(cfg.CORS.AllowedOrigins) > 0, "cors.allowed_origins is required when CORS is enabled")
+		for _, origin := range cfg.CORS.AllowedOrigins {
+			check(origin == "*" || urlWithScheme(origin, "http", "https"), "cors.allowed_origins %q must be an http(s) origin or *", origin)
+		}
+		check(cfg.CORS.MaxAge >= 0, "cors.max_age must not be negative")
+	}
+	check(cfg.APIKeys.DefaultQuota.Valid(), "api_keys.default_quota limits must not be negative")
+	names := map[string]bool{}
+	for i, k := range cfg.APIKeys.Keys {
+		check(k.Name != "" && !names[k.Name], "api_keys.keys[%d].name must be set and unique", i)
+		check(len(k.Key) >= 16, "api_keys.keys[%d].key must be at least 16 characters", i)
+		if k.Quota != nil {
+			check(k.Quota.Valid(), "api_keys.keys[%d].quota limits must not be negative", i)
+		}
+		names[k.Name] = true
+	}
+	for name, rate := range map[string]RateConfig{"per_ip": cfg.RateLimit.PerIP, "per_key": cfg.RateLimit.PerKey} {
+		check(rate.Rate >= 0, "rate_limit.%s.rate must not be negative", name)
+		check(rate.Rate == 0 || rate.Burst >= 1, "rate_limit.%s.burst must be at least 1", name)
+	}
+	for name, list := range map[string]IPListConfig{"calculations": cfg.IPFilter.Calculations, "reads": cfg.IPFilter.Reads, "admin": cfg.IPFilter.Admin} {
+		for _, cidr := range append(list.Allow, list.Deny...) {
+			_, err := ParsePrefix(cidr)
+			check(err == nil, "ip_filter.%s %q must be a CIDR or an IP address", name, cidr)
+		}
+	}
+	check(urlWithScheme(cfg.Redis.URL, "redis", "rediss") || strings.HasPrefix(cfg.Redis.URL, "unix:///"),
+		"redis.url %q must be a redis://, rediss:// or unix:// URL", cfg.Redis.URL)
+	check(simhash.ValidSize(cfg.Simhash.Size), "simhash.size %d must be one of 64, 128, 256, 512", cfg.Simhash.Size)
+	check(cfg.Simhash.ExpireAfter > 0, "simhash.expire_after must be positive, e.g. 24h")
+	check(cfg.Snapshots.NumberPerYear == -1 || cfg.Snapshots.NumberPerYear > 0,
+		"snapshots.number_per_year %d must be positive or -1 for every capture", cfg.Snapshots.NumberPerYear)
+	check(cfg.Snapshots.NumberPerPage > 0, "snapshots.number_per_page %d must be positive", cfg.Snapshots.NumberPerPage)
+	check(urlWithScheme(cfg.Archive.TimemapURL, "https", "http"), "archive.timemap_url %q must be an http(s) URL", cfg.Archive.TimemapURL)
+	check(urlWithScheme(cfg.Archive.ReplayURL, "https", "http") && strings.Contains(cfg.Archive.ReplayURL, "{timestamp}") && strings.Contains(cfg.Archive.ReplayURL, "{url}"),
+		"archive.replay_url %q must be an http(s) URL with {timestamp} and {url}", cfg.Archive.ReplayURL)
+	check(urlWithScheme(cfg.Archive.ArchiveItURL, "https", "http"), "archive.archive_it_url %q must be an http(s) URL", cfg.Archive.ArchiveItURL)
+	check(cfg.Archive.CDXFallbackURL == "" || urlWithScheme(cfg.Archive.CDXFallbackURL, "https", "http"), "archive.cdx_fallback_url %q must be an http(s) URL", cfg.Archive.CDXFallbackURL)
+	if cfg.Archive.SplitMonths.Enabled {
+		check(cfg.Archive.SplitMonths.MinCaptures > 0, "archive.split_months.min_captures %d must be positive", cfg.Archive.SplitMonths.MinCaptures)
+		check(cfg.Archive.SplitMonths.Concurrency > 0, "archive.split_months.concurrency %d must be positive", cfg.Archive.SplitMonths.Concurrency)
+	}
+	for _, pattern := range cfg.Canonicalize.StripParams {
+		_, err := path.Match(pattern, "")
+		check(pattern != "" && err == nil, "canonicalize.strip_params %q must be a param name or glob, e.g. utm_*", pattern)
+	}
+	sourceNames := map[string]bool{cfg.Archive.Name: true}
+	check(cfg.Archive.Name != "" || len(cfg.Archive.Sources) == 0, "archive.name must be set with archive.sources")
+	for i, source := range cfg.Archive.Sources {
+		check(source.Name != "" && !sourceNames[source.Name], "archive.sources[%d].name %q must be set and unique", i, source.Name)
+		sourceNames[source.Name] = true
+		check(urlWithScheme(source.TimemapURL, "https", "http"), "archive.sources[%d].timemap_url %q must be an http(s) URL", i, source.TimemapURL)
+		check(urlWithScheme(source.ReplayURL, "https", "http") && strings.Contains(source.ReplayURL, "{timestamp}") && strings.Contains(source.ReplayURL, "{url}"),
+			"archive.sources[%d].replay_url %q must be an http(s) URL with {timestamp} and {url}", i, source.ReplayURL)
+	}
+	check(cfg.Concurrency > 0, "concurrency %d must be positive", cfg.Concurrency)
+	if cfg.AdaptiveConcurrency.Enabled {
+		check(cfg.AdaptiveConcurrency.Min > 0, "adaptive_concurrency.min %d must be positive", cfg.AdaptiveConcurrency.Min)
+		check(cfg.AdaptiveConcurrency.TargetLatency > 0, "adaptive_concurrency.target_latency must be positive, e.g. 10s")
+	}
+	check(cfg.MemoryBudgetMB >= 0, "memory_budget_mb %d must not be negative", cfg.MemoryBudgetMB)
+
+	check(cfg.Logging.Level == "" || validLevel(cfg.Logging.Level),
+		"logging.level %q must be one of debug, info, warn, error", cfg.Logging.Level)
+	check(validFormat(cfg.Logging.Format), "logging.format %q must be text or json", cfg.Logging.Format)
+	if cfg.AccessLog.Enabled {
+		check(cfg.AccessLog.Path != "", "access_log.path is required when the access log is enabled")
+		check(validFormat(cfg.AccessLog.Format), "access_log.format %q must be text or json", cfg.AccessLog.Format)
+		check(cfg.AccessLog.MaxSizeMB >= 0, "access_log.max_size_mb must not be negative")
+		check(cfg.AccessLog.RotateInterval >= 0, "access_log.rotate_interval must not be negative")
+	}
+	if cfg.Tracing.Enabled {
+		check(hostPort(cfg.Tracing.Endpoint), "tracing.endpoint %q must be host:port", cfg.Tracing.Endpoint)
+		check(cfg.Tracing.SampleRatio >= 0 && cfg.Tracing.SampleRatio <= 1, "tracing.sample_ratio %v must be between 0 and 1", cfg.Tracing.SampleRatio)
+	}
+	if cfg.Profiling.Enabled {
+		check(hostPort(cfg.Profiling.Addr), "profiling.addr %q must be host:port", cfg.Profiling.Addr)
+	}
+	if cfg.Sentry.DSN != "" {
+		check(urlWithScheme(cfg.Sentry.DSN, "http", "https"), "sentry.dsn must be an http(s) URL")
+		check(cfg.Sentry.SampleRate >= 0 && cfg.Sentry.SampleRate <= 1, "sentry.sample_rate %v must be between 0 and 1", cfg.Sentry.SampleRate)
+	}
+	if cfg.Audit.Enabled {
+		check(cfg.Audit.Retention >= 0, "audit.retention must not be negative")
+		check(cfg.Audit.MaxEntries >= 0, "audit.max_entries must not be negative")
+		check(cfg.Audit.TrimInterval >= 0, "audit.trim_interval must not be negative")
+	}
+	if cfg.Statsd.Enabled {
+		check(hostPort(cfg.Statsd.Address), "statsd.address %q must be host:port", cfg.Statsd.Address)
+	}
+	if cfg.Events.Enabled {
+		check(cfg.Events.Channel != "" || cfg.Events.Stream != "", "events.channel or events.stream is required when events are enabled")
+	}
+	if cfg.Ingest.Enabled {
+		check(urlWithScheme(cfg.Ingest.URL, "nats", "tls"), "ingest.url %q must be a nats:// URL", cfg.Ingest.URL)
+		check(cfg.Ingest.Subject != "", "ingest.subject is required when ingestion is enabled")
+	}
+	check(cfg.Shutdown.Timeout > 0, "shutdown.timeout must be positive, e.g. 30s")
+	if cfg.Leader.Enabled {
+		check(cfg.Leader.Key != "", "leader.key is required when leader election is enabled")
+		check(cfg.Leader.TTL >= time.Second, "leader.ttl must be at least 1s")
+	}
+	if cfg.Cluster.Enabled {
+		check(urlWithScheme(cfg.Cluster.AdvertiseURL, "http", "https"), "cluster.advertise_url %q must be an http(s) URL", cfg.Cluster.AdvertiseURL)
+		check(cfg.Cluster.HeartbeatInterval > 0, "cluster.heartbeat_interval must be positive, e.g. 5s")
+		check(cfg.Cluster.Secret != "", "cluster.secret is required, shared by every instance")
+	}
+	if cfg.Workers.Adaptive {
+		check(cfg.Workers.Min > 0 && cfg.Workers.Min <= cfg.Workers.Max,
+			"workers.min %d must be positive and at most workers.max %d", cfg.Workers.Min, cfg.Workers.Max)
+		check(cfg.Workers.Interval > 0, "workers.interval must be positive, e.g. 5s")
+		check(cfg.Workers.TargetCPU > 0 && cfg.Workers.TargetCPU <= 1, "workers.target_cpu %v must be between 0 and 1", cfg.Workers.TargetCPU)
+		check(cfg.Workers.MaxHeapMB > 0, "workers.max_heap_mb must be positive")
+		check(cfg.Workers.TargetLatency > 0, "workers.target_latency must be positive, e.g. 5s")
+	}
+	if cfg.SPN.Enabled {
+		check(cfg.SPN.AccessKey != "" && cfg.SPN.SecretKey != "", "spn.access_key and spn.secret_key are required when save page now is enabled")
+		check(urlWithScheme(cfg.SPN.URL, "http", "https"), "spn.url %q must be an http(s) URL", cfg.SPN.URL)
+		check(cfg.SPN.PollInterval > 0, "spn.poll_interval must be positive, e.g. 5s")
+		check(cfg.SPN.Timeout > 0, "spn.timeout must be positive, e.g. 5m")
+	}
+	if cfg.Artifacts.Enabled {
+		check(cfg.Artifacts.Bucket != "", "artifacts.bucket is required when artifacts are enabled")
+		check(cfg.Artifacts.Region != "", "artifacts.region is required when artifacts are enabled")
+		if cfg.Artifacts.Endpoint != "" {
+			check(urlWithScheme(cfg.Artifacts.Endpoint, "http", "https"), "artifacts.endpoint %q must be an http(s) URL", cfg.Artifacts.Endpoint)
+		}
+		check(len(cfg.Artifacts.Formats) > 0, "artifacts.formats must list ndjson, csv or parquet")
+		for _, format := range cfg.Artifacts.Formats {
+			check(format == "ndjson" || format == "csv" || format == "parquet", "artifacts.formats %q must be ndjson, csv or parquet", format)
+		}
+		check(cfg.Artifacts.Timeout > 0, "artifacts.timeout must be positive, e.g. 1m")
+	}
+	if cfg.Notify.Slack.Enabled || cfg.Notify.Email.Enabled {
+		_, err := template.New("notify").Parse(cfg.Notify.Template)
+		check(err == nil, "notify.template is not a valid template, %v", err)
+		check(cfg.Notify.MinDuration >= 0, "notify.min_duration must not be negative")
+	}
+	if cfg.Notify.Slack.Enabled {
+		check(urlWithScheme(cfg.Notify.Slack.WebhookURL, "https", "http"), "notify.slack.webhook_url %q must be an http(s) URL", cfg.Notify.Slack.WebhookURL)
+	}
+	if cfg.Notify.Email.Enabled {
+		check(hostPort(cfg.Notify.Email.Addr), "notify.email.addr %q must be host:port, e.g. smtp.example.com:587", cfg.Notify.Email.Addr)
+		check(cfg.Notify.Email.From != "", "notify.email.from is required when email notifications are enabled")
+		check(len(cfg.Notify.Email.To) > 0, "notify.email.to must list at least one address")
+	}
+	if cfg.Backup.Enabled {
+		check(cfg.Backup.Dir != "", "backup.dir is required when backups are enabled")
+		check(cfg.Backup.Interval >= time.Minute, "backup.interval must be at least 1m")
+		check(cfg.Backup.Keep >= 1, "backup.keep must be at least 1")
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// Valid reports whether the limits of q are not negative.
+func (q Quota) Valid() bool {
+	return q.JobsPerDay >= 0 && q.CapturesPerJob >= 0 && q.ConcurrentJobs >= 0
+}
+
+func validLevel(level string) bool {
+	switch strings.ToLower(level) {
+	case "debug", "info", "warn", "error":
+		return true
+	}
+	return false
+}
+
+func validFormat(format string) bool {
+	return format == "" || format == "text" || format == "json"
+}
@@ -0,0 +1,79 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// Event types.
+const (
+	JOB_STARTED   = "job.started"
+	JOB_PROGRESS  = "job.progress"
+	JOB_PARTIAL   = "job.partial"
+	JOB_COMPLETED = "job.completed"
+	JOB_FAILED    = "job.failed"
+)
+
+// Event is a job lifecycle event.
+type Event struct {
+	Type      string    `json:"type"`
+	Time      time.Time `json:"time"`
+	JobID     string    `json:"job_id"`
+	RequestID string    `json:"request_id,omitempty"`
+	URL       string    `json:"url"`
+	Year      string    `json:"year"`
+	Processed int64     `json:"processed,omitempty"`
+	Total     int       `json:"total,omitempty"`
+	Info      string    `json:"info,omitempty"`
+}
+
+// Publisher publishes job events to a Redis channel and, when configured, a
+// Redis stream. A nil Publisher drops every event.
+type Publisher struct {
+	redisClient *redis.Client
+	cfg         config.EventsConfig
+}
+
+// NewPublisher returns a publisher for cfg, or nil when events are disabled.
+func NewPublisher(redisClient *redis.Client, cfg config.EventsConfig) *Publisher {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &Publisher{redisClient: redisClient, cfg: cfg}
+}
+
+// Publish sends e to the channel and the stream.
+func (p *Publisher) Publish(ctx context.Context, e Event) error {
+	if p == nil {
+		return nil
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	pipe := p.redisClient.Pipeline()
+	if p.cfg.Channel != "" {
+		pipe.Publish(ctx, p.cfg.Channel, data)
+	}
+	if p.cfg.Stream != "" {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: p.cfg.Stream,
+			MaxLen: p.cfg.StreamMaxLen,
+			Approx: true,
+			Values: map[string]any{"type": e.Type, "job_id": e.JobID, "event": data},
+		})
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("cannot publish %s event of job %s, %w", e.Type, e.JobID, err)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"embed"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/buildinfo"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/job"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/lsh"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/metrics"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// RECENT_FAILURES is the number of failure log lines shown on the dashboard.
+const RECENT_FAILURES = 50
+
+//go:embed templates/dashboard.html
+var templates embed.FS
+
+var dashboardTemplate = template.Must(template.ParseFS(templates, "templates/dashboard.html"))
+
+// redisInfoFields are the fields of Redis INFO shown on the dashboard.
+var redisInfoFields = []string{"redis_version", "uptime_in_seconds", "connected_clients", "used_memory_human", "maxmemory_human", "evicted_keys", "keyspace_hits", "keyspace_misses"}
+
+// AdminAuth rejects requests without the admin token, sent as a bearer token
+// or, for browsers, as the password of HTTP basic auth. Every request is
+// rejected when token is empty.
+func AdminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		given, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok {
+			_, given, ok = c.Request.BasicAuth()
+		}
+		if token == "" || !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			c.Header("WWW-Authenticate", `Basic realm="admin"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "error", "info": "admin token is required."})
+			return
+		}
+		c.Next()
+	}
+}
+
+type dashboardJob struct {
+	ID, URL, Year, State, Info string
+	Started                    time.Time
+	Duration                   time.Duration
+}
+
+type dashboardFailure struct {
+	JobID string
+	job.LogEntry
+}
+
+type redisInfoField struct {
+	Name, Value string
+}
+
+// Dashboard renders an HTML page with the jobs, queue depth, recent
+// failures, Redis stats and configuration of the instance.
+func (h *Handler) Dashboard(c *gin.Context) {
+	h.mu.RLock()
+	jobs := make([]dashboardJob, 0, len(h.jobsMap))
+	var failures []dashboardFailure
+	for _, j := range h.jobsMap {
+		jobs = append(jobs, dashboardJob{ID: j.ID, URL: j.URL, Year: j.Year, State: string(j.State()), Info: j.Info(), Started: j.StartTime(), Duration: j.Duration().Round(time.Millisecond)})
+		for _, entry := range j.Logs() {
+			if entry.Level == "WARN" || entry.Level == "ERROR" {
+				failures = append(failures, dashboardFailure{JobID: j.ID, LogEntry: entry})
+			}
+		}
+	}
+	h.mu.RUnlock()
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].Started.After(jobs[b].Started) })
+	sort.Slice(failures, func(a, b int) bool { return failures[a].Time.After(failures[b].Time) })
+	failures = failures[:min(len(failures), RECENT_FAILURES)]
+
+	ctx := c.Request.Context()
+	redisStatus := h.checkRedis(ctx)
+	var redisInfo []redisInfoField
+	var redisKeys int64
+	if redisStatus.Status == "ok" {
+		redisKeys, _ = h.redisClient.DBSize(ctx).Result()
+		info, _ := h.redisClient.Info(ctx).Result()
+		redisInfo = parseRedisInfo(info)
+	}
+
+	cfg, err := yaml.Marshal(h.cfg.Redacted())
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	err = dashboardTemplate.Execute(c.Writer, gin.H{
+		"Version":         buildinfo.Version,
+		"Now":             time.Now(),
+		"RunningJobs":     job.RunningJobs(),
+		"MaxRunningJobs":  MAX_RUNNING_JOBS,
+		"ActiveDownloads": job.ActiveDownloads(),
+		"Jobs":            jobs,
+		"Failures":        failures,
+		"Redis":           redisStatus,
+		"RedisKeys":       redisKeys,
+		"RedisInfo":       redisInfo,
+		"Counters":        metrics.Snapshot(),
+		"Config":          string(cfg),
+	})
+	if err != nil {
+		c.Error(err)
+	}
+}
+
+// parseRedisInfo picks redisInfoFields out of the output of Redis INFO.
+func parseRedisInfo(info string) []redisInfoField {
+	values := make(map[string]string)
+	for _, line := range strings.Split(info, "\r\n") {
+		if name, value, ok := strings.Cut(line, ":"); ok {
+			values[name] = value
+		}
+	}
+	fields := make([]redisInfoField, 0, len(redisInfoFields))
+	for _, name := range redisInfoFields {
+		if value, ok := values[name]; ok {
+			fields = append(fields, redisInfoField{Name: name, Value: value})
+		}
+	}
+	return fields
+}
+
+// DeleteSimhashes removes the stored simhashes of a URL, or only those of a
+// year, along with their LSH index entries.
+func (h *Handler) DeleteSimhashes(c *gin.Context) {
+	url := urlParam(c)
+	if url == "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"status": "error", "info": "url param is required."})
+		return
+	}
+	year := c.Query("year")
+
+	stored, err := utils.AllSimhashes(h.redisClient, url)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	var timestamps []string
+	if year != "" {
+		timestamps = []string{}
+		for ts := range stored {
+			if strings.HasPrefix(ts, year) {
+				timestamps = append(timestamps, ts)
+			} else {
+				delete(stored, ts)
+			}
+		}
+	}
+
+	if err := lsh.Remove(c.Request.Context(), h.redisClient, url, stored); err != nil {
+		internalError(c, err)
+		return
+	}
+	if err := utils.DeleteSimhashes(h.redisClient, url, timestamps); err != nil {
+		internalError(c, err)
+		return
+	}
+	slog.InfoContext(c.Request.Context(), "simhashes deleted", "url", url, "year", year, "captures", len(stored))
+	c.IndentedJSON(http.StatusOK, gin.H{"status": "ok", "url": url, "year": year, "deleted": len(stored)})
+}
+
+// FlushCaches empties the in-memory digest cache and BK-tree cache.
+func (h *Handler) FlushCaches(c *gin.Context) {
+	digests := job.FlushDigestCache()
+	trees := h.trees.Clear()
+	slog.InfoContext(c.Request.Context(), "caches flushed", "digests", digests, "trees", trees)
+	c.IndentedJSON(http.StatusOK, gin.H{"status": "ok", "digests": digests, "trees": trees})
+}
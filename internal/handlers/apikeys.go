@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/apikeys"
+
+	"github.com/gin-gonic/gin"
+)
+
+// API_KEY_HEADER carries the API key of a request, which can also be passed
+// as the api_key query param.
+const API_KEY_HEADER = "X-API-Key"
+
+// apiKeyContextKey holds the API key of a request in the gin context.
+const apiKeyContextKey = "api_key"
+
+// APIKeyAuth rejects requests without an enabled API key and records the
+// key for quotas and the audit log. Requests forwarded by another instance
+// of the cluster were authenticated there and pass without a key.
+func (h *Handler) APIKeyAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if h.fromCluster(c) {
+			c.Next()
+			return
+		}
+		secret := c.GetHeader(API_KEY_HEADER)
+		if secret == "" {
+			secret = c.Query("api_key")
+		}
+		if secret == "" {
+			c.Abort()
+			respond(c, http.StatusUnauthorized, gin.H{"status": "error", "info": "api key is required."})
+			return
+		}
+
+		key, ok, err := h.apiKeys.Lookup(c.Request.Context(), secret)
+		if err != nil {
+			internalError(c, err)
+			c.Abort()
+			return
+		} else if !ok {
+			c.Abort()
+			respond(c, http.StatusUnauthorized, gin.H{"status": "error", "info": "invalid api key."})
+			return
+		} else if key.Disabled {
+			c.Abort()
+			respond(c, http.StatusForbidden, gin.H{"status": "error", "info": "api key is disabled."})
+			return
+		}
+		c.Set(apiKeyContextKey, key)
+		c.Next()
+	}
+}
+
+// ListAPIKeys lists the API keys, without their secrets.
+func (h *Handler) ListAPIKeys(c *gin.Context) {
+	keys, err := h.apiKeys.List(c.Request.Context())
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	respond(c, http.StatusOK, gin.H{"keys": keys, "count": len(keys)})
+}
+
+// CreateAPIKey creates an API key, with the quota given in the params or the
+// default quota, and returns its secret, which is only shown once.
+func (h *Handler) CreateAPIKey(c *gin.Context) {
+	name := c.Query("name")
+	if name == "" {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "name param is required."})
+		return
+	}
+	quota, err := parseQuota(c)
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": err.Error()})
+		return
+	}
+	secret, err := h.apiKeys.Create(c.Request.Context(), name, quota)
+	if err != nil {
+		respond(c, http.StatusConflict, gin.H{"status": "error", "info": err.Error()})
+		return
+	}
+	slog.InfoContext(c.Request.Context(), "api key created", "name", name)
+	respond(c, http.StatusCreated, gin.H{"status": "ok", "name": name, "key": secret})
+}
+
+// EnableAPIKey enables the API key named in the path.
+func (h *Handler) EnableAPIKey(c *gin.Context) {
+	h.setAPIKeyDisabled(c, false)
+}
+
+// DisableAPIKey disables the API key named in the path, its requests are
+// rejected with 403 until it is enabled again.
+func (h *Handler) DisableAPIKey(c *gin.Context) {
+	h.setAPIKeyDisabled(c, true)
+}
+
+func (h *Handler) setAPIKeyDisabled(c *gin.Context, disabled bool) {
+	name := c.Param("name")
+	if err := h.apiKeys.SetDisabled(c.Request.Context(), name, disabled); err != nil {
+		apiKeyError(c, err)
+		return
+	}
+	slog.InfoContext(c.Request.Context(), "api key updated", "name", name, "disabled", disabled)
+	respond(c, http.StatusOK, gin.H{"status": "ok", "name": name, "disabled": disabled})
+}
+
+// DeleteAPIKey deletes the API key named in the path.
+func (h *Handler) DeleteAPIKey(c *gin.Context) {
+	name := c.Param("name")
+	if err := h.apiKeys.Delete(c.Request.Context(), name); err != nil {
+		apiKeyError(c, err)
+		return
+	}
+	slog.InfoContext(c.Request.Context(), "api key deleted", "name", name)
+	respond(c, http.StatusOK, gin.H{"status": "ok", "name": name})
+}
+
+func apiKeyError(c *gin.Context, err error) {
+	if errors.Is(err, apikeys.ErrNotFound) {
+		respond(c, http.StatusNotFound, gin.H{"status": "error", "info": err.Error()})
+		return
+	}
+	respond(c, http.StatusConflict, gin.H{"status": "error", "info": err.Error()})
+}
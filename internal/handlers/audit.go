@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/audit"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordAudit stores who requested the calculation of url and year. Failures
+// are logged and do not fail the request.
+func (h *Handler) recordAudit(c *gin.Context, url, year, jobID, status string) {
+	key, _ := requestAPIKey(c)
+	h.writeAudit(c.Request.Context(), audit.Entry{
+		ClientIP:  c.ClientIP(),
+		APIKey:    key.Name,
+		UserAgent: c.Request.UserAgent(),
+		URL:       url,
+		Year:      year,
+		JobID:     jobID,
+		Status:    status,
+	})
+}
+
+// TrimAudit enforces the retention limits of the audit log. It runs as a
+// cluster-wide background task so the limits also apply when nothing is
+// recorded.
+func (h *Handler) TrimAudit(ctx context.Context) error {
+	if h.audit == nil {
+		return nil
+	}
+	dropped, err := h.audit.Trim(ctx)
+	if dropped > 0 {
+		slog.Info("trimmed audit log", "dropped", dropped)
+	}
+	return err
+}
+
+// writeAudit stamps e with the current time and the request ID of ctx and
+// stores it.
+func (h *Handler) writeAudit(ctx context.Context, e audit.Entry) {
+	if h.audit == nil {
+		return
+	}
+	e.Time = time.Now().UTC()
+	e.RequestID = logging.RequestID(ctx)
+	if err := h.audit.Record(ctx, e); err != nil {
+		slog.WarnContext(ctx, "cannot record audit entry", "url", e.URL, "year", e.Year, "error", err)
+	}
+}
+
+// GetAudit lists the audit entries of calculation requests, newest first,
+// optionally filtered by url, client ip and a since/until RFC 3339 time range.
+func (h *Handler) GetAudit(c *gin.Context) {
+	if h.audit == nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"status": "error", "info": "audit log is disabled."})
+		return
+	}
+
+	filter := audit.Filter{URL: c.Query("url"), ClientIP: c.Query("ip"), APIKey: c.Query("api_key"), Limit: 100}
+	for param, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"status": "error", "info": param + " must be an RFC 3339 time."})
+			return
+		}
+		*t = parsed
+	}
+	if limitStr := c.Query("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"status": "error", "info": "limit must be a positive integer."})
+			return
+		}
+		filter.Limit = limit
+	}
+
+	entries, err := h.audit.Query(c.Request.Context(), filter)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"entries": entries, "count": len(entries)})
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/config"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/job"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cachePolicyKey holds the Cache-Control policy chosen by a handler for its
+// response in the gin context, overriding the policy of the endpoint.
+const cachePolicyKey = "cache_policy"
+
+// CacheControl sets the Cache-Control and Expires headers of successful
+// responses to the policy of their endpoint, or to the one chosen by the
+// handler, so CDNs and browsers can serve repeat reads. Other responses are
+// marked no-store so errors and pending results are never cached.
+func CacheControl(cfg config.CacheControlConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer = &cacheWriter{ResponseWriter: c.Writer, c: c, policy: cfg.Endpoints[c.FullPath()]}
+		c.Next()
+	}
+}
+
+// cacheWriter sets the caching headers when the status of the response is
+// written.
+type cacheWriter struct {
+	gin.ResponseWriter
+	c      *gin.Context
+	policy string
+}
+
+func (w *cacheWriter) WriteHeader(code int) {
+	policy := "no-store"
+	if code == http.StatusOK || code == http.StatusNotModified {
+		policy = w.policy
+		if chosen := w.c.GetString(cachePolicyKey); chosen != "" {
+			policy = chosen
+		}
+	}
+	if header := w.Header(); policy != "" && header.Get("Cache-Control") == "" {
+		header.Set("Cache-Control", policy)
+		if maxAge, ok := maxAge(policy); ok {
+			header.Set("Expires", time.Now().Add(maxAge).UTC().Format(http.TimeFormat))
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// maxAge returns the max-age directive of policy, for the Expires header of
+// HTTP/1.0 caches.
+func maxAge(policy string) (time.Duration, bool) {
+	for _, directive := range strings.Split(policy, ",") {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(directive), "max-age="); ok {
+			seconds, err := strconv.Atoi(value)
+			return time.Duration(seconds) * time.Second, err == nil
+		}
+	}
+	return 0, false
+}
+
+// cacheSimhashes chooses the caching policy of the SimHashes of year: none
+// while a job calculates them, short for the current year, which still
+// gains captures, and long for past years.
+func (h *Handler) cacheSimhashes(c *gin.Context, year string, j *job.Job) {
+	cfg := h.cfg.CacheControl.Simhash
+	switch {
+	case j != nil && j.State().Running():
+		c.Set(cachePolicyKey, cfg.InProgress)
+	case year >= strconv.Itoa(time.Now().UTC().Year()):
+		c.Set(cachePolicyKey, cfg.Current)
+	default:
+		c.Set(cachePolicyKey, cfg.Historical)
+	}
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/cluster"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/logging"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ROUTED_PARAM marks a request redirected to the owner of its URL, which
+// handles it even when its view of the cluster disagrees, so redirects
+// cannot loop while instances join or leave. Its value is signed with the
+// cluster secret, see routedToken.
+const ROUTED_PARAM = "routed"
+
+// CLUSTER_SECRET_HEADER carries the cluster secret of the requests an
+// instance forwards to another, which skip API key authentication.
+const CLUSTER_SECRET_HEADER = "X-Cluster-Secret"
+
+// routedToken returns the value of ROUTED_PARAM for requests to path about
+// key, a URL or a job ID, so that clients cannot set it on other requests.
+func (h *Handler) routedToken(path, key string) string {
+	mac := hmac.New(sha256.New, []byte(h.cfg.Cluster.Secret))
+	mac.Write([]byte(path + "\n" + key))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// routed returns whether the request was redirected about key by another
+// instance.
+func (h *Handler) routed(c *gin.Context, key string) bool {
+	token := c.Query(ROUTED_PARAM)
+	return token != "" && h.cfg.Cluster.Secret != "" && hmac.Equal([]byte(token), []byte(h.routedToken(c.Request.URL.Path, key)))
+}
+
+// fromCluster returns whether the request was forwarded by another instance
+// of the cluster.
+func (h *Handler) fromCluster(c *gin.Context) bool {
+	secret := c.GetHeader(CLUSTER_SECRET_HEADER)
+	return secret != "" && h.cfg.Cluster.Secret != "" && hmac.Equal([]byte(secret), []byte(h.cfg.Cluster.Secret))
+}
+
+// Cluster returns the cluster membership of the handler, nil when clustering
+// is disabled.
+func (h *Handler) Cluster() *cluster.Membership {
+	return h.cluster
+}
+
+// routeToOwner redirects the request to the instance owning url, so the
+// digest cache and feature hash cache of a URL stay warm on one instance. It
+// returns false when this instance should handle the request.
+func (h *Handler) routeToOwner(c *gin.Context, url string) bool {
+	if h.routed(c, url) || h.fromCluster(c) {
+		return false
+	}
+	owner, local := h.cluster.Owner(utils.Surt(url))
+	if local {
+		return false
+	}
+	query := c.Request.URL.Query()
+	query.Set(ROUTED_PARAM, h.routedToken(c.Request.URL.Path, url))
+	c.Redirect(http.StatusTemporaryRedirect, owner+c.Request.URL.Path+"?"+query.Encode())
+	return true
+}
+
+// redirectToJobOwner redirects a request about a job unknown to this
+// instance to the instance that started it. It returns false when the job
+// was not started by another instance.
+func (h *Handler) redirectToJobOwner(c *gin.Context, jobID string) bool {
+	if h.cluster == nil || h.routed(c, jobID) || h.fromCluster(c) {
+		return false
+	}
+	owner, err := h.redisClient.HGet(c.Request.Context(), utils.JobKey(jobID), "owner").Result()
+	if err != nil || owner == "" || owner == h.cluster.Self() {
+		return false
+	}
+	query := c.Request.URL.Query()
+	query.Set(ROUTED_PARAM, h.routedToken(c.Request.URL.Path, jobID))
+	c.Redirect(http.StatusTemporaryRedirect, owner+c.Request.URL.Path+"?"+query.Encode())
+	return true
+}
+
+// recordOwner records this instance as the owner of a job so that status
+// requests reaching other instances can be redirected to it.
+func (h *Handler) recordOwner(jobID, url, year string) {
+	if h.cluster == nil {
+		return
+	}
+	err := utils.SaveJob(h.redisClient, jobID, map[string]any{
+		"url":   url,
+		"year":  year,
+		"owner": h.cluster.Self(),
+	}, JOB_RECORD_TTL)
+	if err != nil {
+		slog.Warn("cannot record job owner", "job_id", jobID, "error", err)
+	}
+}
+
+// forward starts the calculation of url and year on owner through its
+// /calculate-simhash endpoint and returns the job ID. The request carries
+// the cluster secret, so the owner neither routes it again nor asks for an
+// API key.
+func (h *Handler) forward(ctx context.Context, owner, u, year string, simhashSize int, extractor string, override bool) (string, error) {
+	query := url.Values{
+		"url":          {u},
+		"year":         {year},
+		"simhash_size": {strconv.Itoa(simhashSize)},
+		"extractor":    {extractor},
+		"override":     {strconv.FormatBool(override)},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, owner+"/calculate-simhash?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set(CLUSTER_SECRET_HEADER, h.cfg.Cluster.Secret)
+	if id := logging.RequestID(ctx); id != "" {
+		req.Header.Set("X-Request-ID", id)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("cannot forward %s to %s, %w", u, owner, err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Status string `json:"status"`
+		JobID  string `json:"job_id"`
+		Info   string `json:"info"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("cannot forward %s to %s, %w", u, owner, err)
+	}
+	if body.JobID == "" {
+		return "", fmt.Errorf("%s refused %s, %s", owner, u, body.Info)
+	}
+	return body.JobID, nil
+}
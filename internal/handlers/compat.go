@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/job"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pythonCompatKey marks requests answered like the Python service in the gin
+// context.
+const pythonCompatKey = "python_compat"
+
+// PythonCompat answers requests like the original Python service, so this
+// service can replace it behind the Wayback Machine Changes UI. Handlers
+// shape their responses with pythonCompat, and respond writes them as Flask
+// does.
+func PythonCompat() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(pythonCompatKey, true)
+		c.Next()
+	}
+}
+
+// pythonCompat reports whether the response of c must match the Python
+// service.
+func pythonCompat(c *gin.Context) bool {
+	return c.GetBool(pythonCompatKey)
+}
+
+// flaskJSON renders JSON like Flask's jsonify: compact, with sorted keys,
+// without escaping HTML characters and with a trailing newline.
+type flaskJSON struct {
+	data any
+}
+
+func (r flaskJSON) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(r.data); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func (r flaskJSON) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+}
+
+// pythonCaptures lists captures as the [timestamp, simhash] pairs of the
+// Python service.
+func pythonCaptures(captures []utils.CaptureResult) [][]string {
+	pairs := make([][]string, len(captures))
+	for i, capture := range captures {
+		pairs[i] = []string{capture.Timestamp, capture.Simhash}
+	}
+	return pairs
+}
+
+// pythonYearStatus returns the status of the SimHashes of a year reported by
+// the Python service: PENDING while a job calculates them, COMPLETE
+// otherwise.
+func pythonYearStatus(j *job.Job) string {
+	if j != nil && j.State().Running() {
+		return "PENDING"
+	}
+	return "COMPLETE"
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/utils"
+	"github.com/Yaxhveer/wayback-discover-diff-go/pkg/simhash"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetDistance compares the simhash of one capture against one or more other
+// captures of the same URL and returns their hamming distances and similarities.
+// The simhashes are rendered with the encoding and format params.
+func (h *Handler) GetDistance(c *gin.Context) {
+	url := urlParam(c)
+	if url == "" {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "url param is required."})
+		return
+	}
+
+	timestamp := c.Query("timestamp")
+	if timestamp == "" {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "timestamp param is required."})
+		return
+	}
+	compare := c.Query("compare")
+	if compare == "" {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "compare param is required."})
+		return
+	}
+	others := strings.Split(compare, ",")
+	render, ok := hashRenderer(c)
+	if !ok {
+		return
+	}
+
+	simhashes, err := utils.SimhashesAt(h.redisClient, url, append([]string{timestamp}, others...))
+	if err != nil {
+		respond(c, http.StatusAccepted, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+	base, ok := simhashes[timestamp]
+	if !ok {
+		respond(c, http.StatusAccepted, gin.H{"status": "error", "message": "CAPTURE_NOT_FOUND"})
+		return
+	}
+	baseBytes, err := simhash.Decode(base, simhash.EncodingBase64)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+
+	distances := make([]gin.H, 0, len(others))
+	for _, ts := range others {
+		stored, ok := simhashes[ts]
+		if !ok {
+			distances = append(distances, gin.H{"timestamp": ts, "message": "CAPTURE_NOT_FOUND"})
+			continue
+		}
+		other, err := simhash.Decode(stored, simhash.EncodingBase64)
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+		distance, err := simhash.Hamming(baseBytes, other)
+		if err != nil {
+			distances = append(distances, gin.H{"timestamp": ts, "message": err.Error()})
+			continue
+		}
+		similarity, _ := simhash.Similarity(baseBytes, other)
+		rendered, err := render(stored)
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+		distances = append(distances, gin.H{"timestamp": ts, "simhash": rendered, "distance": distance, "similarity": similarity})
+	}
+	if base, err = render(base); err != nil {
+		internalError(c, err)
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"timestamp":    timestamp,
+		"simhash":      base,
+		"simhash_size": len(baseBytes) * 8,
+		"distances":    distances,
+	})
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// simhashETag returns the ETag of the simhashes of url and the job state
+// reported with them, or "" when nothing is stored for url yet. It is weak as
+// equal revisions may be rendered with captures in a different order.
+func (h *Handler) simhashETag(url, status string) (string, error) {
+	revision, err := utils.StoredRevision(h.redisClient, url)
+	if err != nil || revision == 0 {
+		return "", err
+	}
+	return fmt.Sprintf(`W/"%d-%s"`, revision, status), nil
+}
+
+// notModified sets the ETag header of the response and answers 304 when the
+// If-None-Match header of the request matches etag. It returns false when the
+// response must be written.
+func notModified(c *gin.Context, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	c.Header("ETag", etag)
+	for _, tag := range strings.Split(c.GetHeader("If-None-Match"), ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			c.Status(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FIELDS_KEY is the context key of the fields selected with the fields
+// param, see SelectFields.
+const FIELDS_KEY = "fields"
+
+// fieldName matches the names of the fields param.
+var fieldName = regexp.MustCompile(`^[a-z_]+$`)
+
+// SelectFields lets clients of the read endpoints select the fields of the
+// captures answered with the fields param, e.g. fields=timestamp for the
+// timestamps alone or fields=timestamp,simhash,distance. Names are case
+// insensitive. The captures are shaped by respond, see shapeFields.
+func SelectFields() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if param := c.Query("fields"); param != "" {
+			fields := make(map[string]bool)
+			for _, name := range strings.Split(param, ",") {
+				name = strings.ToLower(strings.TrimSpace(name))
+				if !fieldName.MatchString(name) {
+					invalidParam(c, "fields", param, "must list field names separated by commas, e.g. timestamp,simhash.")
+					return
+				}
+				fields[name] = true
+			}
+			c.Set(FIELDS_KEY, fields)
+		}
+		c.Next()
+	}
+}
+
+// shapeFields returns obj, the body of a successful response, with only the
+// selected fields of its captures: the objects with a timestamp in arrays
+// and the object of a captures key. Bodies that cannot be shaped are
+// returned as they are.
+func shapeFields(c *gin.Context, code int, obj any) any {
+	selected, ok := c.Get(FIELDS_KEY)
+	if !ok || code != http.StatusOK {
+		return obj
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return obj
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var body any
+	if err := dec.Decode(&body); err != nil {
+		return obj
+	}
+	return shape(body, selected.(map[string]bool), false)
+}
+
+// shape keeps the selected fields of v when it is a capture, and of the
+// captures nested in v otherwise.
+func shape(v any, fields map[string]bool, capture bool) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, x := range v {
+			if capture && !fields[strings.ToLower(k)] {
+				delete(v, k)
+				continue
+			}
+			v[k] = shape(x, fields, !capture && k == "captures")
+		}
+	case []any:
+		for i, x := range v {
+			v[i] = shape(x, fields, hasTimestamp(x))
+		}
+	case json.Number:
+		// Keep integers exact for the encodings other than JSON.
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return v
+}
+
+// hasTimestamp reports whether v is an object with a timestamp field.
+func hasTimestamp(v any) bool {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return false
+	}
+	for k := range m {
+		if strings.EqualFold(k, "timestamp") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/apikeys"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/job"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/utils"
+	"github.com/Yaxhveer/wayback-discover-diff-go/pkg/simhash"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MAX_GROUP_JOBS is the number of jobs a batch or multi-year submission may
+// start.
+const MAX_GROUP_JOBS = 1000
+
+// CalculateBatch starts a job group calculating each url and year of the
+// JSON body, {"jobs": [{"url": "...", "year": "..."}, ...]}. The simhash_size,
+// algo, extractor, override and collection params apply to every job.
+func (h *Handler) CalculateBatch(c *gin.Context) {
+	var body struct {
+		Jobs []job.Child `json:"jobs"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || len(body.Jobs) == 0 {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "jobs array is required."})
+		return
+	}
+	if len(body.Jobs) > MAX_GROUP_JOBS {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": fmt.Sprintf("at most %d jobs can be started at once.", MAX_GROUP_JOBS)})
+		return
+	}
+	for i, child := range body.Jobs {
+		if err := utils.CheckURL(child.URL); err != nil {
+			respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": fmt.Sprintf("jobs[%d] has an invalid url, %s.", i, err.Error())})
+			return
+		}
+		if !utils.YearIsValid(child.Year) {
+			respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": fmt.Sprintf("jobs[%d] must have a valid year.", i)})
+			return
+		}
+		body.Jobs[i].URL = utils.InCollection(child.URL, c.Query("collection"))
+	}
+	h.startGroup(c, "batch", body.Jobs)
+}
+
+// calculateYears starts a job group calculating url in each year of years, a
+// range such as 2018-2021 or a list such as 2018,2020.
+func (h *Handler) calculateYears(c *gin.Context, url, years string) {
+	list, err := parseYears(years)
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": err.Error()})
+		return
+	}
+	children := make([]job.Child, len(list))
+	for i, year := range list {
+		children[i] = job.Child{URL: url, Year: year}
+	}
+	h.startGroup(c, url, children)
+}
+
+// parseYears returns the years of a range such as 2018-2021 or a list such as
+// 2018,2020.
+func parseYears(years string) ([]string, error) {
+	invalid := fmt.Errorf("years must be a range such as 2018-2021 or a list such as 2018,2020 of years from %d to the current year.", utils.MIN_YEAR)
+	if from, to, ok := strings.Cut(years, "-"); ok {
+		if !utils.YearIsValid(from) || !utils.YearIsValid(to) || from > to {
+			return nil, invalid
+		}
+		first, _ := strconv.Atoi(from)
+		last, _ := strconv.Atoi(to)
+		list := make([]string, 0, last-first+1)
+		for year := first; year <= last; year++ {
+			list = append(list, strconv.Itoa(year))
+		}
+		return list, nil
+	}
+	list := strings.Split(years, ",")
+	if len(list) > MAX_GROUP_JOBS {
+		return nil, invalid
+	}
+	for _, year := range list {
+		if !utils.YearIsValid(year) {
+			return nil, invalid
+		}
+	}
+	return list, nil
+}
+
+// startGroup starts a job group calculating children with the params of the
+// request and answers its group_id.
+func (h *Handler) startGroup(c *gin.Context, name string, children []job.Child) {
+	simhashSize, extractor, ok := h.calculationParams(c)
+	if !ok {
+		return
+	}
+	override := c.Query("override") == "true" || c.Query("override") == "1"
+
+	opts := job.Options{SimhashSize: simhashSize, Extractor: extractor, Events: h.events, Notifier: h.notifier}
+	key := groupAPIKey(c, &opts)
+
+	j := job.NewJob()
+	jobID := j.RunGroup(c.Request.Context(), h.redisClient, name, children, opts, h.startChild(simhashSize, extractor, override, key))
+	h.registerGroup(c, j, name, "")
+
+	respond(c, http.StatusAccepted, gin.H{
+		"status":       "STARTED",
+		"job_id":       jobID,
+		"group_id":     jobID,
+		"jobs":         len(children),
+		"simhash_size": simhashSize,
+		"algo":         simhash.Algorithm(simhashSize),
+		"extractor":    extractor,
+	})
+}
+
+// groupAPIKey returns the API key of the request starting a group, nil
+// without API keys, and attributes the group to it in opts. The group itself
+// is not charged to the quota of the key, its children are.
+func groupAPIKey(c *gin.Context, opts *job.Options) *apikeys.Key {
+	key, ok := requestAPIKey(c)
+	if !ok {
+		return nil
+	}
+	opts.APIKey = key.Name
+	return &key
+}
+
+// startChild returns the function starting the child jobs of a group. Each
+// child gets the options of its own calculation, so a URL stored with another
+// algorithm or extractor fails to start unless override is set. With an API
+// key, each child is admitted against its quota like a job of its own, and
+// fails to start when the key runs too many jobs at once or started too many
+// today. Only the group notifies of its outcome.
+func (h *Handler) startChild(simhashSize int, extractor string, override bool, key *apikeys.Key) func(context.Context, job.Child) (*job.Job, error) {
+	return func(ctx context.Context, child job.Child) (*job.Job, error) {
+		childOpts, err := h.jobOptions(child.URL, simhashSize, extractor, override)
+		if err != nil {
+			return nil, err
+		}
+		if key != nil {
+			if err := h.admit(ctx, *key, child.URL, child.Year, &childOpts); err != nil {
+				return nil, err
+			}
+		}
+		childOpts.Notifier = nil
+		jobID, _ := h.startJob(ctx, child.URL, child.Year, childOpts)
+		h.mu.RLock()
+		defer h.mu.RUnlock()
+		return h.jobsMap[jobID], nil
+	}
+}
+
+// registerGroup makes the job of a group known to /job and records it.
+func (h *Handler) registerGroup(c *gin.Context, j *job.Job, url, year string) {
+	h.mu.Lock()
+	h.jobsMap[j.ID] = j
+	h.mu.Unlock()
+	h.recordOwner(j.ID, url, year)
+	h.recordAudit(c, url, year, j.ID, "STARTED")
+}
@@ -1,33 +1,73 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync"
 
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/apikeys"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/artifacts"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/audit"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/bktree"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/buildinfo"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/cluster"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/config"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/events"
 	"github.com/Yaxhveer/wayback-discover-diff-go/internal/job"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/notify"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/pb"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/ratelimit"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/spn"
 	"github.com/Yaxhveer/wayback-discover-diff-go/internal/utils"
+	"github.com/Yaxhveer/wayback-discover-diff-go/pkg/simhash"
 
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
+	"google.golang.org/protobuf/proto"
 )
 
+// TREE_CACHE_SIZE is the number of URLs whose BK-trees are kept in memory.
+const TREE_CACHE_SIZE = 256
+
 type Handler struct {
 	redisClient *redis.Client
+	cfg         *config.Config
 	jobsMap     map[string]*job.Job
+	trees       *bktree.Cache
+	audit       *audit.Log
+	events      *events.Publisher
+	cluster     *cluster.Membership
+	apiKeys     *apikeys.Store
+	rateLimiter *ratelimit.Limiter
+	spn         *spn.Client
+	artifacts   *artifacts.Uploader
+	notifier    *notify.Notifier
 	mu          sync.RWMutex
 }
 
-func NewHandler(redisClient *redis.Client) *Handler {
-	return &Handler{
+func NewHandler(redisClient *redis.Client, cfg *config.Config) *Handler {
+	h := &Handler{
 		redisClient: redisClient,
+		cfg:         cfg,
 		jobsMap:     make(map[string]*job.Job),
+		trees:       bktree.NewCache(TREE_CACHE_SIZE),
+		events:      events.NewPublisher(redisClient, cfg.Events),
+		cluster:     cluster.New(redisClient, cfg.Cluster),
+		apiKeys:     apikeys.New(redisClient, cfg.APIKeys),
+		rateLimiter: ratelimit.New(redisClient, cfg.RateLimit),
+		spn:         spn.New(cfg.SPN),
+		artifacts:   artifacts.New(cfg.Artifacts),
+		notifier:    notify.New(cfg.Notify),
 	}
-}
-
-func getVersion() string {
-	return "1.0.0"
+	if cfg.Audit.Enabled {
+		h.audit = audit.New(redisClient, cfg.Audit.Retention, cfg.Audit.MaxEntries)
+	}
+	return h
 }
 
 // return job_id instead
@@ -44,166 +84,673 @@ func (h *Handler) getActiveTask(url, year string) *job.Job {
 }
 
 func (h *Handler) Root(c *gin.Context) {
-	version := getVersion()
-	c.String(http.StatusOK, fmt.Sprintf("wayback-discover-diff service version: %s", version))
+	c.String(http.StatusOK, fmt.Sprintf("wayback-discover-diff service version: %s", buildinfo.Version))
 }
 
 // GetSimhash fetches stored SimHash values for a given URL and optional timestamp/year
 func (h *Handler) GetSimhash(c *gin.Context) {
-	url := c.Query("url")
+	url := urlParam(c)
 	if url == "" {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"status": "error", "info": "url param is required."})
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "url param is required."})
 		return
-	} else if !utils.URLIsValid(url) {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"status": "error", "info": "invalid url format."})
+	}
+
+	render, ok := hashRenderer(c)
+	if !ok {
+		return
+	}
+
+	size, ok := h.simhashSize(c, url)
+	if !ok {
 		return
 	}
 
 	timestamp := c.Query("timestamp")
 
 	if timestamp == "" {
+		compress := c.Query("compress") == "true" || c.Query("compress") == "1"
+		delta := c.Query("delta")
+		if delta != "" && delta != DELTA_XOR {
+			respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "delta must be xor."})
+			return
+		}
+		if delta != "" && !compress {
+			respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "delta requires compress=true."})
+			return
+		}
+		distances := c.Query("distances")
+		if distances != "" && distances != utils.DISTANCES_FIRST && distances != utils.DISTANCES_PREVIOUS {
+			respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "distances must be one of first, previous."})
+			return
+		}
+		if distances != "" && compress {
+			respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "distances cannot be combined with compress."})
+			return
+		}
 		year := c.Query("year")
 		if year == "" {
-			c.IndentedJSON(http.StatusBadRequest, gin.H{"status": "error", "info": "year param is required."})
+			respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "year param is required."})
 			return
 		}
-		var page int
-		var err error
-
-		pageStr := c.Query("page")
-		if page, err = strconv.Atoi(pageStr); pageStr != "" && err != nil {
-			page = -1
+		page := -1
+		if p, err := strconv.Atoi(c.Query("page")); err == nil && p > 0 {
+			page = p
 		}
 
-		var snapshots_per_page int = -1 // from config
+		job := h.getActiveTask(url, year)
+		status := "PENDING"
+		if job != nil {
+			status = string(job.State())
+		}
+		h.cacheSimhashes(c, year, job)
+		etag, err := h.simhashETag(url, status)
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+		if notModified(c, etag) {
+			return
+		}
 
-		resultStruct, err := utils.YearSimhash(h.redisClient, url, year, page, snapshots_per_page)
+		resultStruct, err := utils.YearSimhash(h.redisClient, url, year, page, h.cfg.Snapshots.NumberPerPage)
 		if err != nil && len(resultStruct) == 0 {
-			c.IndentedJSON(http.StatusAccepted, gin.H{
+			code := http.StatusAccepted
+			if pythonCompat(c) {
+				code = http.StatusOK
+			}
+			respond(c, code, gin.H{
 				"status":  "error",
 				"message": err.Error(),
 			})
 			return
 		}
 
-		job := h.getActiveTask(url, year)
-		status := "PENDING"
-		if job != nil {
-			status = job.State
-		}
-
-		compress := c.Query("compress")
-		if compress == "true" || compress == "1" {
-			captures, sortedHashes := utils.CompressCaptures(resultStruct)
-			c.IndentedJSON(http.StatusOK, gin.H{
+		if compress {
+			captures, hashes, err := compressCaptures(resultStruct, delta, render)
+			if err != nil {
+				internalError(c, err)
+				return
+			}
+			body := gin.H{
 				"captures":       captures,
-				"hashes":         sortedHashes,
+				"hashes":         hashes,
 				"total_captures": len(resultStruct),
+				"simhash_size":   size,
 				"status":         status,
+			}
+			if pythonCompat(c) {
+				body = gin.H{
+					"captures":       captures,
+					"hashes":         hashes,
+					"total_captures": len(resultStruct),
+					"status":         pythonYearStatus(job),
+				}
+			}
+			if delta != "" {
+				body["delta"] = delta
+			}
+			respond(c, http.StatusOK, body)
+			return
+		}
+
+		if distances != "" {
+			before, err := utils.DistanceBaseline(h.redisClient, url, year, page, h.cfg.Snapshots.NumberPerPage, distances)
+			if err == nil {
+				err = utils.SetDistances(resultStruct, distances, before)
+			}
+			if err != nil {
+				internalError(c, err)
+				return
+			}
+		}
+		if err := renderCaptures(resultStruct, render); err != nil {
+			internalError(c, err)
+			return
+		}
+		if pythonCompat(c) {
+			respond(c, http.StatusOK, gin.H{
+				"captures":       pythonCaptures(resultStruct),
+				"total_captures": len(resultStruct),
+				"status":         pythonYearStatus(job),
 			})
 			return
 		}
 
-		c.IndentedJSON(http.StatusOK, gin.H{
+		msg := &pb.YearResult{TotalCaptures: int32(len(resultStruct)), SimhashSize: int32(size), Status: status}
+		for _, capture := range resultStruct {
+			msg.Captures = append(msg.Captures, &pb.Capture{Timestamp: capture.Timestamp, Simhash: capture.Simhash})
+		}
+		respondMessage(c, http.StatusOK, gin.H{
 			"captures":       resultStruct,
 			"total_captures": len(resultStruct),
+			"simhash_size":   size,
 			"status":         status,
-		})
+		}, msg)
 		return
 	}
 
 	resultsMap, err := utils.TimestampSimHash(h.redisClient, url, timestamp)
 	if err != nil {
-		fmt.Printf("Cannot get simhash of url %s timestamp %s, %+v", url, timestamp, err)
-		c.IndentedJSON(http.StatusAccepted, gin.H{
+		slog.WarnContext(c.Request.Context(), "cannot get simhash", "url", url, "timestamp", timestamp, "error", err)
+		code := http.StatusAccepted
+		if pythonCompat(c) {
+			code = http.StatusOK
+		}
+		respond(c, code, gin.H{
 			"status":  "ERROR",
 			"message": err.Error(),
 		})
 		return
 	}
+	if hash, ok := resultsMap["simhash"]; ok {
+		if resultsMap["simhash"], err = render(hash); err != nil {
+			internalError(c, err)
+			return
+		}
+	}
 	job := h.getActiveTask(url, timestamp[:4])
 	status := "PENDING"
 	if job != nil {
-		status = job.State
+		status = string(job.State())
 	}
-	c.IndentedJSON(http.StatusOK, gin.H{
-		"captures": resultsMap,
-		"status":   status,
-	})
+	h.cacheSimhashes(c, timestamp[:4], job)
+	etag, err := h.simhashETag(url, status)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	if notModified(c, etag) {
+		return
+	}
+	if pythonCompat(c) {
+		// The Python service answers the simhash alone, or the error.
+		delete(resultsMap, "source")
+		respond(c, http.StatusOK, resultsMap)
+		return
+	}
+	var msg proto.Message = &pb.Error{Status: resultsMap["status"], Info: resultsMap["message"]}
+	if hash, ok := resultsMap["simhash"]; ok {
+		msg = &pb.CaptureResult{Capture: &pb.Capture{Timestamp: timestamp, Simhash: hash}, SimhashSize: int32(size), Status: status}
+	}
+	respondMessage(c, http.StatusOK, gin.H{
+		"captures":     resultsMap,
+		"simhash_size": size,
+		"status":       status,
+	}, msg)
+}
+
+// internalError writes a 500 response for err and records it on the context
+// so that the error reporting middleware can ship it.
+func internalError(c *gin.Context, err error) {
+	c.Error(err)
+	respond(c, http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+}
+
+// simhashSize returns the simhash size stored for url, checking it against the
+// optional simhash_size query param. It writes an error response and returns
+// false when the param is invalid or does not match the stored size.
+func (h *Handler) simhashSize(c *gin.Context, url string) (int, bool) {
+	stored, err := utils.StoredSimhashSize(h.redisClient, url)
+	if err != nil {
+		internalError(c, err)
+		return 0, false
+	}
+	if stored == 0 {
+		stored = h.cfg.Simhash.Size
+	}
+
+	sizeStr := c.Query("simhash_size")
+	if sizeStr == "" {
+		return stored, true
+	}
+	size, err := strconv.Atoi(sizeStr)
+	if err != nil || !simhash.ValidSize(size) {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "simhash_size must be one of 64, 128, 256, 512."})
+		return 0, false
+	}
+	if size != stored {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": fmt.Sprintf("simhash_size %d does not match stored size %d.", size, stored)})
+		return 0, false
+	}
+	return size, true
+}
+
+// hashRenderer builds the conversion from stored base64 simhashes to the
+// representation requested through the encoding and format query params.
+// It writes a 400 response and returns false when either param is invalid.
+func hashRenderer(c *gin.Context) (func(string) (string, error), bool) {
+	encoding := c.Query("encoding")
+	if !simhash.ValidEncoding(encoding) {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "encoding must be one of hex, base64, base64url."})
+		return nil, false
+	}
+	// format also selects the encoding of the response, see respond.
+	format := c.Query("format")
+	if f := responseFormat(c); format == f {
+		format = ""
+	}
+	if !simhash.ValidFormat(format) {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "format must be one of bits, uint."})
+		return nil, false
+	}
+
+	return func(stored string) (string, error) {
+		if format == "" {
+			return simhash.Reencode(stored, simhash.EncodingBase64, encoding)
+		}
+		data, err := simhash.Decode(stored, simhash.EncodingBase64)
+		if err != nil {
+			return "", err
+		}
+		if format == simhash.FormatBits {
+			return simhash.FormatAsBits(data), nil
+		}
+		return simhash.FormatAsUint(data), nil
+	}, true
+}
+
+// renderCaptures converts the stored simhashes of captures in place.
+func renderCaptures(captures []utils.CaptureResult, render func(string) (string, error)) error {
+	for i := range captures {
+		hash, err := render(captures[i].Simhash)
+		if err != nil {
+			return err
+		}
+		captures[i].Simhash = hash
+	}
+	return nil
+}
+
+// DELTA_XOR encodes the hashes of compressed year responses as XOR deltas,
+// see utils.XORDelta.
+const DELTA_XOR = "xor"
+
+// compressCaptures returns the captures and rendered hashes of the
+// compressed year format, see utils.CompressCaptures. The hashes are XOR
+// deltas of each other when delta is DELTA_XOR.
+func compressCaptures(captures []utils.CaptureResult, delta string, render func(string) (string, error)) ([][]interface{}, []string, error) {
+	compressed, hashes := utils.CompressCaptures(captures)
+	if delta == DELTA_XOR {
+		var err error
+		if hashes, err = utils.XORDelta(hashes); err != nil {
+			return nil, nil, err
+		}
+	}
+	for i := range hashes {
+		hash, err := render(hashes[i])
+		if err != nil {
+			return nil, nil, err
+		}
+		hashes[i] = hash
+	}
+	return compressed, hashes, nil
 }
 
 // CalculateSimhash triggers a new SimHash calculation job
 func (h *Handler) CalculateSimhash(c *gin.Context) {
-	url := c.Query("url")
+	url := urlParam(c)
 	if url == "" {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"status": "error", "info": "url param is required."})
-		return
-	} else if !utils.URLIsValid(url) {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"status": "error", "info": "invalid url format."})
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "url param is required."})
 		return
 	}
 
+	if years := c.Query("years"); years != "" {
+		h.calculateYears(c, url, years)
+		return
+	}
 	year := c.Query("year")
 	if year == "" {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"status": "error", "info": "year param is required."})
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "year param is required."})
+		return
+	}
+	if h.routeToOwner(c, url) {
+		return
+	}
+	simhashSize, extractor, ok := h.calculationParams(c)
+	if !ok {
 		return
 	}
 
-	task := h.getActiveTask(url, year)
-	if task != nil && task.State == "PENDING" {
-		c.IndentedJSON(http.StatusOK, gin.H{
+	// recalculate, or refresh, recomputes every capture of the year and
+	// implies override, e.g. after the extractor changed.
+	recalculate := c.Query("recalculate") == "true" || c.Query("recalculate") == "1" || c.Query("refresh") == "true" || c.Query("refresh") == "1"
+	override := c.Query("override") == "true" || c.Query("override") == "1" || recalculate
+	sample, ok := sampleParam(c)
+	if !ok {
+		return
+	}
+	preview := 0
+	if param := c.Query("preview"); param != "" {
+		var err error
+		if preview, err = strconv.Atoi(param); err != nil || preview < 1 {
+			respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "preview must be a positive integer."})
+			return
+		}
+	}
+	opts, err := h.jobOptions(url, simhashSize, extractor, override)
+	opts.Recalculate, opts.Sample, opts.Preview = recalculate, sample, preview
+	var conflict *conflictError
+	if errors.As(err, &conflict) {
+		respond(c, http.StatusConflict, gin.H{"status": "error", "info": conflict.Error()})
+		return
+	} else if err != nil {
+		internalError(c, err)
+		return
+	}
+	if h.noCaptures(c.Request.Context(), url, year) {
+		h.recordAudit(c, url, year, "", "NO_CAPTURES")
+		code := http.StatusAccepted
+		if pythonCompat(c) {
+			code = http.StatusOK
+		}
+		respond(c, code, gin.H{"status": "error", "message": "NO_CAPTURES"})
+		return
+	}
+	if key, ok := requestAPIKey(c); ok {
+		var quota *quotaError
+		if err := h.admit(c.Request.Context(), key, url, year, &opts); errors.As(err, &quota) {
+			respond(c, http.StatusTooManyRequests, gin.H{"status": "error", "info": quota.Error()})
+			return
+		} else if err != nil {
+			internalError(c, err)
+			return
+		}
+	}
+
+	jobID, started := h.startJob(c.Request.Context(), url, year, opts)
+	if !started {
+		h.recordAudit(c, url, year, jobID, "PENDING")
+		respond(c, http.StatusOK, gin.H{
 			"status": "PENDING",
-			"job_id": task.ID,
+			"job_id": jobID,
 		})
 		return
 	}
+	h.recordAudit(c, url, year, jobID, "STARTED")
+
+	if pythonCompat(c) {
+		respond(c, http.StatusOK, gin.H{"status": "started", "job_id": jobID})
+		return
+	}
+	respond(c, http.StatusAccepted, gin.H{
+		"status":       "STARTED",
+		"job_id":       jobID,
+		"simhash_size": simhashSize,
+		"algo":         simhash.Algorithm(simhashSize),
+		"extractor":    extractor,
+	})
+}
+
+// noCaptures reports whether CDX lists no capture of url in year, so there is
+// no job to start. A job already running for them, or a failing CDX query,
+// lets the request through and the job reports on its own.
+func (h *Handler) noCaptures(ctx context.Context, url, year string) bool {
+	if task := h.getActiveTask(url, year); task != nil && task.State().Running() {
+		return false
+	}
+	found, err := job.HasCaptures(ctx, url, year)
+	if err != nil {
+		slog.WarnContext(ctx, "cannot check captures before starting job", "url", url, "year", year, "error", err)
+		return false
+	}
+	return !found
+}
+
+// calculationParams parses the simhash_size, algo and extractor params of a
+// calculation. It answers 400 and returns false when they are invalid.
+func (h *Handler) calculationParams(c *gin.Context) (int, string, bool) {
+	simhashSize := h.cfg.Simhash.Size
+	if sizeStr := c.Query("simhash_size"); sizeStr != "" {
+		size, err := strconv.Atoi(sizeStr)
+		if err != nil || !simhash.ValidSize(size) {
+			respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "simhash_size must be one of 64, 128, 256, 512."})
+			return 0, "", false
+		}
+		simhashSize = size
+	}
+	if algo := c.Query("algo"); algo != "" {
+		size, ok := simhash.AlgorithmSize(algo)
+		if !ok {
+			respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "algo must be one of simhash64, simhash128, simhash256, simhash512."})
+			return 0, "", false
+		}
+		if c.Query("simhash_size") != "" && size != simhashSize {
+			respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "algo and simhash_size disagree."})
+			return 0, "", false
+		}
+		simhashSize = size
+	}
+
+	extractor := c.DefaultQuery("extractor", job.ExtractorDefault)
+	if !job.ValidExtractor(extractor) {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "extractor must be one of default, weighted."})
+		return 0, "", false
+	}
+	return simhashSize, extractor, true
+}
+
+// conflictError reports a calculation that would mix fingerprint algorithms
+// or extractors in the simhashes stored for a URL.
+type conflictError struct {
+	url, algo, extractor string
+}
+
+func (e *conflictError) Error() string {
+	return fmt.Sprintf("simhashes of %s are stored with algo %s and extractor %s, pass override=true to replace them.",
+		e.url, e.algo, e.extractor)
+}
+
+// sampleParam returns the sample param of a calculation, 0 when it is not
+// set, and responds with an error unless it is an integer of at least 2 or
+// a fraction between 0 and 1.
+func sampleParam(c *gin.Context) (float64, bool) {
+	param := c.Query("sample")
+	if param == "" {
+		return 0, true
+	}
+	sample, err := strconv.ParseFloat(param, 64)
+	if err != nil || !(sample > 0 && sample < 1 || sample >= 2 && sample == float64(int(sample))) {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "sample must be an integer of at least 2 or a fraction between 0 and 1."})
+		return 0, false
+	}
+	return sample, true
+}
+
+// jobOptions builds the options of a job calculating the simhashes of url. It
+// returns a *conflictError when they differ from the stored algorithm or
+// extractor and override is false.
+func (h *Handler) jobOptions(url string, simhashSize int, extractor string, override bool) (job.Options, error) {
+	meta, err := utils.StoredMetadata(h.redisClient, url)
+	if err != nil {
+		return job.Options{}, err
+	}
+	mixing := meta.Algorithm != "" && (meta.Algorithm != simhash.Algorithm(simhashSize) || meta.Extractor != extractor)
+	if mixing && !override {
+		return job.Options{}, &conflictError{url: url, algo: meta.Algorithm, extractor: meta.Extractor}
+	}
+	return job.Options{SimhashSize: simhashSize, Extractor: extractor, Replace: mixing, Events: h.events, Artifacts: h.artifacts, Notifier: h.notifier}, nil
+}
+
+// startJob starts a job calculating the simhashes of url and year unless one
+// is already pending, and returns the job ID and whether it was started.
+func (h *Handler) startJob(ctx context.Context, url, year string, opts job.Options) (string, bool) {
+	task := h.getActiveTask(url, year)
+	if task != nil && task.State().Running() {
+		return task.ID, false
+	}
 
-	// added using config
 	job := job.NewJob()
-	jobID := job.RunJob(h.redisClient, url, year)
+	jobID := job.RunJob(ctx, h.redisClient, url, year, opts)
 
 	h.mu.Lock()
 	h.jobsMap[jobID] = job
 	h.mu.Unlock()
-
-	c.IndentedJSON(http.StatusAccepted, gin.H{
-		"status": "STARTED",
-		"job_id": jobID,
-	})
+	h.recordOwner(jobID, url, year)
+	return jobID, true
 }
 
 func (h *Handler) GetJobStatus(c *gin.Context) {
 	jobID := c.Query("job_id")
 	if jobID == "" {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"status": "error", "info": "job_id param is required."})
+		jobID = c.Query("group_id")
+	}
+	if jobID == "" {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "job_id param is required."})
+		return
+	}
+	if strings.Contains(jobID, ",") {
+		h.batchJobStatus(c, strings.Split(jobID, ","))
 		return
 	}
 
 	h.mu.Lock()
-	job, exists := h.jobsMap[jobID]
+	j, exists := h.jobsMap[jobID]
 	h.mu.Unlock()
 
+	if !exists && h.redirectToJobOwner(c, jobID) {
+		return
+	}
 	if !exists {
-		fmt.Printf("Cannot get job status of %s", jobID)
-		c.IndentedJSON(http.StatusAccepted, gin.H{
+		slog.WarnContext(c.Request.Context(), "cannot get job status", "job_id", jobID)
+		respond(c, http.StatusAccepted, gin.H{
 			"status": "ERROR",
 			"info":   "Cannot get status",
 		})
 		return
 	}
 
-	if job.State == "PENDING" || job.State == "ERROR" {
-		c.IndentedJSON(http.StatusOK, gin.H{
-			"status": job.State,
-			"job_id": job.ID,
-			"info":   job.Info,
+	if pythonCompat(c) {
+		respond(c, http.StatusOK, gin.H{"status": j.State(), "job_id": j.ID, "info": j.Info()})
+		return
+	}
+
+	msg := &pb.JobStatus{State: string(j.State()), JobId: j.ID, RequestId: j.RequestID}
+	if msg.State != string(job.SUCCESS) {
+		msg.Info = j.Info()
+	} else {
+		msg.Duration = j.Duration().Seconds()
+	}
+	respondMessage(c, http.StatusOK, jobStatus(j), msg)
+}
+
+// jobStatus returns the status of j as answered by /job.
+func jobStatus(j *job.Job) gin.H {
+	state := j.State()
+	status := gin.H{
+		"state":       state,
+		"job_id":      j.ID,
+		"request_id":  j.RequestID,
+		"duration":    j.Duration().Seconds(),
+		"transitions": j.Transitions(),
+	}
+	if state != job.SUCCESS {
+		status = gin.H{
+			"status":      state,
+			"job_id":      j.ID,
+			"request_id":  j.RequestID,
+			"info":        j.Info(),
+			"transitions": j.Transitions(),
+		}
+	}
+	if key := j.ArtifactsKey(); key != "" {
+		status["artifacts"] = key
+	}
+	if group := j.Group(); group != nil {
+		status["group_id"] = j.ID
+		status["group"] = group
+	} else if state == job.SUCCESS {
+		status["cost"] = j.Cost()
+	}
+	if skipped := j.Skipped(); len(skipped) > 0 {
+		status["skipped"] = skipped
+	}
+	if sample := j.Sample(); sample != nil {
+		status["sample"] = sample
+	}
+	if limit := j.ConcurrencyLimit(); limit > 0 && (state == job.PROGRESS || state == job.PARTIAL) {
+		status["concurrency"] = limit
+	}
+	if urls := j.URLs(); urls != nil {
+		status["urls"] = urls
+	}
+	return status
+}
+
+// MAX_BATCH_JOBS is the number of jobs whose status can be requested at once.
+const MAX_BATCH_JOBS = 1000
+
+// PostJobStatus returns the status of the jobs listed in the job_ids array
+// of the JSON body.
+func (h *Handler) PostJobStatus(c *gin.Context) {
+	var body struct {
+		JobIDs []string `json:"job_ids"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || len(body.JobIDs) == 0 {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "job_ids array is required."})
+		return
+	}
+	h.batchJobStatus(c, body.JobIDs)
+}
+
+// batchJobStatus answers the status of each job of jobIDs, in order. Jobs
+// unknown to this instance get the ERROR status, they are not looked up on
+// the other instances of a cluster.
+func (h *Handler) batchJobStatus(c *gin.Context, jobIDs []string) {
+	if len(jobIDs) > MAX_BATCH_JOBS {
+		respond(c, http.StatusBadRequest, gin.H{
+			"status": "error",
+			"info":   fmt.Sprintf("at most %d job IDs can be requested at once.", MAX_BATCH_JOBS),
+		})
+		return
+	}
+
+	jobs := make([]*job.Job, len(jobIDs))
+	h.mu.Lock()
+	for i, jobID := range jobIDs {
+		jobs[i] = h.jobsMap[strings.TrimSpace(jobID)]
+	}
+	h.mu.Unlock()
+
+	statuses := make([]gin.H, len(jobIDs))
+	for i, j := range jobs {
+		switch {
+		case j == nil:
+			statuses[i] = gin.H{"job_id": strings.TrimSpace(jobIDs[i]), "status": "ERROR", "info": "Cannot get status"}
+		case pythonCompat(c):
+			statuses[i] = gin.H{"status": j.State(), "job_id": j.ID, "info": j.Info()}
+		default:
+			statuses[i] = jobStatus(j)
+		}
+	}
+	respond(c, http.StatusOK, gin.H{"jobs": statuses, "count": len(statuses)})
+}
+
+// GetJobLogs returns the latest log lines of a job.
+func (h *Handler) GetJobLogs(c *gin.Context) {
+	jobID := c.Query("job_id")
+	if jobID == "" {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "job_id param is required."})
+		return
+	}
+
+	h.mu.Lock()
+	job, exists := h.jobsMap[jobID]
+	h.mu.Unlock()
+
+	if !exists && h.redirectToJobOwner(c, jobID) {
+		return
+	}
+	if !exists {
+		respond(c, http.StatusAccepted, gin.H{
+			"status": "ERROR",
+			"info":   "Cannot get logs",
 		})
 		return
 	}
 
-	c.IndentedJSON(http.StatusOK, gin.H{
-		"state":    job.State,
-		"job_id":   job.ID,
-		"duration": job.Duration.Seconds(),
+	respond(c, http.StatusOK, gin.H{
+		"job_id": job.ID,
+		"state":  job.State(),
+		"logs":   job.Logs(),
 	})
 }
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/buildinfo"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/job"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HEALTH_CHECK_TIMEOUT bounds each dependency check of /healthz.
+const HEALTH_CHECK_TIMEOUT = 2 * time.Second
+
+// MAX_RUNNING_JOBS is the number of concurrent jobs above which the instance
+// reports itself not ready for new calculations.
+const MAX_RUNNING_JOBS = 16
+
+// WORKER_SATURATION is the fraction of the download workers of
+// MAX_RUNNING_JOBS jobs above which the worker pool counts as saturated.
+const WORKER_SATURATION = 0.9
+
+// componentStatus is the health of a single dependency.
+type componentStatus struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// checkRedis pings Redis and reports its status and round trip latency.
+func (h *Handler) checkRedis(ctx context.Context) componentStatus {
+	ctx, cancel := context.WithTimeout(ctx, HEALTH_CHECK_TIMEOUT)
+	defer cancel()
+
+	start := time.Now()
+	err := h.redisClient.Ping(ctx).Err()
+	status := componentStatus{Status: "ok", LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		status.Status = "down"
+		status.Error = err.Error()
+	}
+	return status
+}
+
+// Healthz reports whether the server and its dependencies are up. It answers
+// 503 when any dependency is down.
+func (h *Handler) Healthz(c *gin.Context) {
+	components := map[string]componentStatus{
+		"server": {Status: "ok"},
+		"redis":  h.checkRedis(c.Request.Context()),
+	}
+
+	code, status := http.StatusOK, "ok"
+	for _, component := range components {
+		if component.Status != "ok" {
+			code, status = http.StatusServiceUnavailable, "down"
+		}
+	}
+	c.IndentedJSON(code, gin.H{
+		"status":     status,
+		"version":    buildinfo.Version,
+		"components": components,
+	})
+}
+
+// Readyz reports whether the instance should receive new calculation
+// traffic. It answers 503 when the job queue is full, the download workers
+// are saturated or Redis is unreachable.
+func (h *Handler) Readyz(c *gin.Context) {
+	running := job.RunningJobs()
+	downloads := job.ActiveDownloads()
+	maxDownloads := int64(WORKER_SATURATION * float64(MAX_RUNNING_JOBS*job.Concurrency()))
+	redis := h.checkRedis(c.Request.Context())
+
+	var reasons []string
+	if running >= MAX_RUNNING_JOBS {
+		reasons = append(reasons, "job queue is full")
+	}
+	if downloads >= maxDownloads {
+		reasons = append(reasons, "worker pool is saturated")
+	}
+	if redis.Status != "ok" {
+		reasons = append(reasons, "redis is unreachable")
+	}
+
+	code, status := http.StatusOK, "ready"
+	if len(reasons) > 0 {
+		code, status = http.StatusServiceUnavailable, "not ready"
+	}
+	c.IndentedJSON(code, gin.H{
+		"status":  status,
+		"reasons": reasons,
+		"jobs":    gin.H{"running": running, "max": MAX_RUNNING_JOBS},
+		"workers": gin.H{"active": downloads, "max": maxDownloads},
+		"redis":   redis,
+	})
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"runtime"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/buildinfo"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/job"
+	"github.com/Yaxhveer/wayback-discover-diff-go/pkg/simhash"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Info returns the build of the service, the algorithms and encodings it
+// supports and its limits, so clients can detect its capabilities.
+func (h *Handler) Info(c *gin.Context) {
+	algorithms := make([]string, len(simhash.Sizes))
+	for i, size := range simhash.Sizes {
+		algorithms[i] = simhash.Algorithm(size)
+	}
+	limits := gin.H{
+		"captures_per_year":  h.cfg.Snapshots.NumberPerYear,
+		"captures_per_page":  h.cfg.Snapshots.NumberPerPage,
+		"concurrency":        h.cfg.Concurrency,
+		"max_running_jobs":   MAX_RUNNING_JOBS,
+		"max_batch_jobs":     MAX_BATCH_JOBS,
+		"rate_limit_enabled": h.cfg.RateLimit.Enabled,
+	}
+	if h.cfg.RateLimit.Enabled {
+		limits["rate_limit"] = gin.H{
+			"per_ip":  gin.H{"rate": h.cfg.RateLimit.PerIP.Rate, "burst": h.cfg.RateLimit.PerIP.Burst},
+			"per_key": gin.H{"rate": h.cfg.RateLimit.PerKey.Rate, "burst": h.cfg.RateLimit.PerKey.Burst},
+		}
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"version":    buildinfo.Version,
+		"commit":     buildinfo.Commit,
+		"build_date": buildinfo.Date,
+		"go_version": runtime.Version(),
+		"simhash": gin.H{
+			"size":       h.cfg.Simhash.Size,
+			"sizes":      simhash.Sizes,
+			"algorithms": algorithms,
+			"encodings":  []string{simhash.EncodingHex, simhash.EncodingBase64, simhash.EncodingBase64URL},
+			"formats":    []string{simhash.FormatBits, simhash.FormatUint},
+			"extractors": []string{job.ExtractorDefault, job.ExtractorWeighted},
+		},
+		"response_formats": []string{"json", "msgpack", "cbor", "protobuf"},
+		"python_compat":    h.cfg.PythonCompat,
+		"limits":           limits,
+	})
+}
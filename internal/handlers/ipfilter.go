@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IPFilter refuses requests whose client address is denied by list, or not
+// allowed by it when it has allowed addresses, with 403. Requests on Unix
+// sockets have no client address, they are allowed unless list.DenyUnix is
+// set. Every request is allowed when both lists are empty.
+func IPFilter(list config.IPListConfig) gin.HandlerFunc {
+	allow, deny := prefixes(list.Allow), prefixes(list.Deny)
+	if len(allow) == 0 && len(deny) == 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+	return func(c *gin.Context) {
+		if onUnixSocket(c) {
+			if list.DenyUnix {
+				forbidden(c)
+				return
+			}
+			c.Next()
+			return
+		}
+		addr, err := netip.ParseAddr(c.ClientIP())
+		if err != nil || contains(deny, addr.Unmap()) || (len(allow) > 0 && !contains(allow, addr.Unmap())) {
+			forbidden(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+func forbidden(c *gin.Context) {
+	c.Abort()
+	respond(c, http.StatusForbidden, gin.H{"status": "error", "info": "client address is not allowed."})
+}
+
+// onUnixSocket reports whether the request came in on a Unix socket, such as
+// server.unix_socket or a systemd-activated one.
+func onUnixSocket(c *gin.Context) bool {
+	_, ok := c.Request.Context().Value(http.LocalAddrContextKey).(*net.UnixAddr)
+	return ok
+}
+
+// prefixes parses the CIDRs of cidrs, which were checked when the
+// configuration was loaded.
+func prefixes(cidrs []string) []netip.Prefix {
+	var parsed []netip.Prefix
+	for _, cidr := range cidrs {
+		if prefix, err := config.ParsePrefix(cidr); err == nil {
+			parsed = append(parsed, prefix)
+		}
+	}
+	return parsed
+}
+
+func contains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
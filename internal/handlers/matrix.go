@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/utils"
+	"github.com/Yaxhveer/wayback-discover-diff-go/pkg/simhash"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MAX_MATRIX_CAPTURES is the number of captures of a distance matrix, at
+// most. Years with more captures are sampled down to it.
+const MAX_MATRIX_CAPTURES = 500
+
+// PostDistanceMatrix returns the pairwise hamming distances of captures of
+// a URL, for dendrograms and heat maps of the evolution of a page. The JSON
+// body lists the timestamps of the captures, or a year whose captures are
+// taken, evenly sampled down to sample captures when it has more. The
+// simhashes of the captures are rendered with the encoding and format query
+// params.
+func (h *Handler) PostDistanceMatrix(c *gin.Context) {
+	render, ok := hashRenderer(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		URL        string   `json:"url"`
+		Collection string   `json:"collection"`
+		Timestamps []string `json:"timestamps"`
+		Year       string   `json:"year"`
+		Sample     int      `json:"sample"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.URL == "" {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "url is required."})
+		return
+	}
+	if err := utils.CheckURL(body.URL); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "invalid url, " + err.Error() + "."})
+		return
+	}
+	url := utils.Canonicalize(utils.InCollection(body.URL, body.Collection))
+	if (len(body.Timestamps) == 0) == (body.Year == "") {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "either timestamps or year is required, not both."})
+		return
+	}
+	if len(body.Timestamps) > MAX_MATRIX_CAPTURES {
+		respond(c, http.StatusBadRequest, gin.H{
+			"status": "error",
+			"info":   fmt.Sprintf("at most %d timestamps can be compared at once.", MAX_MATRIX_CAPTURES),
+		})
+		return
+	}
+	if body.Sample < 0 || body.Sample > MAX_MATRIX_CAPTURES {
+		respond(c, http.StatusBadRequest, gin.H{
+			"status": "error",
+			"info":   fmt.Sprintf("sample must be from 1 to %d.", MAX_MATRIX_CAPTURES),
+		})
+		return
+	}
+	if body.Sample == 0 {
+		body.Sample = MAX_MATRIX_CAPTURES
+	}
+
+	var captures []utils.CaptureResult
+	var missing []string
+	if body.Year != "" {
+		if !utils.YearIsValid(body.Year) {
+			respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "invalid year " + body.Year + "."})
+			return
+		}
+		var err error
+		captures, err = utils.YearSimhash(h.redisClient, url, body.Year, -1, -1)
+		if err != nil && len(captures) == 0 {
+			respond(c, http.StatusAccepted, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+		captures = sampleCaptures(captures, body.Sample)
+		if len(captures) == 0 {
+			respond(c, http.StatusAccepted, gin.H{"status": "error", "message": "NO_CAPTURES"})
+			return
+		}
+	} else {
+		for _, ts := range body.Timestamps {
+			if !utils.CaptureTimestampIsValid(ts) {
+				respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "invalid timestamp " + ts + ", timestamps must have 14 digits."})
+				return
+			}
+		}
+		simhashes, err := utils.SimhashesAt(h.redisClient, url, body.Timestamps)
+		if err != nil {
+			respond(c, http.StatusAccepted, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+		for _, ts := range body.Timestamps {
+			if hash, ok := simhashes[ts]; ok {
+				captures = append(captures, utils.CaptureResult{Timestamp: ts, Simhash: hash})
+			} else {
+				missing = append(missing, ts)
+			}
+		}
+		if len(captures) == 0 {
+			respond(c, http.StatusAccepted, gin.H{"status": "error", "message": "CAPTURE_NOT_FOUND"})
+			return
+		}
+	}
+
+	hashes := make([]simhash.Simhash, len(captures))
+	timestamps := make([]string, len(captures))
+	rendered := make([]string, len(captures))
+	for i, capture := range captures {
+		hash, err := simhash.Parse(capture.Simhash, simhash.EncodingBase64)
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+		if rendered[i], err = render(capture.Simhash); err != nil {
+			internalError(c, err)
+			return
+		}
+		hashes[i], timestamps[i] = hash, capture.Timestamp
+	}
+	matrix := make([][]int, len(hashes))
+	for i := range matrix {
+		matrix[i] = make([]int, len(hashes))
+	}
+	for i := range hashes {
+		for j := i + 1; j < len(hashes); j++ {
+			distance, err := hashes[i].Hamming(hashes[j])
+			if err != nil {
+				internalError(c, err)
+				return
+			}
+			matrix[i][j], matrix[j][i] = distance, distance
+		}
+	}
+
+	response := gin.H{
+		"url":          url,
+		"simhash_size": hashes[0].Size(),
+		"timestamps":   timestamps,
+		"simhashes":    rendered,
+		"matrix":       matrix,
+	}
+	if missing != nil {
+		response["missing"] = missing
+	}
+	respond(c, http.StatusOK, response)
+}
+
+// sampleCaptures returns n captures evenly spread over captures, including
+// the first and the last, or captures when there are no more than n.
+func sampleCaptures(captures []utils.CaptureResult, n int) []utils.CaptureResult {
+	if len(captures) <= n {
+		return captures
+	}
+	if n == 1 {
+		return captures[:1]
+	}
+	sample := make([]utils.CaptureResult, n)
+	for i := range sample {
+		sample[i] = captures[i*(len(captures)-1)/(n-1)]
+	}
+	return sample
+}
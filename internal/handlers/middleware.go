@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/logging"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/reporting"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/Yaxhveer/wayback-discover-diff-go/internal/handlers")
+
+// maxRequestIDLength bounds the length of a client supplied X-Request-ID.
+const maxRequestIDLength = 128
+
+// RequestID accepts the X-Request-ID header of a request, or generates one
+// when it is missing or malformed, echoes it in the response and attaches it
+// to the request context so that it appears in every downstream log line.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		c.Header("X-Request-ID", id)
+		trace.SpanFromContext(c.Request.Context()).SetAttributes(attribute.String("request.id", id))
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// AccessLog writes one line per request to logger with the method, path,
+// query, status, latency, response size and client IP of the request.
+func AccessLog(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		logger.LogAttrs(c.Request.Context(), slog.LevelInfo, "request",
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("query", c.Request.URL.RawQuery),
+			slog.Int("status", c.Writer.Status()),
+			slog.Duration("latency", time.Since(start)),
+			slog.Int("bytes", c.Writer.Size()),
+			slog.String("client_ip", c.ClientIP()),
+			slog.String("user_agent", c.Request.UserAgent()),
+			slog.String("request_id", logging.RequestID(c.Request.Context())),
+		)
+	}
+}
+
+// ErrorReporting ships panics and the errors behind 5xx responses to the
+// error reporting service, tagged with the route and the url param. Panics
+// are re-raised for the recovery middleware to answer them.
+func ErrorReporting() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tags := func() map[string]string {
+			return map[string]string{
+				"method": c.Request.Method,
+				"route":  c.FullPath(),
+				"url":    c.Query("url"),
+			}
+		}
+		defer func() {
+			if r := recover(); r != nil {
+				reporting.CapturePanic(c.Request.Context(), r, tags())
+				panic(r)
+			}
+		}()
+
+		c.Next()
+
+		if c.Writer.Status() >= 500 {
+			for _, err := range c.Errors {
+				reporting.CaptureError(c.Request.Context(), err.Err, tags())
+			}
+		}
+	}
+}
+
+// Tracing starts a server span for every request, continuing the trace of
+// the caller when the request carries W3C trace context headers.
+func Tracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		ctx, span := tracer.Start(ctx, fmt.Sprintf("%s %s", c.Request.Method, route),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", c.Request.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.query", c.Request.URL.RawQuery),
+			),
+		)
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, fmt.Sprintf("status %d", status))
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/bktree"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/utils"
+	"github.com/Yaxhveer/wayback-discover-diff-go/pkg/simhash"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetNearest returns the captures of a URL whose simhash is within a hamming
+// distance of the given capture, whose simhash is rendered with the encoding
+// and format params.
+func (h *Handler) GetNearest(c *gin.Context) {
+	url := urlParam(c)
+	if url == "" {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "url param is required."})
+		return
+	}
+
+	timestamp := c.Query("timestamp")
+	if timestamp == "" {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "timestamp param is required."})
+		return
+	}
+	render, ok := hashRenderer(c)
+	if !ok {
+		return
+	}
+
+	simhashes, err := utils.SimhashesAt(h.redisClient, url, []string{timestamp})
+	if err != nil {
+		respond(c, http.StatusAccepted, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+	stored, ok := simhashes[timestamp]
+	if !ok {
+		respond(c, http.StatusAccepted, gin.H{"status": "error", "message": "CAPTURE_NOT_FOUND"})
+		return
+	}
+	hash, err := simhash.Decode(stored, simhash.EncodingBase64)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+
+	maxDistance, ok := distanceParam(c, len(hash)*8, len(hash)*8/16)
+	if !ok {
+		return
+	}
+
+	tree, err := h.urlTree(url, "")
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	matches := tree.Search(hash, maxDistance)
+	if matches == nil {
+		matches = []bktree.Result{}
+	}
+	if stored, err = render(stored); err != nil {
+		internalError(c, err)
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"timestamp":    timestamp,
+		"simhash":      stored,
+		"distance":     maxDistance,
+		"simhash_size": len(hash) * 8,
+		"captures":     matches,
+	})
+}
+
+// GetClusters groups the captures of a URL, optionally within a year, into
+// clusters of near-identical versions.
+func (h *Handler) GetClusters(c *gin.Context) {
+	url := urlParam(c)
+	if url == "" {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "url param is required."})
+		return
+	}
+	year := c.Query("year")
+
+	size, ok := h.simhashSize(c, url)
+	if !ok {
+		return
+	}
+	maxDistance, ok := distanceParam(c, size, size/16)
+	if !ok {
+		return
+	}
+
+	tree, err := h.urlTree(url, year)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	if tree.Len() == 0 {
+		respond(c, http.StatusAccepted, gin.H{"status": "error", "message": "NO_CAPTURES"})
+		return
+	}
+	clusters := tree.Clusters(maxDistance)
+
+	respond(c, http.StatusOK, gin.H{
+		"distance":       maxDistance,
+		"simhash_size":   size,
+		"total_captures": tree.Len(),
+		"total_clusters": len(clusters),
+		"clusters":       clusters,
+	})
+}
+
+// urlTree returns the BK-tree over the stored simhashes of url, restricted to
+// captures whose timestamp starts with year when it is not empty. Trees are
+// cached until the stored simhashes of the URL change.
+func (h *Handler) urlTree(url, year string) (*bktree.Tree, error) {
+	revision, err := utils.StoredRevision(h.redisClient, url)
+	if err != nil {
+		return nil, err
+	}
+	key := utils.Surt(url) + " " + year
+	if tree, ok := h.trees.Get(key, revision); ok {
+		return tree, nil
+	}
+
+	simhashes, err := utils.AllSimhashes(h.redisClient, url)
+	if err != nil {
+		return nil, err
+	}
+	tree := bktree.New()
+	for ts, stored := range simhashes {
+		if !strings.HasPrefix(ts, year) {
+			continue
+		}
+		hash, err := simhash.Decode(stored, simhash.EncodingBase64)
+		if err != nil {
+			continue
+		}
+		tree.Insert(hash, ts)
+	}
+	h.trees.Put(key, revision, tree)
+	return tree, nil
+}
+
+// distanceParam parses the optional distance query param for simhashes of
+// size bits, defaulting to def. It writes a 400 response and returns false
+// when the param is invalid.
+func distanceParam(c *gin.Context, size, def int) (int, bool) {
+	distanceStr := c.Query("distance")
+	if distanceStr == "" {
+		return def, true
+	}
+	distance, err := strconv.Atoi(distanceStr)
+	if err != nil || distance < 0 || distance > size {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "distance must be a number between 0 and the simhash size."})
+		return 0, false
+	}
+	return distance, true
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/pb"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gin-gonic/gin/render"
+	"github.com/ugorji/go/codec"
+	"google.golang.org/protobuf/proto"
+)
+
+// Binary media types of responses, negotiated through the Accept header or
+// the format param.
+const (
+	MIME_MSGPACK  = "application/msgpack"
+	MIME_CBOR     = "application/cbor"
+	MIME_PROTOBUF = "application/protobuf"
+)
+
+// respond writes obj with code as JSON, or as MessagePack or CBOR when the
+// client asks for it with the Accept header or with format=msgpack or
+// format=cbor. Binary encodings carry the same structures as JSON and are
+// smaller and faster to parse for backend consumers of large year results.
+func respond(c *gin.Context, code int, obj any) {
+	c.Writer.Header().Add("Vary", "Accept")
+	obj = shapeFields(c, code, obj)
+	switch responseFormat(c) {
+	case "msgpack":
+		c.Render(code, render.MsgPack{Data: obj})
+	case "cbor":
+		c.Render(code, cborRender{data: obj})
+	case "protobuf":
+		// Only errors have a message of their own, successful responses
+		// of endpoints without one cannot be encoded.
+		body, ok := obj.(gin.H)
+		if !ok || code == http.StatusOK {
+			c.IndentedJSON(http.StatusNotAcceptable, gin.H{"status": "error", "info": "protobuf is not available for this endpoint."})
+			return
+		}
+		info, ok := body["info"]
+		if !ok {
+			info = body["message"]
+		}
+		c.Render(code, render.ProtoBuf{Data: &pb.Error{Status: fmt.Sprint(body["status"]), Info: fmt.Sprint(info)}})
+	default:
+		if pythonCompat(c) {
+			c.Render(code, flaskJSON{data: obj})
+			return
+		}
+		c.IndentedJSON(code, obj)
+	}
+}
+
+// respondMessage writes msg when the client asks for protobuf, and obj like
+// respond otherwise.
+func respondMessage(c *gin.Context, code int, obj any, msg proto.Message) {
+	c.Writer.Header().Add("Vary", "Accept")
+	if responseFormat(c) == "protobuf" {
+		c.Render(code, render.ProtoBuf{Data: msg})
+		return
+	}
+	respond(c, code, obj)
+}
+
+// responseFormat returns the encoding requested by the client: json,
+// msgpack, cbor or protobuf.
+func responseFormat(c *gin.Context) string {
+	switch format := c.Query("format"); format {
+	case "json", "msgpack", "cbor", "protobuf":
+		return format
+	}
+	switch c.NegotiateFormat(gin.MIMEJSON, MIME_MSGPACK, "application/x-msgpack", MIME_CBOR, MIME_PROTOBUF, binding.MIMEPROTOBUF) {
+	case MIME_MSGPACK, "application/x-msgpack":
+		return "msgpack"
+	case MIME_CBOR:
+		return "cbor"
+	case MIME_PROTOBUF, binding.MIMEPROTOBUF:
+		return "protobuf"
+	}
+	return "json"
+}
+
+var cborHandle = new(codec.CborHandle)
+
+// cborRender encodes a response as CBOR.
+type cborRender struct {
+	data any
+}
+
+func (r cborRender) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	return codec.NewEncoder(w, cborHandle).Encode(r.data)
+}
+
+func (r cborRender) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", MIME_CBOR)
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/apikeys"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/config"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/job"
+
+	"github.com/gin-gonic/gin"
+)
+
+// quotaError reports a calculation refused because its API key used up a
+// limit of its quota.
+type quotaError struct {
+	key, limit string
+	value      int
+}
+
+func (e *quotaError) Error() string {
+	return fmt.Sprintf("api key %s is limited to %d %s.", e.key, e.value, e.limit)
+}
+
+// admit applies the quota of key to a job calculating url and year: the
+// captures of the job are capped, and a new job is refused with a
+// *quotaError when the key runs too many jobs at once or started too many
+// today. Joining a pending job is always admitted.
+func (h *Handler) admit(ctx context.Context, key apikeys.Key, url, year string, opts *job.Options) error {
+	quota := h.apiKeys.QuotaOf(key)
+	opts.APIKey = key.Name
+	opts.MaxCaptures = quota.CapturesPerJob
+
+	if task := h.getActiveTask(url, year); task != nil && task.State().Running() {
+		return nil
+	}
+	if quota.ConcurrentJobs > 0 && h.pendingJobsOf(key.Name) >= quota.ConcurrentJobs {
+		return &quotaError{key: key.Name, limit: "concurrent jobs", value: quota.ConcurrentJobs}
+	}
+	counted, err := h.apiKeys.CountJob(ctx, key.Name, quota.JobsPerDay)
+	if err != nil {
+		return err
+	} else if !counted {
+		return &quotaError{key: key.Name, limit: "jobs per day", value: quota.JobsPerDay}
+	}
+	return nil
+}
+
+// pendingJobsOf returns the number of jobs of the API key called name that
+// are still running on this instance. Job groups are not counted, their
+// children are.
+func (h *Handler) pendingJobsOf(name string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	n := 0
+	for _, j := range h.jobsMap {
+		if j.APIKey == name && !j.IsGroup() && j.State().Running() {
+			n++
+		}
+	}
+	return n
+}
+
+// requestAPIKey returns the API key of the request, if any.
+func requestAPIKey(c *gin.Context) (apikeys.Key, bool) {
+	key, ok := c.Get(apiKeyContextKey)
+	if !ok {
+		return apikeys.Key{}, false
+	}
+	return key.(apikeys.Key), true
+}
+
+// parseQuota reads a quota from the jobs_per_day, captures_per_job and
+// concurrent_jobs params. It returns nil when none is given.
+func parseQuota(c *gin.Context) (*config.Quota, error) {
+	var quota config.Quota
+	given := false
+	for param, limit := range map[string]*int{
+		"jobs_per_day":     &quota.JobsPerDay,
+		"captures_per_job": &quota.CapturesPerJob,
+		"concurrent_jobs":  &quota.ConcurrentJobs,
+	} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%s must be a non-negative integer.", param)
+		}
+		*limit = n
+		given = true
+	}
+	if !given {
+		return nil, nil
+	}
+	return &quota, nil
+}
+
+// SetAPIKeyQuota sets the quota of the API key named in the path, or resets
+// it to the default quota when no limit is given.
+func (h *Handler) SetAPIKeyQuota(c *gin.Context) {
+	name := c.Param("name")
+	quota, err := parseQuota(c)
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": err.Error()})
+		return
+	}
+	if err := h.apiKeys.SetQuota(c.Request.Context(), name, quota); err != nil {
+		apiKeyError(c, err)
+		return
+	}
+	respond(c, http.StatusOK, gin.H{"status": "ok", "name": name, "quota": quota})
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimit refuses requests over the rate of their client address or API
+// key with 429 and a Retry-After header. It runs after APIKeyAuth so the key
+// of the request is known. Requests are let through when Redis fails, so an
+// outage of the limiter does not take the API down with it.
+func (h *Handler) RateLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, _ := requestAPIKey(c)
+		ok, wait, err := h.rateLimiter.Allow(c.Request.Context(), c.ClientIP(), key.Name)
+		if err != nil {
+			slog.WarnContext(c.Request.Context(), "rate limiter failed", "error", err)
+		}
+		if !ok {
+			metrics.Add(metrics.RATE_LIMITED, 1)
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			c.Abort()
+			respond(c, http.StatusTooManyRequests, gin.H{"status": "error", "info": "rate limit exceeded, retry later."})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/utils"
+	"github.com/Yaxhveer/wayback-discover-diff-go/pkg/simhash"
+
+	"github.com/gin-gonic/gin"
+)
+
+// version is a distinct simhash of a URL and the captures sharing it.
+type version struct {
+	Simhash    string   `json:"simhash"`
+	Count      int      `json:"count"`
+	Timestamps []string `json:"timestamps"`
+}
+
+// GetDuplicates reports, for a URL and year, how many distinct versions exist
+// and which captures are exact duplicates of each other.
+func (h *Handler) GetDuplicates(c *gin.Context) {
+	url, year, ok := urlYearParams(c)
+	if !ok {
+		return
+	}
+	render, ok := hashRenderer(c)
+	if !ok {
+		return
+	}
+
+	captures, err := utils.YearSimhash(h.redisClient, url, year, -1, -1)
+	if err != nil && len(captures) == 0 {
+		respond(c, http.StatusAccepted, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+	if len(captures) == 0 {
+		respond(c, http.StatusAccepted, gin.H{"status": "error", "message": "NO_CAPTURES"})
+		return
+	}
+
+	// captures are sorted by timestamp, so versions come out in order of first appearance
+	var versions []*version
+	bySimhash := make(map[string]*version)
+	for _, capture := range captures {
+		v, ok := bySimhash[capture.Simhash]
+		if !ok {
+			v = &version{Simhash: capture.Simhash}
+			bySimhash[capture.Simhash] = v
+			versions = append(versions, v)
+		}
+		v.Count++
+		v.Timestamps = append(v.Timestamps, capture.Timestamp)
+	}
+	for _, v := range versions {
+		if v.Simhash, err = render(v.Simhash); err != nil {
+			internalError(c, err)
+			return
+		}
+	}
+
+	duplicates := len(captures) - len(versions)
+	respond(c, http.StatusOK, gin.H{
+		"total_captures":     len(captures),
+		"distinct_versions":  len(versions),
+		"duplicate_captures": duplicates,
+		"duplicate_share":    float64(duplicates) / float64(len(captures)),
+		"versions":           versions,
+	})
+}
+
+// urlYearParams reads the required url and year query params. It writes a 400
+// response and returns false when either is missing or the url is invalid.
+func urlYearParams(c *gin.Context) (string, string, bool) {
+	url := c.Query("url")
+	if url == "" {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "url param is required."})
+		return "", "", false
+	} else if err := utils.CheckURL(url); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "invalid url, " + err.Error() + "."})
+		return "", "", false
+	}
+
+	year := c.Query("year")
+	if year == "" {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "year param is required."})
+		return "", "", false
+	}
+	return utils.InCollection(url, c.Query("collection")), year, true
+}
+
+// GetVolatility returns a normalized score of how often and how much the
+// simhash of a URL changes over a year, for consumers such as crawl
+// schedulers that need a single number rather than raw hashes.
+func (h *Handler) GetVolatility(c *gin.Context) {
+	url, year, ok := urlYearParams(c)
+	if !ok {
+		return
+	}
+
+	captures, err := utils.YearSimhash(h.redisClient, url, year, -1, -1)
+	if err != nil && len(captures) == 0 {
+		respond(c, http.StatusAccepted, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+
+	var pairs, changes int
+	var totalChange float64
+	var prev []byte
+	for _, capture := range captures {
+		hash, err := simhash.Decode(capture.Simhash, simhash.EncodingBase64)
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+		if prev != nil {
+			distance, err := simhash.Hamming(prev, hash)
+			if err != nil {
+				internalError(c, err)
+				return
+			}
+			pairs++
+			if distance > 0 {
+				changes++
+				totalChange += float64(distance) / float64(len(hash)*8)
+			}
+		}
+		prev = hash
+	}
+
+	// volatility = frequency * magnitude, i.e. the mean normalized distance
+	// between consecutive captures.
+	var frequency, magnitude, volatility float64
+	if pairs > 0 {
+		frequency = float64(changes) / float64(pairs)
+		volatility = totalChange / float64(pairs)
+	}
+	if changes > 0 {
+		magnitude = totalChange / float64(changes)
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"url":              url,
+		"year":             year,
+		"total_captures":   len(captures),
+		"changes":          changes,
+		"change_frequency": frequency,
+		"change_magnitude": magnitude,
+		"volatility":       volatility,
+	})
+}
+
+// calendarDay aggregates the captures of a single day.
+type calendarDay struct {
+	Date           string `json:"date"`
+	Captures       int    `json:"captures"`
+	DistinctHashes int    `json:"distinct_hashes"`
+	// MaxDistance is the largest distance between a capture of the day and
+	// the last capture of the previous day with captures; nil on the first day.
+	MaxDistance *int `json:"max_distance"`
+}
+
+// GetCalendar returns per-day aggregates of a URL's captures in a year,
+// shaped for rendering a heat-map calendar.
+func (h *Handler) GetCalendar(c *gin.Context) {
+	url, year, ok := urlYearParams(c)
+	if !ok {
+		return
+	}
+
+	captures, err := utils.YearSimhash(h.redisClient, url, year, -1, -1)
+	if err != nil && len(captures) == 0 {
+		respond(c, http.StatusAccepted, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+
+	days := make([]*calendarDay, 0)
+	var day *calendarDay
+	var distinct map[string]struct{}
+	var prevDayLast, last []byte
+	for _, capture := range captures {
+		hash, err := simhash.Decode(capture.Simhash, simhash.EncodingBase64)
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+
+		date := capture.Timestamp[:4] + "-" + capture.Timestamp[4:6] + "-" + capture.Timestamp[6:8]
+		if day == nil || day.Date != date {
+			day = &calendarDay{Date: date}
+			days = append(days, day)
+			distinct = make(map[string]struct{})
+			prevDayLast = last
+		}
+
+		day.Captures++
+		distinct[capture.Simhash] = struct{}{}
+		day.DistinctHashes = len(distinct)
+		if prevDayLast != nil {
+			if distance, err := simhash.Hamming(prevDayLast, hash); err == nil && (day.MaxDistance == nil || distance > *day.MaxDistance) {
+				day.MaxDistance = &distance
+			}
+		}
+		last = hash
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"url":            url,
+		"year":           year,
+		"total_captures": len(captures),
+		"days":           days,
+	})
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/job"
+	"github.com/Yaxhveer/wayback-discover-diff-go/pkg/simhash"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SaveCapture starts a job capturing the url param now with Save Page Now,
+// then calculating and storing the simhash of the new capture.
+func (h *Handler) SaveCapture(c *gin.Context) {
+	if h.spn == nil {
+		respond(c, http.StatusNotFound, gin.H{"status": "error", "info": "save page now is disabled."})
+		return
+	}
+	url := c.Query("url")
+	if url == "" {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "url param is required."})
+		return
+	}
+	if c.Query("collection") != "" {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "collection param is not supported, save page now captures go to the Wayback Machine."})
+		return
+	}
+	if h.routeToOwner(c, url) {
+		return
+	}
+	simhashSize, extractor, ok := h.calculationParams(c)
+	if !ok {
+		return
+	}
+
+	override := c.Query("override") == "true" || c.Query("override") == "1"
+	opts, err := h.jobOptions(url, simhashSize, extractor, override)
+	var conflict *conflictError
+	if errors.As(err, &conflict) {
+		respond(c, http.StatusConflict, gin.H{"status": "error", "info": conflict.Error()})
+		return
+	} else if err != nil {
+		internalError(c, err)
+		return
+	}
+	year := time.Now().UTC().Format("2006")
+	if key, ok := requestAPIKey(c); ok {
+		var quota *quotaError
+		if err := h.admit(c.Request.Context(), key, url, year, &opts); errors.As(err, &quota) {
+			respond(c, http.StatusTooManyRequests, gin.H{"status": "error", "info": quota.Error()})
+			return
+		} else if err != nil {
+			internalError(c, err)
+			return
+		}
+	}
+
+	j := job.NewJob()
+	jobID := j.RunSnapshot(c.Request.Context(), h.redisClient, url, opts, h.spn.Save)
+	h.mu.Lock()
+	h.jobsMap[jobID] = j
+	h.mu.Unlock()
+	h.recordOwner(jobID, url, year)
+	h.recordAudit(c, url, year, jobID, "STARTED")
+
+	respond(c, http.StatusAccepted, gin.H{
+		"status":       "STARTED",
+		"job_id":       jobID,
+		"simhash_size": simhashSize,
+		"algo":         simhash.Algorithm(simhashSize),
+		"extractor":    extractor,
+	})
+}
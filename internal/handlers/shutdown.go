@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/job"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/utils"
+)
+
+// JOB_RECORD_TTL is how long the shutdown outcome of a job is kept.
+const JOB_RECORD_TTL = 24 * time.Hour
+
+// CHECKPOINT_TIMEOUT bounds storing the partial results of one job.
+const CHECKPOINT_TIMEOUT = 5 * time.Second
+
+// DrainReport lists the jobs that were running at shutdown by outcome:
+// finished before the deadline, interrupted with their partial results
+// stored, or interrupted with nothing stored.
+type DrainReport struct {
+	Drained      []string `json:"drained"`
+	Checkpointed []string `json:"checkpointed"`
+	Abandoned    []string `json:"abandoned"`
+}
+
+// Drain waits until ctx is done for the running jobs to finish, then
+// checkpoints the ones still running. Each outcome is logged and written to
+// the job record in Redis.
+func (h *Handler) Drain(ctx context.Context) DrainReport {
+	h.mu.RLock()
+	var running []*job.Job
+	for _, j := range h.jobsMap {
+		if j.State().Running() {
+			running = append(running, j)
+		}
+	}
+	h.mu.RUnlock()
+
+	var report DrainReport
+	for _, j := range running {
+		outcome := "drained"
+		select {
+		case <-j.Done():
+		case <-ctx.Done():
+			outcome = h.interrupt(j)
+		}
+
+		switch outcome {
+		case "drained":
+			report.Drained = append(report.Drained, j.ID)
+		case "checkpointed":
+			report.Checkpointed = append(report.Checkpointed, j.ID)
+		default:
+			report.Abandoned = append(report.Abandoned, j.ID)
+		}
+		slog.Info("job shutdown", "job_id", j.ID, "url", j.URL, "year", j.Year, "outcome", outcome)
+
+		err := utils.SaveJob(h.redisClient, j.ID, map[string]any{
+			"url":      j.URL,
+			"year":     j.Year,
+			"state":    string(j.State()),
+			"info":     j.Info(),
+			"shutdown": outcome,
+		}, JOB_RECORD_TTL)
+		if err != nil {
+			slog.Warn("cannot record job shutdown", "job_id", j.ID, "error", err)
+		}
+	}
+	return report
+}
+
+// interrupt stores the partial results of a job that did not finish in time
+// and marks it failed. It returns "checkpointed" when results were stored and
+// "abandoned" otherwise.
+func (h *Handler) interrupt(j *job.Job) string {
+	ctx, cancel := context.WithTimeout(context.Background(), CHECKPOINT_TIMEOUT)
+	defer cancel()
+
+	n, err := j.Checkpoint(ctx)
+	if err != nil {
+		slog.Warn("cannot checkpoint job", "job_id", j.ID, "error", err)
+	}
+	if n == 0 {
+		j.Revoke("Job interrupted by shutdown")
+		return "abandoned"
+	}
+	j.Revoke("Job interrupted by shutdown, partial results stored")
+	return "checkpointed"
+}
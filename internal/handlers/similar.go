@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/lsh"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/utils"
+	"github.com/Yaxhveer/wayback-discover-diff-go/pkg/simhash"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetSimilar returns captures of other URLs whose simhash is within a hamming
+// distance of the given capture, looked up in the LSH index. The simhash of
+// the capture is rendered with the encoding and format params.
+func (h *Handler) GetSimilar(c *gin.Context) {
+	url := urlParam(c)
+	if url == "" {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "url param is required."})
+		return
+	}
+
+	timestamp := c.Query("timestamp")
+	if timestamp == "" {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "timestamp param is required."})
+		return
+	}
+	render, ok := hashRenderer(c)
+	if !ok {
+		return
+	}
+
+	simhashes, err := utils.SimhashesAt(h.redisClient, url, []string{timestamp})
+	if err != nil {
+		respond(c, http.StatusAccepted, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+	stored, ok := simhashes[timestamp]
+	if !ok {
+		respond(c, http.StatusAccepted, gin.H{"status": "error", "message": "CAPTURE_NOT_FOUND"})
+		return
+	}
+	hash, err := simhash.Decode(stored, simhash.EncodingBase64)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+
+	size := len(hash) * 8
+	maxDistance, ok := distanceParam(c, size, lsh.MaxGuaranteedDistance(size))
+	if !ok {
+		return
+	}
+
+	matches, err := lsh.Query(c.Request.Context(), h.redisClient, hash, maxDistance, "")
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	if stored, err = render(stored); err != nil {
+		internalError(c, err)
+		return
+	}
+	similar := make([]lsh.Match, 0, len(matches))
+	for _, m := range matches {
+		if utils.Surt(m.URL) != utils.Surt(url) {
+			similar = append(similar, m)
+		}
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"url":          url,
+		"timestamp":    timestamp,
+		"simhash":      stored,
+		"distance":     maxDistance,
+		"exact":        maxDistance <= lsh.MaxGuaranteedDistance(size),
+		"simhash_size": size,
+		"captures":     similar,
+	})
+}
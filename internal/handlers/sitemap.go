@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/job"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/utils"
+	"github.com/Yaxhveer/wayback-discover-diff-go/pkg/simhash"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CalculateSitemap starts a job listing the URLs of the sitemap in the url
+// param, live or archived at the timestamp param, and calculating each of
+// them in year. The job reports the progress of its child jobs.
+func (h *Handler) CalculateSitemap(c *gin.Context) {
+	sitemapURL := c.Query("url")
+	if sitemapURL == "" {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "url param is required."})
+		return
+	}
+	year := c.Query("year")
+	if year == "" {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "year param is required."})
+		return
+	}
+	simhashSize, extractor, ok := h.calculationParams(c)
+	if !ok {
+		return
+	}
+	override := c.Query("override") == "true" || c.Query("override") == "1"
+
+	opts := job.Options{SimhashSize: simhashSize, Extractor: extractor, Events: h.events, Notifier: h.notifier}
+	key := groupAPIKey(c, &opts)
+
+	start := h.startChild(simhashSize, extractor, override, key)
+	if collection := c.Query("collection"); collection != "" {
+		// The URLs of the sitemap are calculated in the collection.
+		startInWeb := start
+		start = func(ctx context.Context, child job.Child) (*job.Job, error) {
+			child.URL = utils.InCollection(child.URL, collection)
+			return startInWeb(ctx, child)
+		}
+	}
+	j := job.NewJob()
+	jobID := j.RunSitemap(c.Request.Context(), h.redisClient, sitemapURL, c.Query("timestamp"), year, opts, start)
+	h.registerGroup(c, j, sitemapURL, year)
+
+	respond(c, http.StatusAccepted, gin.H{
+		"status":       "STARTED",
+		"job_id":       jobID,
+		"group_id":     jobID,
+		"simhash_size": simhashSize,
+		"algo":         simhash.Algorithm(simhashSize),
+		"extractor":    extractor,
+	})
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/job"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetStats reports the process counters, with the hit ratios of the digest
+// dedup cache and the feature hash cache, so cache sizes can be tuned.
+func (h *Handler) GetStats(c *gin.Context) {
+	counters := metrics.Snapshot()
+	workerLimit, workersActive := job.WorkerLimit()
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"counters":               counters,
+		"digest_cache_hit_ratio": metrics.Ratio(counters[metrics.DIGEST_CACHE_HITS], counters[metrics.DIGEST_CACHE_MISSES]),
+		"hash_cache_hit_ratio":   metrics.Ratio(counters[metrics.HASH_CACHE_HITS], counters[metrics.HASH_CACHE_MISSES]),
+		"running_jobs":           job.RunningJobs(),
+		"active_downloads":       job.ActiveDownloads(),
+		"workers_active":         workersActive,
+		"in_flight_bytes":        job.InFlightBytes(),
+		"worker_limit":           workerLimit,
+		"cluster_members":        h.cluster.Members(),
+	})
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/audit"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/job"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/utils"
+	"github.com/Yaxhveer/wayback-discover-diff-go/pkg/simhash"
+)
+
+// Submit validates a calculation request received outside of HTTP, e.g.
+// from a message queue, and starts its job like /calculate-simhash does.
+// source identifies the origin of the request in the audit log. It returns
+// the ID of the started or already pending job.
+func (h *Handler) Submit(ctx context.Context, source, url, year string, simhashSize int, extractor string, override bool) (string, error) {
+	if err := utils.CheckURL(url); err != nil {
+		return "", fmt.Errorf("invalid url %q, %w", url, err)
+	}
+	if !utils.YearIsValid(year) {
+		return "", fmt.Errorf("invalid year %q", year)
+	}
+	if simhashSize == 0 {
+		simhashSize = h.cfg.Simhash.Size
+	} else if !simhash.ValidSize(simhashSize) {
+		return "", fmt.Errorf("invalid simhash_size %d", simhashSize)
+	}
+	if extractor == "" {
+		extractor = job.ExtractorDefault
+	} else if !job.ValidExtractor(extractor) {
+		return "", fmt.Errorf("invalid extractor %q", extractor)
+	}
+
+	if owner, local := h.cluster.Owner(utils.Surt(url)); !local {
+		return h.forward(ctx, owner, url, year, simhashSize, extractor, override)
+	}
+
+	opts, err := h.jobOptions(url, simhashSize, extractor, override)
+	if err != nil {
+		return "", err
+	}
+	jobID, started := h.startJob(ctx, url, year, opts)
+	status := "STARTED"
+	if !started {
+		status = "PENDING"
+	}
+	h.writeAudit(ctx, audit.Entry{ClientIP: source, URL: url, Year: year, JobID: jobID, Status: status})
+	return jobID, nil
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/usage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// USAGE_DAYS is the default window of usage reports, in days.
+const USAGE_DAYS = 30
+
+// usageDays reads the days param, bounded by the usage retention. It
+// answers 400 and returns false when it is invalid.
+func usageDays(c *gin.Context) (int, bool) {
+	days := USAGE_DAYS
+	if daysStr := c.Query("days"); daysStr != "" {
+		n, err := strconv.Atoi(daysStr)
+		if err != nil || n <= 0 || n > int(usage.RETENTION.Hours()/24) {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"status": "error", "info": "days must be between 1 and 90."})
+			return 0, false
+		}
+		days = n
+	}
+	return days, true
+}
+
+// GetUsage reports the jobs, captures and bytes consumed by the API key of
+// the request per day.
+func (h *Handler) GetUsage(c *gin.Context) {
+	key, _ := requestAPIKey(c)
+	days, ok := usageDays(c)
+	if !ok {
+		return
+	}
+	daily, total, err := usage.Query(c.Request.Context(), h.redisClient, key.Name, days)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"api_key": key.Name,
+		"quota":   h.apiKeys.QuotaOf(key),
+		"total":   total,
+		"days":    daily,
+	})
+}
+
+// GetAllUsage reports the usage of every API key, or of the one named by the
+// api_key param, per day.
+func (h *Handler) GetAllUsage(c *gin.Context) {
+	days, ok := usageDays(c)
+	if !ok {
+		return
+	}
+	keys, err := h.apiKeys.List(c.Request.Context())
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+
+	report := gin.H{}
+	for _, key := range keys {
+		if name := c.Query("api_key"); name != "" && key.Name != name {
+			continue
+		}
+		daily, total, err := usage.Query(c.Request.Context(), h.redisClient, key.Name, days)
+		if err != nil {
+			internalError(c, err)
+			return
+		}
+		report[key.Name] = gin.H{"total": total, "days": daily}
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"keys": report, "count": len(report)})
+}
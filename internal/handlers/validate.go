@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ValidateParams rejects requests whose url, year, timestamp, compare or
+// collection params are malformed with a 400 naming the param, before any handler turns
+// them into empty CDX queries or meaningless jobs. Handlers still check that
+// the params they require are present.
+//
+// Timestamps address single captures and have 14 digits, but for the
+// timestamp of /calculate-sitemap, which reads the captures of the sitemap
+// closest to it and accepts a prefix.
+func ValidateParams() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if url := c.Query("url"); url != "" {
+			if err := utils.CheckURL(url); err != nil {
+				invalidParam(c, "url", url, err.Error()+".")
+				return
+			}
+		}
+		if year := c.Query("year"); year != "" && !utils.YearIsValid(year) {
+			invalidParam(c, "year", year, fmt.Sprintf("must be a year from %d to %d.", utils.MIN_YEAR, time.Now().UTC().Year()))
+			return
+		}
+		if ts := c.Query("timestamp"); ts != "" {
+			if c.FullPath() == "/calculate-sitemap" {
+				if !utils.TimestampIsValid(ts) {
+					invalidParam(c, "timestamp", ts, "must be a 14-digit timestamp or a prefix of one, e.g. 20200115093000 or 202001.")
+					return
+				}
+			} else if !utils.CaptureTimestampIsValid(ts) {
+				invalidParam(c, "timestamp", ts, "must be a 14-digit timestamp, e.g. 20200115093000.")
+				return
+			}
+		}
+		if collection := c.Query("collection"); collection != "" && !utils.CollectionIsValid(collection) {
+			invalidParam(c, "collection", collection, "must be the numeric ID of an Archive-It collection, e.g. 1234.")
+			return
+		}
+		if compare := c.Query("compare"); compare != "" {
+			for _, ts := range strings.Split(compare, ",") {
+				if !utils.CaptureTimestampIsValid(ts) {
+					invalidParam(c, "compare", ts, "must list 14-digit timestamps separated by commas.")
+					return
+				}
+			}
+		}
+		c.Next()
+	}
+}
+
+// invalidParam answers 400 for the param name whose value is invalid.
+func invalidParam(c *gin.Context, name, value, reason string) {
+	c.Abort()
+	respond(c, http.StatusBadRequest, gin.H{
+		"status": "error",
+		"info":   fmt.Sprintf("invalid %s param, %s", name, reason),
+		"param":  name,
+		"value":  value,
+	})
+}
+
+// urlParam returns the url param, scoped to the Archive-It collection of the
+// collection param when it is set.
+func urlParam(c *gin.Context) string {
+	return utils.Canonicalize(utils.InCollection(c.Query("url"), c.Query("collection")))
+}
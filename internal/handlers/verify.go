@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/job"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/utils"
+	"github.com/Yaxhveer/wayback-discover-diff-go/pkg/simhash"
+
+	"github.com/gin-gonic/gin"
+)
+
+// VerifySimhash re-downloads a capture, recomputes its simhash with the current
+// extractor and reports whether it matches the stored value. Both simhashes
+// are rendered with the encoding and format params.
+func (h *Handler) VerifySimhash(c *gin.Context) {
+	url := urlParam(c)
+	if url == "" {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "url param is required."})
+		return
+	}
+
+	timestamp := c.Query("timestamp")
+	if timestamp == "" {
+		respond(c, http.StatusBadRequest, gin.H{"status": "error", "info": "timestamp param is required."})
+		return
+	}
+	render, ok := hashRenderer(c)
+	if !ok {
+		return
+	}
+
+	simhashes, err := utils.SimhashesAt(h.redisClient, url, []string{timestamp})
+	if err != nil {
+		respond(c, http.StatusAccepted, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+	stored, ok := simhashes[timestamp]
+	if !ok {
+		respond(c, http.StatusAccepted, gin.H{"status": "error", "message": "CAPTURE_NOT_FOUND"})
+		return
+	}
+	storedBytes, err := simhash.Decode(stored, simhash.EncodingBase64)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	size := len(storedBytes) * 8
+
+	meta, err := utils.StoredMetadata(h.redisClient, url)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	extractor := meta.Extractor
+	if extractor == "" {
+		extractor = job.ExtractorDefault
+	}
+
+	j := job.NewJob()
+	computed, err := j.CalculateCapture(c.Request.Context(), url, timestamp, job.Options{SimhashSize: size, Extractor: extractor})
+	archived, downloaded := j.Archived(timestamp)
+	if err != nil {
+		body := gin.H{"status": "error", "message": err.Error()}
+		if downloaded {
+			body["archive"] = archived
+		}
+		respond(c, http.StatusBadGateway, body)
+		return
+	}
+	distance, err := simhash.HammingEncoded(stored, computed, simhash.EncodingBase64)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	if stored, err = render(stored); err == nil {
+		computed, err = render(computed)
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"url":          url,
+		"timestamp":    timestamp,
+		"simhash_size": size,
+		"extractor":    extractor,
+		"stored":       stored,
+		"computed":     computed,
+		"match":        distance == 0,
+		"distance":     distance,
+		"archive":      archived,
+	})
+}
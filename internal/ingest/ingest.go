@@ -0,0 +1,90 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/config"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/logging"
+	"github.com/nats-io/nats.go"
+)
+
+// Request is a calculation request read from the message queue.
+type Request struct {
+	URL         string `json:"url"`
+	Year        string `json:"year"`
+	SimhashSize int    `json:"simhash_size,omitempty"`
+	Extractor   string `json:"extractor,omitempty"`
+	Override    bool   `json:"override,omitempty"`
+	// RequestID is used to trace the job, one is derived from the message
+	// when empty.
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// SubmitFunc starts the job of a request and returns its ID.
+type SubmitFunc func(ctx context.Context, source string, r Request) (string, error)
+
+// Consumer reads calculation requests from a NATS subject and submits them.
+type Consumer struct {
+	conn *nats.Conn
+	sub  *nats.Subscription
+}
+
+// Start connects to the NATS server of cfg and subscribes to cfg.Subject in
+// the queue group cfg.Queue, so that several instances share the requests.
+// Messages are JSON encoded Requests. When the message has a reply subject
+// the job ID, or the error, is sent back.
+func Start(cfg config.IngestConfig, submit SubmitFunc) (*Consumer, error) {
+	conn, err := nats.Connect(cfg.URL, nats.Name("wayback-discover-diff"))
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to NATS at %s, %w", cfg.URL, err)
+	}
+
+	source := "nats:" + cfg.Subject
+	sub, err := conn.QueueSubscribe(cfg.Subject, cfg.Queue, func(msg *nats.Msg) {
+		reply := handle(msg.Data, source, submit)
+		if msg.Reply != "" {
+			msg.Respond(reply)
+		}
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("cannot subscribe to %s, %w", cfg.Subject, err)
+	}
+	slog.Info("consuming calculation requests", "url", cfg.URL, "subject", cfg.Subject, "queue", cfg.Queue)
+	return &Consumer{conn: conn, sub: sub}, nil
+}
+
+// handle submits a single message and returns the JSON reply.
+func handle(data []byte, source string, submit SubmitFunc) []byte {
+	var r Request
+	if err := json.Unmarshal(data, &r); err != nil {
+		slog.Warn("cannot decode calculation request", "source", source, "error", err)
+		return replyJSON("error", "", "invalid request, "+err.Error())
+	}
+
+	ctx := context.Background()
+	if r.RequestID != "" {
+		ctx = logging.WithRequestID(ctx, r.RequestID)
+	}
+	jobID, err := submit(ctx, source, r)
+	if err != nil {
+		slog.WarnContext(ctx, "cannot submit calculation request", "source", source, "url", r.URL, "year", r.Year, "error", err)
+		return replyJSON("error", "", err.Error())
+	}
+	slog.InfoContext(ctx, "calculation request submitted", "source", source, "url", r.URL, "year", r.Year, "job_id", jobID)
+	return replyJSON("STARTED", jobID, "")
+}
+
+func replyJSON(status, jobID, info string) []byte {
+	data, _ := json.Marshal(map[string]string{"status": status, "job_id": jobID, "info": info})
+	return data
+}
+
+// Close drains the subscription, letting in-flight messages finish, and
+// closes the connection.
+func (c *Consumer) Close() error {
+	return c.conn.Drain()
+}
@@ -0,0 +1,83 @@
+package job
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/metrics"
+)
+
+// downloadLimit bounds the captures a job downloads at once. With
+// adaptive_concurrency, its limit is halved when a download fails or is
+// slower than the target latency and grows back by one per limit downloads
+// answered in time, so that a job backs off while the archive struggles
+// instead of piling timeouts up at a fixed concurrency.
+type downloadLimit struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	active int
+	// limit is fractional so that it grows by 1/limit per download.
+	limit    float64
+	min, max int
+	// decreased is when the limit was last halved. Downloads started before
+	// then do not halve it again, a single slowdown usually fails several
+	// downloads at once.
+	decreased time.Time
+}
+
+func newDownloadLimit(max int) *downloadLimit {
+	l := &downloadLimit{limit: float64(max), min: max, max: max}
+	if settings.AdaptiveConcurrency.Enabled {
+		l.min = min(settings.AdaptiveConcurrency.Min, max)
+	}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// acquire waits for a download slot and returns when the download started.
+func (l *downloadLimit) acquire() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.active >= int(l.limit) {
+		l.cond.Wait()
+	}
+	l.active++
+	return time.Now()
+}
+
+// release frees the slot of a download started at start, adjusting the
+// limit to its latency and whether it failed.
+func (l *downloadLimit) release(start time.Time, latency time.Duration, failed bool) {
+	l.mu.Lock()
+	l.active--
+	switch {
+	case l.min == l.max:
+	case failed || latency > settings.AdaptiveConcurrency.TargetLatency:
+		if start.After(l.decreased) && int(l.limit) > l.min {
+			l.limit = max(float64(l.min), l.limit/2)
+			l.decreased = time.Now()
+			metrics.Add(metrics.CONCURRENCY_DECREASES, 1)
+		}
+	default:
+		l.limit = min(float64(l.max), l.limit+1/l.limit)
+	}
+	l.mu.Unlock()
+	l.cond.Broadcast()
+}
+
+// current returns the number of downloads allowed at once.
+func (l *downloadLimit) current() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// ConcurrencyLimit returns the number of captures the job currently
+// downloads at once, as lowered by adaptive_concurrency while the archive is
+// slow or failing, or 0 when it is not enabled.
+func (j *Job) ConcurrencyLimit() int {
+	if j.downloads == nil || !settings.AdaptiveConcurrency.Enabled {
+		return 0
+	}
+	return j.downloads.current()
+}
@@ -0,0 +1,89 @@
+package job
+
+import (
+	"net/http"
+	"strings"
+)
+
+// DATANODE_RETRIES is the number of times a capture is requested again when
+// Wayback answers 5xx, as the datanode holding it failed: first bypassing
+// the caches, then with the other http scheme of the archived URL.
+const DATANODE_RETRIES = 2
+
+// ArchiveHeaders holds the X-Archive-* headers of the answer of Wayback to the
+// download of a capture.
+type ArchiveHeaders struct {
+	// Src is the WARC or ARC file holding the capture, X-Archive-Src.
+	Src string `json:"src,omitempty"`
+	// GuessedContentType is the content type Wayback guessed for captures
+	// archived without one, X-Archive-Guessed-Content-Type.
+	GuessedContentType string `json:"guessed_content_type,omitempty"`
+	// OriginalStatus is the status code archived with the capture, which
+	// id_ replays answer with, 0 when the answer is not a replay.
+	OriginalStatus int `json:"original_status,omitempty"`
+	// Original holds the archived headers of the capture, the X-Archive-Orig-*
+	// headers without their prefix.
+	Original map[string]string `json:"original,omitempty"`
+}
+
+// parseArchiveHeaders reads the X-Archive-* headers of resp. Answers without
+// X-Archive-Src nor Memento-Datetime are pages of Wayback itself, such as
+// its error pages, rather than replays.
+func parseArchiveHeaders(resp *http.Response) ArchiveHeaders {
+	h := ArchiveHeaders{
+		Src:                resp.Header.Get("X-Archive-Src"),
+		GuessedContentType: resp.Header.Get("X-Archive-Guessed-Content-Type"),
+	}
+	if h.Src != "" || resp.Header.Get("Memento-Datetime") != "" {
+		h.OriginalStatus = resp.StatusCode
+	}
+	for name, values := range resp.Header {
+		if orig, ok := strings.CutPrefix(name, "X-Archive-Orig-"); ok && len(values) > 0 {
+			if h.Original == nil {
+				h.Original = make(map[string]string)
+			}
+			h.Original[strings.ToLower(orig)] = values[0]
+		}
+	}
+	return h
+}
+
+// contentType returns the content type of the capture, the one Wayback
+// guessed when it was archived without one.
+func (h ArchiveHeaders) contentType(resp *http.Response) string {
+	cType := resp.Header.Get("Content-Type")
+	if h.GuessedContentType != "" && (cType == "" || strings.HasPrefix(cType, "application/octet-stream") || strings.HasPrefix(cType, "unk")) {
+		return h.GuessedContentType
+	}
+	return cType
+}
+
+// otherScheme returns url with the other http scheme, https for URLs without
+// one. Wayback resolves both to the same capture, through a fresh lookup.
+func otherScheme(url string) string {
+	if rest, ok := strings.CutPrefix(url, "https://"); ok {
+		return "http://" + rest
+	}
+	if rest, ok := strings.CutPrefix(url, "http://"); ok {
+		return "https://" + rest
+	}
+	return "https://" + url
+}
+
+// Archived returns the X-Archive-* headers of the download of the capture at
+// timestamp, false when it was not downloaded. Only the headers of captures
+// downloaded outside of a job, such as by CalculateCapture, are kept.
+func (j *Job) Archived(timestamp string) (ArchiveHeaders, bool) {
+	j.resultsMu.Lock()
+	defer j.resultsMu.Unlock()
+	h, ok := j.archived[timestamp]
+	return h, ok
+}
+
+func (j *Job) setArchived(timestamp string, h ArchiveHeaders) {
+	j.resultsMu.Lock()
+	defer j.resultsMu.Unlock()
+	if j.archived != nil {
+		j.archived[timestamp] = h
+	}
+}
@@ -0,0 +1,56 @@
+package job
+
+import (
+	"sync"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/metrics"
+)
+
+// memoryBudget bounds the bytes of capture bodies held in memory across all
+// jobs. A download reserves the largest body it may read before starting and
+// blocks while the budget is exhausted.
+type memoryBudget struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	inFlight int64
+}
+
+var budget = func() *memoryBudget {
+	b := &memoryBudget{}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}()
+
+// InFlightBytes returns the bytes of capture bodies currently reserved.
+func InFlightBytes() int64 {
+	budget.mu.Lock()
+	defer budget.mu.Unlock()
+	return budget.inFlight
+}
+
+// reserve blocks until n bytes fit in the configured budget and reserves
+// them. A single reservation larger than the budget is let through once
+// nothing else is in flight, so it cannot block forever.
+func (b *memoryBudget) reserve(n int64) {
+	limit := int64(settings.MemoryBudgetMB) << 20
+	b.mu.Lock()
+	if limit > 0 && b.inFlight > 0 && b.inFlight+n > limit {
+		metrics.Add(metrics.MEMORY_BUDGET_WAITS, 1)
+		for b.inFlight > 0 && b.inFlight+n > limit {
+			b.cond.Wait()
+		}
+	}
+	b.inFlight += n
+	b.mu.Unlock()
+}
+
+// release returns n reserved bytes to the budget.
+func (b *memoryBudget) release(n int64) {
+	if n == 0 {
+		return
+	}
+	b.mu.Lock()
+	b.inFlight -= n
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
@@ -0,0 +1,29 @@
+package job
+
+import (
+	"bytes"
+	"sync"
+)
+
+// buffers holds the buffers captures are downloaded into, reused across the
+// captures of every job instead of allocating about a megabyte per capture.
+var buffers = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// getBuffer returns an empty buffer of the pool.
+func getBuffer() *bytes.Buffer {
+	buf := buffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// putBuffer returns buf to the pool. buf is not used afterwards, nor the
+// slices of its bytes. Buffers grown much larger than a download, e.g. by
+// other readers, are dropped.
+func putBuffer(buf *bytes.Buffer) {
+	if buf == nil || buf.Cap() > 2*MAP_CAPTURE_DOWNLOAD {
+		return
+	}
+	buffers.Put(buf)
+}
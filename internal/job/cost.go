@@ -0,0 +1,61 @@
+package job
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Cost is what a job cost and where it spent its time, answered by /job
+// once the job completed.
+type Cost struct {
+	// BytesDownloaded is the size of the captures downloaded.
+	BytesDownloaded int64 `json:"bytes_downloaded"`
+	// Downloads counts the captures whose download was attempted and
+	// DedupHits those whose simhash was reused from another capture with
+	// the same digest instead.
+	Downloads int64 `json:"downloads"`
+	DedupHits int64 `json:"dedup_hits"`
+	// Retries counts the download attempts repeated after an error.
+	Retries int64 `json:"retries"`
+	// AvgDownloadMS, AvgExtractMS and AvgSimhashMS are the average times
+	// per capture spent downloading, extracting features and hashing them.
+	AvgDownloadMS float64 `json:"avg_download_ms"`
+	AvgExtractMS  float64 `json:"avg_extract_ms"`
+	AvgSimhashMS  float64 `json:"avg_simhash_ms"`
+}
+
+// costs accumulates the Cost of a job as its captures are processed. The
+// times are in nanoseconds.
+type costs struct {
+	downloads, dedupHits, retries          atomic.Int64
+	extractions, hashes                    atomic.Int64
+	downloadTime, extractTime, simhashTime atomic.Int64
+}
+
+// since adds the time elapsed since start to total and counts it in n.
+func since(start time.Time, total, n *atomic.Int64) {
+	total.Add(int64(time.Since(start)))
+	n.Add(1)
+}
+
+// averageMS returns the average of total nanoseconds over n in milliseconds.
+func averageMS(total, n *atomic.Int64) float64 {
+	count := n.Load()
+	if count == 0 {
+		return 0
+	}
+	return float64(total.Load()) / float64(count) / float64(time.Millisecond)
+}
+
+// Cost returns what the job cost so far.
+func (j *Job) Cost() Cost {
+	return Cost{
+		BytesDownloaded: j.downloaded.Load(),
+		Downloads:       j.costs.downloads.Load(),
+		DedupHits:       j.costs.dedupHits.Load(),
+		Retries:         j.costs.retries.Load(),
+		AvgDownloadMS:   averageMS(&j.costs.downloadTime, &j.costs.downloads),
+		AvgExtractMS:    averageMS(&j.costs.extractTime, &j.costs.extractions),
+		AvgSimhashMS:    averageMS(&j.costs.simhashTime, &j.costs.hashes),
+	}
+}
@@ -0,0 +1,63 @@
+package job
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// encoded reports whether the body of resp is compressed with an encoding
+// decoded by readBody.
+func encoded(resp *http.Response) bool {
+	encoding := resp.Header.Get("Content-Encoding")
+	return strings.Contains(encoding, "gzip") || strings.Contains(encoding, "deflate")
+}
+
+// readBody reads the body of a capture download into a buffer of the pool,
+// decompressed according to its Content-Encoding and bounded to
+// MAP_CAPTURE_DOWNLOAD bytes before and after decompression.
+func readBody(resp *http.Response) (*bytes.Buffer, error) {
+	body := io.LimitReader(resp.Body, int64(MAP_CAPTURE_DOWNLOAD))
+	reader := body
+	if strings.Contains(resp.Header.Get("Content-Encoding"), "gzip") {
+		gzReader, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decompress gzip response, %w", err)
+		}
+		defer gzReader.Close()
+		reader = gzReader
+	} else if strings.Contains(resp.Header.Get("Content-Encoding"), "deflate") {
+		deflateReader := flate.NewReader(body)
+		defer deflateReader.Close()
+		reader = deflateReader
+	}
+
+	buf := getBuffer()
+	if _, err := buf.ReadFrom(io.LimitReader(reader, int64(MAP_CAPTURE_DOWNLOAD))); err != nil {
+		putBuffer(buf)
+		return nil, fmt.Errorf("cannot read response body, %w", err)
+	}
+	return buf, nil
+}
+
+// requestIdentity requests the capture at apiURL again with
+// Accept-Encoding: identity, for captures whose compressed answer cannot be
+// decoded, e.g. as it was archived with a corrupt gzip stream.
+func (j *Job) requestIdentity(ctx context.Context, apiURL string) (*http.Response, error) {
+	started := j.downloads.acquire()
+	req, err := j.generateGetRequest(ctx, apiURL)
+	if err != nil {
+		j.downloads.release(started, 0, false)
+		return nil, err
+	}
+	req.Header.Set("Accept-Encoding", "identity")
+	resp, err := j.httpClient.Do(req)
+	j.downloads.release(started, time.Since(started), err != nil || resp.StatusCode >= 500)
+	return resp, err
+}
@@ -0,0 +1,118 @@
+package job
+
+import (
+	"bytes"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/metrics"
+)
+
+// Reasons a downloaded capture is skipped instead of hashed.
+const (
+	// SKIP_ERROR_PAGE is a Wayback error page, e.g. of a capture missing
+	// from the archive or that cannot be replayed.
+	SKIP_ERROR_PAGE = "error_page"
+	// SKIP_REDIRECT_NOTICE is the notice shown for captures of redirects.
+	SKIP_REDIRECT_NOTICE = "redirect_notice"
+	// SKIP_EXCLUDED is the notice shown for URLs excluded from the archive.
+	SKIP_EXCLUDED = "excluded"
+	// SKIP_UNDECODABLE is a capture whose body cannot be decoded, even when
+	// requested without content encoding.
+	SKIP_UNDECODABLE = "undecodable"
+)
+
+// RUNTIME_ERROR_HEADER is set by Wayback on the error pages it answers.
+const RUNTIME_ERROR_HEADER = "X-Archive-Wayback-Runtime-Error"
+
+// redirectNotice matches the notice Wayback answers for captures of
+// redirects instead of following them.
+var redirectNotice = regexp.MustCompile(`Got an HTTP [0-9]{3} response at crawl time`)
+
+// exclusionNotices and errorNotices are the markers of the exclusion notices
+// and error pages of Wayback.
+var (
+	exclusionNotices = [][]byte{
+		[]byte("This URL has been excluded from the Wayback Machine"),
+		[]byte("Sorry. This URL has been excluded"),
+	}
+	errorNotices = [][]byte{
+		[]byte("The Wayback Machine has not archived that URL"),
+		[]byte("Wayback Machine doesn&apos;t have that page archived"),
+		[]byte("Wayback Machine doesn't have that page archived"),
+		[]byte("This snapshot cannot be displayed due to an internal error"),
+	}
+)
+
+// SkippedCapture is a capture that was downloaded but not hashed.
+type SkippedCapture struct {
+	// URL is set for the captures of the URLs matched by wildcard jobs.
+	URL       string `json:"url,omitempty"`
+	Timestamp string `json:"timestamp"`
+	Reason    string `json:"reason"`
+	// Status is the status code Wayback answered.
+	Status int `json:"status"`
+}
+
+// waybackPage returns why the answer of Wayback to the download of a capture
+// is one of its own pages rather than the capture, or "" for captures.
+func waybackPage(resp *http.Response, body []byte) string {
+	contains := func(markers [][]byte) bool {
+		return slices.ContainsFunc(markers, func(m []byte) bool { return bytes.Contains(body, m) })
+	}
+	switch {
+	case contains(exclusionNotices):
+		return SKIP_EXCLUDED
+	case redirectNotice.Match(body):
+		return SKIP_REDIRECT_NOTICE
+	case resp.Header.Get(RUNTIME_ERROR_HEADER) != "", resp.StatusCode >= 400, contains(errorNotices):
+		return SKIP_ERROR_PAGE
+	}
+	return ""
+}
+
+// skip records that the capture of url at timestamp was not hashed, Wayback
+// answering status.
+func (j *Job) skip(url, timestamp, reason string, status int) {
+	metrics.Add(metrics.CAPTURES_SKIPPED, 1)
+	j.logger.Info("skipping capture", "timestamp", timestamp, "reason", reason, "status", status)
+	s := SkippedCapture{Timestamp: timestamp, Reason: reason, Status: status}
+	if url != j.URL {
+		s.URL = url
+	}
+	j.resultsMu.Lock()
+	j.skipped = append(j.skipped, s)
+	j.resultsMu.Unlock()
+}
+
+// skippedCounts returns the number of captures skipped as pages of Wayback
+// and as undecodable.
+func (j *Job) skippedCounts() (pages, undecodable int) {
+	j.resultsMu.Lock()
+	defer j.resultsMu.Unlock()
+	for _, s := range j.skipped {
+		if s.Reason == SKIP_UNDECODABLE {
+			undecodable++
+		} else {
+			pages++
+		}
+	}
+	return pages, undecodable
+}
+
+// Skipped returns the captures downloaded but not hashed so far, sorted by
+// URL and timestamp.
+func (j *Job) Skipped() []SkippedCapture {
+	j.resultsMu.Lock()
+	skipped := slices.Clone(j.skipped)
+	j.resultsMu.Unlock()
+	slices.SortFunc(skipped, func(a, b SkippedCapture) int {
+		if c := strings.Compare(a.URL, b.URL); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Timestamp, b.Timestamp)
+	})
+	return skipped
+}
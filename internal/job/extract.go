@@ -1,112 +1,47 @@
 package job
 
 import (
-	"bytes"
-	"sort"
+	"io"
 	"strings"
 
-	"golang.org/x/net/html"
+	"github.com/Yaxhveer/wayback-discover-diff-go/pkg/extract"
+	"github.com/Yaxhveer/wayback-discover-diff-go/pkg/simhash"
 )
 
-// extractHTMLFeatures processes an HTML document and extracts key features as a map.
-func extractHTMLFeatures(htmlStr string) map[string]int {
-	// Parse HTML and remove script/style tags
-	doc, err := html.Parse(strings.NewReader(htmlStr))
-	if err != nil {
-		return nil
-	}
-
-	tagsToRemove := map[string]struct{}{
-		"script":   {},
-		"style":    {},
-		"noscript": {},
-		"meta":     {},
-		"img":      {},
-		"audio":    {},
-		"video":    {},
-	}
-
-	text := stripTags(doc, tagsToRemove)
-
-	// Process text: lowercase, remove punctuation, split into words
-	text = strings.ToLower(text)
-	text = removePunctuation(text)
-
-	lines := strings.Split(text, "\n")
-	for i := range lines {
-		lines[i] = strings.TrimSpace(lines[i])
-	}
-
-	var chunks []string
-	for _, line := range lines {
-		for _, phrase := range strings.Split(line, "  ") {
-			trimmed := strings.TrimSpace(phrase)
-			if trimmed != "" {
-				chunks = append(chunks, trimmed)
-			}
-		}
-	}
-
-	text = strings.Join(chunks, "\n")
-	words := strings.Fields(text)
-	sort.Strings(words)
-
-	wordCounts := make(map[string]int)
-	for i := 0; i < len(words); {
-		word := words[i]
-		count := 1
-		for i+count < len(words) && words[i+count] == word {
-			count++
-		}
-		wordCounts[word] = count
-		i += count
-	}
-
-	// wordCounts := make(map[string]int)
-	// words := strings.Fields(text)
-	// for _, word := range words {
-	// 	wordCounts[word]++
-	// }
+// Extractor profiles selecting how features are extracted from a capture.
+const (
+	ExtractorDefault  = "default"
+	ExtractorWeighted = "weighted"
+)
 
-	return wordCounts
+// ValidExtractor reports whether name is a known extractor profile.
+func ValidExtractor(name string) bool {
+	_, ok := extract.Profile(name)
+	return ok
 }
 
-func stripTags(doc *html.Node, tagsToRemove map[string]struct{}) string {
-	var buffer bytes.Buffer
-	var extractText func(*html.Node)
-	extractText = func(n *html.Node) {
-		if n.Type == html.TextNode {
-			buffer.WriteString(n.Data + " ")
-		} else if n.Type == html.ElementNode {
-			if _, found := tagsToRemove[n.Data]; found {
-				return
-			}
-		}
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			extractText(c)
-		}
+// HashDocument computes the simhash of an HTML document of size bits with
+// the named extractor profile, exactly as a job does for a capture, so
+// documents from other sources can be compared with stored captures. Like a
+// download, only the first MAP_CAPTURE_DOWNLOAD bytes are considered.
+func HashDocument(doc string, size int, extractor string) (string, error) {
+	if len(doc) > MAP_CAPTURE_DOWNLOAD {
+		doc = doc[:MAP_CAPTURE_DOWNLOAD]
 	}
-
-	extractText(doc)
-	return strings.TrimSpace(buffer.String())
+	features := extractFeatures(strings.NewReader(doc), extractor)
+	if len(features) == 0 {
+		return "", extract.ErrNoFeatures
+	}
+	return simhash.GetSimhash(features, size), nil
 }
 
-// removePunctuation removes punctuation from a string.
-func removePunctuation(s string) string {
-	var b strings.Builder
-	punct := map[rune]struct{}{
-		'!': {}, '"': {}, '#': {}, '$': {}, '%': {}, '&': {}, '\'': {},
-		'(': {}, ')': {}, '*': {}, '+': {}, ',': {}, '-': {}, '.': {},
-		'/': {}, ':': {}, ';': {}, '<': {}, '=': {}, '>': {}, '?': {},
-		'@': {}, '[': {}, '\\': {}, ']': {}, '^': {}, '_': {}, '`': {},
-		'{': {}, '|': {}, '}': {}, '~': {},
-	}
-	for _, r := range s {
-		if _, exists := punct[r]; exists {
-			b.WriteRune(' ')
-		} else {
-			b.WriteRune(r)
-		}
+// extractFeatures extracts the features of the HTML document read from r
+// with the named profile, nil when it has none.
+func extractFeatures(r io.Reader, extractor string) map[string]int {
+	opts, ok := extract.Profile(extractor)
+	if !ok {
+		opts = extract.Default
 	}
-	return b.String()
+	features, _ := extract.Features(r, opts)
+	return features
 }
@@ -0,0 +1,241 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/events"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/sitemap"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// GROUP_PARALLEL is the number of child jobs of a group running at once.
+const GROUP_PARALLEL = 4
+
+// Child is a calculation started by a job group.
+type Child struct {
+	URL  string `json:"url"`
+	Year string `json:"year"`
+}
+
+// ChildStatus is the state of a child job of a group.
+type ChildStatus struct {
+	JobID  string `json:"job_id"`
+	URL    string `json:"url"`
+	Year   string `json:"year"`
+	Status State  `json:"status"`
+}
+
+// ChildFailure is a child of a group that could not be started or failed.
+type ChildFailure struct {
+	JobID string `json:"job_id,omitempty"`
+	URL   string `json:"url"`
+	Year  string `json:"year"`
+	Info  string `json:"info"`
+}
+
+// GroupStatus aggregates the child jobs of a group.
+type GroupStatus struct {
+	Total int `json:"total"`
+	// Counts is the number of children in each state. Children not started
+	// yet are PENDING.
+	Counts map[State]int `json:"counts"`
+	// Progress is the share of the children that are done, from 0 to 1.
+	Progress float64        `json:"progress"`
+	Failures []ChildFailure `json:"failures"`
+	Children []ChildStatus  `json:"children"`
+}
+
+// group holds the children of a job group.
+type group struct {
+	total    int
+	children []*Job
+	failed   []ChildFailure
+}
+
+// IsGroup reports whether j is a job group.
+func (j *Job) IsGroup() bool {
+	j.stateMu.Lock()
+	defer j.stateMu.Unlock()
+	return j.group != nil
+}
+
+// Children returns the jobs started by a group, in the order they were
+// started.
+func (j *Job) Children() []*Job {
+	j.stateMu.Lock()
+	defer j.stateMu.Unlock()
+	if j.group == nil {
+		return nil
+	}
+	return slices.Clone(j.group.children)
+}
+
+// Group returns the aggregated state of the children of a group, nil for
+// other jobs.
+func (j *Job) Group() *GroupStatus {
+	j.stateMu.Lock()
+	if j.group == nil {
+		j.stateMu.Unlock()
+		return nil
+	}
+	total := j.group.total
+	children := slices.Clone(j.group.children)
+	failures := slices.Clone(j.group.failed)
+	j.stateMu.Unlock()
+
+	status := &GroupStatus{Total: total, Counts: make(map[State]int), Children: make([]ChildStatus, len(children))}
+	done := len(failures)
+	status.Counts[FAILURE] += len(failures)
+	for i, child := range children {
+		state := child.State()
+		status.Children[i] = ChildStatus{JobID: child.ID, URL: child.URL, Year: child.Year, Status: state}
+		status.Counts[state]++
+		if !state.Running() {
+			done++
+		}
+		if state == FAILURE || state == REVOKED {
+			status.Failures = append(status.Failures, ChildFailure{JobID: child.ID, URL: child.URL, Year: child.Year, Info: child.Info()})
+		}
+	}
+	status.Failures = append(status.Failures, failures...)
+	status.Counts[PENDING] += total - len(children) - len(failures)
+	maps.DeleteFunc(status.Counts, func(_ State, n int) bool { return n == 0 })
+	if total > 0 {
+		status.Progress = float64(done) / float64(total)
+	}
+	return status
+}
+
+// RunGroup executes a new job that starts a child job for each of children
+// with start, GROUP_PARALLEL at a time, and aggregates their progress. name
+// identifies the group in its logs and events. It returns the job_id, which
+// is also the group_id. The job outlives ctx.
+func (j *Job) RunGroup(ctx context.Context, redisClient *redis.Client, name string, children []Child, opts Options, start func(context.Context, Child) (*Job, error)) string {
+	jobID := j.init(ctx, redisClient, name, "", opts)
+	j.group = &group{}
+	j.setInfo(fmt.Sprintf("Starting %d jobs", len(children)))
+	j.runGroup(ctx, opts, func(context.Context) ([]Child, error) { return children, nil }, start)
+	return jobID
+}
+
+// RunSitemap executes a new job group that lists the URLs of the sitemap at
+// sitemapURL, read from its capture closest to timestamp when not empty, and
+// calculates each of them in year with start. It returns the job_id, which
+// is also the group_id. The job outlives ctx.
+func (j *Job) RunSitemap(ctx context.Context, redisClient *redis.Client, sitemapURL, timestamp, year string, opts Options, start func(context.Context, Child) (*Job, error)) string {
+	jobID := j.init(ctx, redisClient, sitemapURL, year, opts)
+	j.group = &group{}
+	j.setInfo(fmt.Sprintf("Fetching sitemap %s", sitemapURL))
+	list := func(ctx context.Context) ([]Child, error) {
+		urls, err := sitemap.Fetch(ctx, j.httpClient, sitemapURL, timestamp, ReplayURL)
+		if err != nil {
+			return nil, err
+		}
+		children := make([]Child, len(urls))
+		for i, u := range urls {
+			children[i] = Child{URL: u, Year: year}
+		}
+		return children, nil
+	}
+	j.runGroup(ctx, opts, list, start)
+	return jobID
+}
+
+// runGroup lists the children of a group with list, then starts and waits
+// for them. The group succeeds unless every child failed.
+func (j *Job) runGroup(ctx context.Context, opts Options, list func(context.Context) ([]Child, error), start func(context.Context, Child) (*Job, error)) {
+	ctx = context.WithoutCancel(ctx)
+	runningJobs.Add(1)
+	go func() {
+		defer close(j.done)
+		defer runningJobs.Add(-1)
+		defer func() {
+			if r := recover(); r != nil {
+				j.setState(FAILURE)
+				j.setInfo(fmt.Sprintf("job failed unexpectedly, %v", r))
+				j.recovered(ctx, r, "")
+				j.publish(ctx, opts.Events, events.Event{Type: events.JOB_FAILED, Info: j.Info()})
+			}
+		}()
+
+		j.setState(STARTED)
+		children, err := list(ctx)
+		if err != nil {
+			j.setState(FAILURE)
+			j.setInfo(err.Error())
+			j.logger.Error("cannot list jobs of group", "error", err)
+			j.report(ctx, err, "")
+			j.publish(ctx, opts.Events, events.Event{Type: events.JOB_FAILED, Info: j.Info()})
+			return
+		}
+
+		total := len(children)
+		j.stateMu.Lock()
+		j.group.total = total
+		j.stateMu.Unlock()
+		j.setState(PROGRESS)
+		j.setInfo(fmt.Sprintf("Calculated 0 out of %d jobs.\n", total))
+		j.publish(ctx, opts.Events, events.Event{Type: events.JOB_STARTED, Total: total})
+
+		var mu sync.Mutex
+		var done, failed int
+		finish := func(ok bool) {
+			mu.Lock()
+			defer mu.Unlock()
+			done++
+			if !ok {
+				failed++
+			}
+			j.setInfo(fmt.Sprintf("Calculated %d out of %d jobs, %d failed.\n", done, total, failed))
+			j.processed.Store(int64(done - failed))
+		}
+
+		sem := make(chan struct{}, GROUP_PARALLEL)
+		var wg sync.WaitGroup
+		for _, c := range children {
+			sem <- struct{}{}
+			child, err := start(ctx, c)
+			if err != nil {
+				<-sem
+				j.logger.Warn("cannot start job of group", "child_url", c.URL, "child_year", c.Year, "error", err)
+				j.stateMu.Lock()
+				j.group.failed = append(j.group.failed, ChildFailure{URL: c.URL, Year: c.Year, Info: err.Error()})
+				j.stateMu.Unlock()
+				finish(false)
+				continue
+			}
+			j.stateMu.Lock()
+			j.group.children = append(j.group.children, child)
+			j.stateMu.Unlock()
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-child.Done()
+				<-sem
+				finish(child.State() == SUCCESS)
+			}()
+		}
+		wg.Wait()
+
+		j.setDuration(time.Since(j.startTime))
+		j.setInfo(fmt.Sprintf("Calculated %d jobs, %d failed.\n", total, failed))
+		if failed == total {
+			j.setState(FAILURE)
+			j.logger.Error("every job of the group failed", "jobs", total)
+			j.publish(ctx, opts.Events, events.Event{Type: events.JOB_FAILED, Info: j.Info()})
+			return
+		}
+		if err := j.setState(SUCCESS); err != nil {
+			j.logger.Warn("cannot complete job", "error", err)
+		}
+		j.logger.Info("group finished", "duration_sec", j.Duration().Seconds(), "jobs", total, "failed", failed)
+		j.publish(ctx, opts.Events, events.Event{Type: events.JOB_COMPLETED, Processed: int64(total - failed), Total: total, Info: j.Info()})
+	}()
+}
@@ -1,48 +1,167 @@
 package job
 
 import (
-	"compress/flate"
-	"compress/gzip"
+	"bufio"
+	"bytes"
 	"context"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"maps"
 	"math"
 	"math/rand"
+	"net"
 	"net/http"
 	"net/url"
+	"runtime/debug"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/Yaxhveer/wayback-discover-diff-go/internal/simhash"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/artifacts"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/config"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/events"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/logging"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/lsh"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/metrics"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/notify"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/reporting"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/usage"
 	"github.com/Yaxhveer/wayback-discover-diff-go/internal/utils"
+	"github.com/Yaxhveer/wayback-discover-diff-go/pkg/simhash"
 
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const MAP_CAPTURE_DOWNLOAD = 1000000
 const MAX_DOWNLOAD_ERRORS = 10
 const MAX_RETRIES = 2
-const CONCURRENCY_LIMIT = 20
+const HASH_CACHE_SIZE = 100000
+
+// CDX_LINE_SIZE is the initial size of the buffer CDX answers are scanned
+// with, and MAX_CDX_LINE_SIZE the longest line it grows to.
+const (
+	CDX_LINE_SIZE     = 4096
+	MAX_CDX_LINE_SIZE = 1 << 20
+)
+
+// settings holds the job settings of the configuration, see Configure.
+var settings = *config.Default()
+
+// Configure applies the job settings of cfg (concurrency, simhash expiry,
+// CDX limit and auth token) to the jobs started afterwards.
+func Configure(cfg *config.Config) {
+	settings = *cfg
+}
+
+// Concurrency returns the number of captures a job downloads at once, at
+// most, as adaptive workers are shared between jobs.
+func Concurrency() int {
+	if settings.Workers.Adaptive {
+		return settings.Workers.Max
+	}
+	return settings.Concurrency
+}
+
+var tracer = otel.Tracer("github.com/Yaxhveer/wayback-discover-diff-go/internal/job")
 
 var mu sync.Mutex
-var simhashMap map[string]string = make(map[string]string)
+
+// runningJobs and activeDownloads count the jobs and capture downloads in
+// flight across the process, they feed the readiness check.
+var runningJobs, activeDownloads atomic.Int64
+
+// RunningJobs returns the number of jobs that have not finished yet.
+func RunningJobs() int64 {
+	return runningJobs.Load()
+}
+
+// ActiveDownloads returns the number of capture downloads in flight.
+func ActiveDownloads() int64 {
+	return activeDownloads.Load()
+}
+
+// digestEntry is the simhash computed for a capture digest and the size of
+// the capture it was computed from.
+type digestEntry struct {
+	simhash string
+	bytes   int
+}
+
+var simhashMap map[string]digestEntry = make(map[string]digestEntry)
+
+// FlushDigestCache drops every simhash memoized by capture digest and returns
+// how many there were.
+func FlushDigestCache() int {
+	mu.Lock()
+	defer mu.Unlock()
+	n := len(simhashMap)
+	simhashMap = make(map[string]digestEntry)
+	return n
+}
 
 // Job manages a queue of jobs.
 // instead of passing everything we would pass config as parameter which would be further used
 type Job struct {
-	ID         string
-	URL        string
-	Year       string
-	State      string
-	Info       string
-	startTime  time.Time
-	Duration   time.Duration
-	httpClient *http.Client
-	workerCh   chan struct{}
+	ID          string
+	URL         string
+	Year        string
+	RequestID   string
+	APIKey      string
+	SimhashSize int
+	Extractor   string
+	startTime   time.Time
+	// duration and artifactsKey are set once the job is done, under stateMu.
+	duration     time.Duration
+	artifactsKey string
+	httpClient   *http.Client
+	downloads    *downloadLimit
+	sampler      *sampler
+	hashCache    *simhash.HashCache
+	logger       *slog.Logger
+	logs         *logBuffer
+	redisClient  *redis.Client
+	opts         Options
+	done         chan struct{}
+	// results holds the simhashes computed so far, timestamp -> simhash.
+	resultsMu sync.Mutex
+	results   map[string]string
+	// urlResults holds the simhashes of the URLs matched by a wildcard job,
+	// url -> timestamp -> simhash, and urlTotals their number of captures.
+	urlResults map[string]map[string]string
+	urlTotals  map[string]int
+	// skipped are the captures downloaded but not hashed, see waybackPage,
+	// and archived the X-Archive-* headers of downloads, see Archived.
+	skipped  []SkippedCapture
+	archived map[string]ArchiveHeaders
+	// transient holds the captures that failed transiently during the main
+	// pass of the job, url timestamp, see failTransient.
+	transient map[string]struct{}
+	// sources holds the archive of each capture, timestamp -> index in
+	// archiveSources, when captures are merged from several archives.
+	sources map[string]int
+	// processed counts the captures with a simhash, listed the captures
+	// listed by CDX so far and downloaded the bytes of the captures
+	// downloaded.
+	processed, listed, downloaded atomic.Int64
+	costs                         costs
+	// state is the current state and transitions the states the job went
+	// through.
+	stateMu     sync.Mutex
+	state       State
+	transitions []Transition
+	info        string
+	// group holds the children of a job group, nil for other jobs.
+	group *group
 }
 
 // NewJob initializes the job queue with an HTTP client.
@@ -57,92 +176,335 @@ func NewJob() *Job {
 	}
 	return &Job{
 		httpClient: client,
+		logger:     slog.Default(),
 	}
 }
 
-// RunJob executes a new job and returns the job_id
-func (j *Job) RunJob(redisClient *redis.Client, url, year string) string {
-	j.startTime = time.Now()
-	jobID := fmt.Sprintf("%x", sha256.Sum256([]byte(url+year+time.Now().String())))
+// recordUsage adds the job, its processed captures and downloaded bytes to
+// the usage of its API key.
+func (j *Job) recordUsage(ctx context.Context) {
+	if j.APIKey == "" {
+		return
+	}
+	u := usage.Usage{Jobs: 1, Captures: j.processed.Load(), Bytes: j.downloaded.Load()}
+	if err := usage.Record(ctx, j.redisClient, j.APIKey, u); err != nil {
+		j.logger.Warn("cannot record usage", "api_key", j.APIKey, "error", err)
+	}
+}
 
-	j.ID = jobID
-	j.URL = url
-	j.Year = year
-	j.State = "PENDING"
-	j.Info = fmt.Sprintf("Fetching %s captures for year %s", url, year)
-	j.workerCh = make(chan struct{}, CONCURRENCY_LIMIT)
+// Done returns a channel closed once the job has finished.
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Checkpoint stores the simhashes the job has computed so far, so that an
+// interrupted job does not lose them, and returns how many were stored.
+func (j *Job) Checkpoint(ctx context.Context) (int, error) {
+	byURL := j.resultsByURL()
+	stored := 0
+	for _, results := range byURL {
+		stored += len(results)
+	}
+	if stored == 0 {
+		return 0, nil
+	}
+	// The captures not processed yet are not stale, keep their simhashes.
+	opts := j.opts
+	opts.Recalculate = false
+	if err := j.storeAll(ctx, j.redisClient, byURL, opts); err != nil {
+		return 0, err
+	}
+	return stored, nil
+}
+
+// StartTime returns when the job was started.
+func (j *Job) StartTime() time.Time {
+	return j.startTime
+}
 
+// Options selects how a job fingerprints captures.
+type Options struct {
+	SimhashSize int
+	Extractor   string
+	// Replace drops the simhashes already stored for the URL before writing,
+	// so that results of another algorithm or extractor are not mixed in.
+	Replace bool
+	// Recalculate downloads every capture again instead of reusing the
+	// simhashes memoized by digest, and drops the stored simhashes of the
+	// year that the job did not recompute.
+	Recalculate bool
+	// Events receives the lifecycle events of the job, if not nil.
+	Events *events.Publisher
+	// Artifacts uploads the results of the job once it completes, if not
+	// nil.
+	Artifacts *artifacts.Uploader
+	// Notifier tells operators when the job fails or completes, if not nil.
+	Notifier *notify.Notifier
+	// APIKey is the name of the API key that started the job, if any.
+	APIKey string
+	// MaxCaptures limits the captures fetched from CDX below the configured
+	// limit, 0 for no further limit.
+	MaxCaptures int
+	// Sample processes only a sample of the captures listed by CDX for a
+	// fast approximate timeline: every Sample-th capture when at least 2,
+	// or each capture with probability Sample when between 0 and 1. 0
+	// processes every capture.
+	Sample float64
+	// Preview stores the simhashes of the first Preview captures processed
+	// as soon as they are done and marks the job PARTIAL, so that they can
+	// be read while the rest is calculated. 0 stores every simhash at the
+	// end.
+	Preview int
+}
+
+// RunJob executes a new job and returns the job_id. The job outlives ctx but
+// continues the trace it carries.
+func (j *Job) RunJob(ctx context.Context, redisClient *redis.Client, url, year string, opts Options) string {
+	jobID := j.init(ctx, redisClient, url, year, opts)
+	j.transient = make(map[string]struct{})
+	j.setInfo(fmt.Sprintf("Fetching %s captures for year %s", url, year))
+
+	ctx = context.WithoutCancel(ctx)
+	runningJobs.Add(1)
 	go func() {
-		// Fetch CDX captures
-		captures, err := j.FetchCDX(url, year)
+		defer close(j.done)
+		defer runningJobs.Add(-1)
+		defer j.recordUsage(ctx)
+		defer func() {
+			if r := recover(); r != nil {
+				j.setState(FAILURE)
+				j.setInfo(fmt.Sprintf("job failed unexpectedly, %v", r))
+				j.recovered(ctx, r, "")
+				j.publish(ctx, opts.Events, events.Event{Type: events.JOB_FAILED, Info: j.Info()})
+			}
+		}()
+		ctx, span := tracer.Start(ctx, "job.run", trace.WithAttributes(
+			attribute.String("job.id", jobID),
+			attribute.String("url", url),
+			attribute.String("year", year),
+		))
+		defer span.End()
+
+		// Stream the CDX captures into the pipeline, which downloads them
+		// while CDX is still answering.
+		j.setState(STARTED)
+		captures := make(chan string)
+		var err error
+		go func() {
+			defer close(captures)
+			err = j.StreamCDX(ctx, url, year, func(capture string) {
+				if !j.sampler.keep() {
+					return
+				}
+				if j.listed.Add(1) == 1 {
+					j.setState(PROGRESS)
+					j.publish(ctx, opts.Events, events.Event{Type: events.JOB_STARTED})
+				}
+				captures <- capture
+			})
+		}()
+		// process returns once captures is closed, so err is set.
+		failed, retry := j.process(ctx, captures, Concurrency(), opts)
+		hits, misses := j.hashCache.Stats()
+		metrics.Add(metrics.HASH_CACHE_HITS, int64(hits))
+		metrics.Add(metrics.HASH_CACHE_MISSES, int64(misses))
 		if err != nil {
-			j.State = "ERROR"
-			j.Info = fmt.Sprintf("error while fetching cdx for url %s and year %s, %s\n", url, year, err.Error())
-			fmt.Println(j.Info)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "cannot fetch CDX")
+			j.setState(FAILURE)
+			j.setInfo(fmt.Sprintf("error while fetching cdx for url %s and year %s, %s", url, year, err.Error()))
+			j.logger.Error("cannot fetch CDX", "error", err)
+			j.report(ctx, err, "")
+			j.publish(ctx, opts.Events, events.Event{Type: events.JOB_FAILED, Info: j.Info()})
 			return
 		}
 
-		totalCaptures := len(captures)
-		finalResult := map[string]string{}
-		// Process each capture concurrently
-		var wg sync.WaitGroup
-		var i int64
-		for _, capture := range captures {
-
-			wg.Add(1)
-			go func(capture string) {
-				defer func() {
-					wg.Done()
-				}()
-				timestamp, simhash := j.GetCalculation(capture)
-				if timestamp != "" && simhash != "" {
-					finalResult[timestamp] = simhash
-
-					if i%10 == 0 {
-						j.State = "PENDING"
-						j.Info = fmt.Sprintf("Processed %d out of %d captures.\n", i, totalCaptures)
-					}
-					atomic.AddInt64(&i, 1)
-				}
-			}(capture)
+		// Try the captures that failed transiently once more, the archive
+		// may have recovered since.
+		recovered := 0
+		if len(retry) > 0 && j.State().Running() {
+			var retryFailed int64
+			recovered, retryFailed = j.retryPass(ctx, retry, opts)
+			failed += retryFailed
 		}
-		wg.Wait()
-
-		j.State = "COMPLETE"
-		j.Info = fmt.Sprintf("Processed %d captures.\n", totalCaptures)
 
-		if len(finalResult) != 0 {
-			urlKey := utils.Surt(url)
-			err := redisClient.HSet(context.Background(), urlKey, finalResult).Err()
-			if err != nil {
-				j.Info = fmt.Sprintf("cannot write simhashes to Redis for URL %s, %s", url, err.Error())
-				fmt.Println(j.Info)
-				return
+		totalCaptures := int(j.listed.Load())
+		info := fmt.Sprintf("Processed %d captures.\n", totalCaptures)
+		if failed > 0 {
+			info = fmt.Sprintf("Processed %d captures, %d failed.\n", totalCaptures, failed)
+		}
+		if pages, undecodable := j.skippedCounts(); pages > 0 || undecodable > 0 {
+			info = strings.TrimSuffix(info, ".\n")
+			if pages > 0 {
+				info += fmt.Sprintf(", %d skipped as Wayback error pages", pages)
+			}
+			if undecodable > 0 {
+				info += fmt.Sprintf(", %d undecodable", undecodable)
 			}
+			info += ".\n"
+		}
+		if len(retry) > 0 {
+			info = strings.TrimSuffix(info, ".\n") + fmt.Sprintf(", %d of %d retried at the end recovered.\n", recovered, len(retry))
+		}
+		if j.sampler != nil {
+			info = strings.TrimSuffix(info, ".\n") + ", " + j.sampler.String() + ".\n"
+		}
 
-			// load from config
-			var expire time.Duration = 86400
-			err = redisClient.Expire(context.Background(), urlKey, expire*time.Second).Err()
-			if err != nil {
-				j.Info = fmt.Sprintf("cannot write simhashes to Redis for URL %s, %s", url, err.Error())
-				fmt.Println(j.Info)
+		finalResult := j.resultsByURL()
+		stored := 0
+		for _, results := range finalResult {
+			stored += len(results)
+		}
+		if stored != 0 {
+			if err := j.storeAll(ctx, redisClient, finalResult, opts); err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, "cannot store simhashes")
+				j.setState(FAILURE)
+				j.setInfo(err.Error())
+				j.logger.Error("cannot store simhashes", "error", err)
+				j.report(ctx, err, "")
+				j.publish(ctx, opts.Events, events.Event{Type: events.JOB_FAILED, Processed: int64(stored), Total: totalCaptures, Info: j.Info()})
 				return
 			}
 		}
 
-		duration := time.Now().Sub(j.startTime)
-		j.Duration = duration
-		fmt.Printf("Simhash calculation finished in %.2fsec.\n", duration.Seconds())
+		duration := time.Since(j.startTime)
+		j.setDuration(duration)
+		j.uploadArtifacts(ctx, finalResult)
+		j.setInfo(info)
+		if err := j.setState(SUCCESS); err != nil {
+			j.logger.Warn("cannot complete job", "error", err)
+		}
+		j.logger.Info("simhash calculation finished", "duration_sec", duration.Seconds(), "captures", totalCaptures, "stored", stored, "cost", j.Cost())
+		j.publish(ctx, opts.Events, events.Event{Type: events.JOB_COMPLETED, Processed: int64(stored), Total: totalCaptures, Info: j.Info()})
 		return
 	}()
 
 	return jobID
 }
 
-// FetchCDX fetches captures for a given URL and year.
-func (j *Job) FetchCDX(targetURL, year string) ([]string, error) {
-	fmt.Printf("fetching CDX of url %s for year %s\n", targetURL, year)
+// init sets a new job up to calculate the simhashes of url and year and
+// returns its ID.
+func (j *Job) init(ctx context.Context, redisClient *redis.Client, url, year string, opts Options) string {
+	j.startTime = time.Now()
+	jobID := fmt.Sprintf("%x", sha256.Sum256([]byte(url+year+time.Now().String())))
+
+	j.ID = jobID
+	j.URL = utils.Canonicalize(url)
+	j.Year = year
+	j.SimhashSize = opts.SimhashSize
+	j.Extractor = opts.Extractor
+	j.APIKey = opts.APIKey
+	j.setState(PENDING)
+	j.redisClient = redisClient
+	j.opts = opts
+	j.done = make(chan struct{})
+	j.results = make(map[string]string)
+	j.urlResults = make(map[string]map[string]string)
+	j.downloads = newDownloadLimit(Concurrency())
+	j.sampler = newSampler(opts.Sample)
+	j.hashCache = simhash.NewHashCache(HASH_CACHE_SIZE)
+	j.logs = newLogBuffer(JOB_LOG_SIZE)
+	j.logger = slog.New(bufferHandler{slog.Default().Handler(), j.logs}).With("job_id", jobID, "url", url, "year", year)
+	if j.RequestID = logging.RequestID(ctx); j.RequestID != "" {
+		j.logger = j.logger.With("request_id", j.RequestID)
+	}
+	return jobID
+}
+
+// dropStale removes the simhashes stored under urlKey for the year of the job
+// that are not in results, e.g. of captures no longer listed by CDX.
+func (j *Job) dropStale(ctx context.Context, redisClient *redis.Client, urlKey string, results map[string]string) error {
+	stored, err := redisClient.HKeys(ctx, urlKey).Result()
+	if err != nil {
+		return err
+	}
+	var stale []string
+	for _, ts := range stored {
+		if _, ok := results[ts]; !ok && strings.HasPrefix(ts, j.Year) {
+			stale = append(stale, ts)
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+	j.logger.Info("dropping stale simhashes", "count", len(stale))
+	pipe := redisClient.TxPipeline()
+	pipe.HDel(ctx, urlKey, stale...)
+	pipe.HDel(ctx, utils.SourcesKey(urlKey), stale...)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// storeResults writes the simhashes of a job (timestamp -> simhash) and their
+// metadata to Redis and adds them to the LSH index.
+func (j *Job) storeResults(ctx context.Context, redisClient *redis.Client, results map[string]string, opts Options) error {
+	ctx, span := tracer.Start(ctx, "redis.write", trace.WithAttributes(attribute.Int("captures", len(results))))
+	defer span.End()
+
+	urlKey := utils.Surt(j.URL)
+	if opts.Replace {
+		if err := redisClient.Del(ctx, urlKey, utils.SourcesKey(urlKey)).Err(); err != nil {
+			return fmt.Errorf("cannot replace simhashes in Redis for URL %s, %s", j.URL, err.Error())
+		}
+	}
+	// A sample leaves captures out, which are not stale.
+	if opts.Recalculate && !opts.Replace && opts.Sample == 0 {
+		if err := j.dropStale(ctx, redisClient, urlKey, results); err != nil {
+			return fmt.Errorf("cannot replace simhashes in Redis for URL %s, %s", j.URL, err.Error())
+		}
+	}
+	err := redisClient.HSet(ctx, urlKey, results).Err()
+	if err == nil {
+		err = j.storeSources(ctx, redisClient, urlKey, results)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot write simhashes to Redis for URL %s, %s", j.URL, err.Error())
+	}
+
+	metaKey := utils.MetaKey(urlKey)
+	revision, err := utils.NextRevision(ctx, redisClient)
+	if err == nil {
+		err = redisClient.HSet(ctx, metaKey,
+			"simhash_size", j.SimhashSize,
+			"algo", simhash.Algorithm(j.SimhashSize),
+			"extractor", j.Extractor,
+			"revision", revision,
+		).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("cannot write simhash metadata to Redis for URL %s, %s", j.URL, err.Error())
+	}
+
+	expire := settings.Simhash.ExpireAfter
+	err = redisClient.Expire(ctx, urlKey, expire).Err()
+	if err == nil {
+		err = redisClient.Expire(ctx, metaKey, expire).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("cannot write simhashes to Redis for URL %s, %s", j.URL, err.Error())
+	}
+
+	err = lsh.Index(ctx, redisClient, j.URL, results, expire)
+	if err != nil {
+		return fmt.Errorf("cannot index simhashes for URL %s, %s", j.URL, err.Error())
+	}
+	return nil
+}
+
+// StoreSimhashes writes simhashes (timestamp -> simhash) of url calculated
+// outside of a job, e.g. from crawl archives, like a job stores its results.
+func StoreSimhashes(ctx context.Context, redisClient *redis.Client, url string, results map[string]string, opts Options) error {
+	url = utils.Canonicalize(url)
+	j := &Job{URL: url, SimhashSize: opts.SimhashSize, Extractor: opts.Extractor, logger: slog.With("url", url)}
+	return j.storeResults(ctx, redisClient, results, opts)
+}
 
+// cdxQuery returns the collection of targetURL, the URL without it, the
+// params of the CDX query of its captures in year and their limit, -1 for
+// none.
+func (j *Job) cdxQuery(targetURL, year string) (string, string, url.Values, int) {
+	collection, targetURL := utils.SplitCollection(utils.Canonicalize(targetURL))
 	params := url.Values{}
 	params.Set("url", targetURL)
 	params.Set("from", year)
@@ -150,154 +512,637 @@ func (j *Job) FetchCDX(targetURL, year string) ([]string, error) {
 	params.Set("statuscode", "200")
 	params.Set("fl", "timestamp,digest")
 	params.Set("collapse", "timestamp:9")
+	wildcard := IsWildcard(targetURL)
+	if wildcard {
+		// Captures of several URLs are interleaved by timestamp, so they
+		// are collapsed per URL by groupByURL instead.
+		params.Set("url", strings.TrimSuffix(targetURL, "*"))
+		params.Set("matchType", "prefix")
+		params.Set("fl", "timestamp,digest,original")
+		params.Del("collapse")
+	}
 
-	// load from config
-	snapShotsNumber := -1
+	snapShotsNumber := settings.Snapshots.NumberPerYear
+	if max := j.opts.MaxCaptures; max > 0 && (snapShotsNumber == -1 || max < snapShotsNumber) {
+		snapShotsNumber = max
+	}
 	if snapShotsNumber != -1 {
 		params.Set("limit", strconv.Itoa(snapShotsNumber))
 	}
+	return collection, targetURL, params, snapShotsNumber
+}
 
-	apiURL := "https://web.archive.org/web/timemap?" + params.Encode()
+// FetchCDX fetches captures for a given URL and year.
+func (j *Job) FetchCDX(ctx context.Context, targetURL, year string) ([]string, error) {
+	ctx, span := tracer.Start(ctx, "cdx.fetch")
+	defer span.End()
 
-	fmt.Printf("api: %s\n", apiURL)
-	fmt.Printf("Generating the get fetch req Request, %f\n", time.Now().Sub(j.startTime).Seconds())
+	j.logger.Info("fetching CDX")
 
-	req, err := j.generateGetRequest(apiURL)
+	collection, targetURL, params, snapShotsNumber := j.cdxQuery(targetURL, year)
+	wildcard := IsWildcard(targetURL)
+	var captures []string
+	var err error
+	if len(settings.Archive.Sources) > 0 && collection == "" && !wildcard {
+		captures, err = j.fetchMerged(ctx, params, snapShotsNumber)
+	} else {
+		err = j.listYear(ctx, timemapURL(collection), params, func(line string) {
+			captures = append(captures, line)
+		})
+	}
 	if err != nil {
+		span.RecordError(err)
 		return nil, err
 	}
+	if wildcard {
+		// Lines of months listed at once are interleaved, see listYear.
+		slices.Sort(captures)
+		var totals map[string]int
+		captures, totals = groupByURL(captures, collection)
+		j.resultsMu.Lock()
+		j.urlTotals = totals
+		j.resultsMu.Unlock()
+	}
+	if len(captures) == 0 {
+		return nil, fmt.Errorf("No captures of %s for year %s", targetURL, year)
+	}
+
+	span.SetAttributes(attribute.Int("captures", len(captures)))
+	j.logger.Info("fetched CDX", "captures", len(captures))
+	return captures, nil
+}
+
+// StreamCDX lists the captures of targetURL in year like FetchCDX, but hands
+// each to emit as soon as its line is read, so that their downloads start
+// before CDX finishes answering. The captures of wildcards and of several
+// archives are handed over once fully listed, since they are grouped or
+// merged first.
+func (j *Job) StreamCDX(ctx context.Context, targetURL, year string, emit func(capture string)) error {
+	collection, target, params, _ := j.cdxQuery(targetURL, year)
+	if IsWildcard(target) || len(settings.Archive.Sources) > 0 && collection == "" {
+		captures, err := j.FetchCDX(ctx, targetURL, year)
+		for _, capture := range captures {
+			emit(capture)
+		}
+		return err
+	}
+
+	ctx, span := tracer.Start(ctx, "cdx.fetch")
+	defer span.End()
+
+	j.logger.Info("streaming CDX")
+	n := 0
+	err := j.listYear(ctx, timemapURL(collection), params, func(line string) {
+		n++
+		emit(line)
+	})
+	if err == nil && n == 0 {
+		err = fmt.Errorf("No captures of %s for year %s", target, year)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	span.SetAttributes(attribute.Int("captures", n))
+	j.logger.Info("fetched CDX", "captures", n)
+	return nil
+}
+
+// scanCaptures requests the CDX lines selected by params from the timemap
+// endpoint and hands them to emit as they are read. A line is held back
+// until the next one arrives, so that a truncated last line, missing fields
+// of fl or part of its timestamp, is never emitted but reported as an error.
+func (j *Job) scanCaptures(ctx context.Context, endpoint string, params url.Values, emit func(line string)) error {
+	apiURL := endpoint + "?" + params.Encode()
 
-	fmt.Printf("Making the get fetch req Request, %f\n", time.Now().Sub(j.startTime).Seconds())
+	j.logger.Debug("generating CDX request", "api", apiURL, "elapsed_sec", time.Since(j.startTime).Seconds())
+
+	req, err := j.generateGetRequest(ctx, apiURL)
+	if err != nil {
+		return err
+	}
+
+	j.logger.Debug("sending CDX request", "elapsed_sec", time.Since(j.startTime).Seconds())
 
 	resp, err := j.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("No captures of %s for year %s, %s", targetURL, year, err.Error())
+		return fmt.Errorf("No captures of %s for year %s, %s", params.Get("url"), params.Get("from"), err.Error())
 	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
 
-	fmt.Printf("Completed the get Request of fetch, %f\n", time.Now().Sub(j.startTime).Seconds())
+	j.logger.Debug("CDX request completed", "status", resp.StatusCode, "elapsed_sec", time.Since(j.startTime).Seconds())
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		errBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("Failed request to %s, status: %d, response: %s", apiURL, resp.StatusCode, string(errBody))
+		return fmt.Errorf("Failed request to %s, status: %d, response: %s", apiURL, resp.StatusCode, string(errBody))
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, CDX_LINE_SIZE), MAX_CDX_LINE_SIZE)
+	last := ""
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if last != "" {
+			emit(last)
+		}
+		last = line
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if last != "" && truncated(last, params) {
+		return fmt.Errorf("truncated answer of %s", endpoint)
+	}
+	if last != "" {
+		emit(last)
+	}
+	return nil
+}
+
+// streamCaptures hands the CDX lines selected by params from the timemap
+// endpoint to emit as they are read. When the endpoint is the configured
+// timemap and it fails or truncates its answer, the rest of the lines are
+// requested from the classic CDX API, which lists the same captures in the
+// same order, so the lines already emitted are skipped.
+func (j *Job) streamCaptures(ctx context.Context, endpoint string, params url.Values, emit func(line string)) error {
+	sent := 0
+	err := j.scanCaptures(ctx, endpoint, params, func(line string) {
+		sent++
+		emit(line)
+	})
+	if err == nil || endpoint != settings.Archive.TimemapURL || settings.Archive.CDXFallbackURL == "" {
+		return err
+	}
+	metrics.Add(metrics.CDX_FALLBACKS, 1)
+	j.logger.Warn("timemap failed, falling back to the CDX API", "error", err, "listed", sent)
+	skip := sent
+	fallbackErr := j.scanCaptures(ctx, settings.Archive.CDXFallbackURL, cdxParams(params), func(line string) {
+		if skip > 0 {
+			skip--
+			return
+		}
+		emit(line)
+	})
+	if fallbackErr != nil {
+		return fmt.Errorf("%s, and the CDX API failed, %s", err.Error(), fallbackErr.Error())
+	}
+	return nil
+}
+
+// listCaptures requests the CDX lines selected by params from the timemap
+// endpoint, see streamCaptures.
+func (j *Job) listCaptures(ctx context.Context, endpoint string, params url.Values) ([]string, error) {
+	var lines []string
+	err := j.streamCaptures(ctx, endpoint, params, func(line string) {
+		lines = append(lines, line)
+	})
 	if err != nil {
 		return nil, err
 	}
+	return lines, nil
+}
+
+// truncated reports whether a CDX line answered to params is cut short,
+// missing fields of fl or part of its timestamp.
+func truncated(line string, params url.Values) bool {
+	fields := strings.Fields(line)
+	return len(fields) < len(strings.Split(params.Get("fl"), ",")) || len(fields[0]) != 14
+}
+
+// cdxParams translates the params of a timemap query to those of the
+// classic CDX API, which filters the status code with filter=.
+func cdxParams(params url.Values) url.Values {
+	cdx := maps.Clone(params)
+	if status := cdx.Get("statuscode"); status != "" {
+		cdx.Del("statuscode")
+		cdx.Set("filter", "statuscode:"+status)
+	}
+	return cdx
+}
 
-	captures := strings.Split(strings.TrimSpace(string(body)), "\n")
-	if len(captures) == 0 || (len(captures) == 1 && captures[0] == "") {
-		return nil, fmt.Errorf("No captures of %s for year", apiURL, year)
+// timemapURL returns the CDX endpoint of the Archive-It collection, or of the
+// configured archive when collection is empty.
+func timemapURL(collection string) string {
+	if collection != "" {
+		return settings.Archive.ArchiveItURL + "/" + collection + "/timemap/cdx"
 	}
+	return settings.Archive.TimemapURL
+}
 
-	fmt.Printf("captured %d CDX of url %s for year %s\n", len(captures), targetURL, year)
-	return captures, nil
+// replayURL returns the URL of the original bytes of the capture of url at
+// timestamp in the Archive-It collection, or in the configured archive when
+// collection is empty.
+func replayURL(collection, timestamp, url string) string {
+	template := settings.Archive.ReplayURL
+	if collection != "" {
+		template = settings.Archive.ArchiveItURL + "/" + collection + "/{timestamp}id_/{url}"
+	}
+	return strings.NewReplacer("{timestamp}", timestamp, "{url}", url).Replace(template)
+}
+
+// ReplayURL returns the URL of the original bytes of the capture of url at
+// timestamp in the configured archive.
+func ReplayURL(timestamp, url string) string {
+	return replayURL("", timestamp, url)
+}
+
+// HasCaptures reports whether CDX lists a capture of targetURL in year. It
+// asks for a single capture, so it is much cheaper than FetchCDX. Like
+// FetchCDX, it asks every archive when captures are merged from several,
+// until one lists a capture.
+func HasCaptures(ctx context.Context, targetURL, year string) (bool, error) {
+	ctx, span := tracer.Start(ctx, "cdx.preflight")
+	defer span.End()
+
+	collection, targetURL := utils.SplitCollection(utils.Canonicalize(targetURL))
+	params := url.Values{}
+	params.Set("url", targetURL)
+	params.Set("from", year)
+	params.Set("to", year)
+	params.Set("statuscode", "200")
+	params.Set("fl", "timestamp")
+	params.Set("limit", "1")
+
+	endpoints := []string{timemapURL(collection)}
+	if len(settings.Archive.Sources) > 0 && collection == "" && !IsWildcard(targetURL) {
+		endpoints = endpoints[:0]
+		for _, source := range archiveSources() {
+			endpoints = append(endpoints, source.TimemapURL)
+		}
+	}
+	for _, endpoint := range endpoints {
+		lines, err := NewJob().listCaptures(ctx, endpoint, params)
+		if err != nil {
+			span.RecordError(err)
+			return false, err
+		}
+		if len(lines) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
 // GetCalculation processes a single capture and returns (timestamp, simhash).
-func (j *Job) GetCalculation(capture string) (string, string) {
+func (j *Job) GetCalculation(ctx context.Context, capture string) (string, string) {
 	parts := strings.Split(capture, " ")
 	if len(parts) < 2 {
 		return "", ""
 	}
 	timestamp, digest := parts[0], parts[1]
 
-	// Check if digest is already processed
-	if simhash, exists := simhashMap[digest]; exists {
-		fmt.Printf("already seen %s\n", digest)
-		return timestamp, simhash
+	// Check if digest is already processed at this size
+	cacheKey := fmt.Sprintf("%d:%s:%s", j.SimhashSize, j.Extractor, digest)
+	mu.Lock()
+	entry, exists := simhashMap[cacheKey]
+	mu.Unlock()
+	if exists && !j.opts.Recalculate {
+		j.logger.Debug("digest already seen", "timestamp", timestamp, "digest", digest)
+		metrics.Add(metrics.DIGEST_CACHE_HITS, 1)
+		j.costs.dedupHits.Add(1)
+		metrics.Add(metrics.DOWNLOAD_BYTES_AVOIDED, int64(entry.bytes))
+		return timestamp, entry.simhash
 	}
+	metrics.Add(metrics.DIGEST_CACHE_MISSES, 1)
 
-	// Simulate download (placeholder for actual implementation)
-	respData := j.DownloadCapture(timestamp)
-	if len(respData) == 0 {
+	_, original := j.captureURLs(capture)
+	encodedSimhash, size, err := j.computeSimhash(ctx, original, timestamp)
+	if err != nil {
 		return "", ""
 	}
 
-	// Extract HTML features
-	features := extractHTMLFeatures(respData)
+	// Store result
+	mu.Lock()
+	simhashMap[cacheKey] = digestEntry{simhash: encodedSimhash, bytes: size}
+	mu.Unlock()
+	return timestamp, encodedSimhash
+}
+
+// computeSimhash downloads the capture of url at timestamp and computes its
+// simhash. It also returns the size of the downloaded capture.
+func (j *Job) computeSimhash(ctx context.Context, url, timestamp string) (string, int, error) {
+	pool.acquire()
+	defer pool.release()
+
+	// Reserve the largest body a download may hold, then keep only what it
+	// holds until the simhash is computed.
+	budget.reserve(MAP_CAPTURE_DOWNLOAD)
+	buf := j.download(ctx, url, timestamp)
+	size := 0
+	if buf != nil {
+		size = buf.Len()
+	}
+	budget.release(int64(MAP_CAPTURE_DOWNLOAD - size))
+	defer budget.release(int64(size))
+	if size == 0 {
+		putBuffer(buf)
+		return "", 0, fmt.Errorf("cannot download capture %s %s", timestamp, url)
+	}
+	metrics.Add(metrics.DOWNLOAD_BYTES, int64(size))
+	j.downloaded.Add(int64(size))
+
+	// Extract HTML features, streaming the body into the tokenizer. The
+	// buffer goes back to the pool once the features are extracted.
+	_, span := tracer.Start(ctx, "capture.extract", trace.WithAttributes(attribute.String("timestamp", timestamp)))
+	start := time.Now()
+	features := extractFeatures(bytes.NewReader(buf.Bytes()), j.Extractor)
+	since(start, &j.costs.extractTime, &j.costs.extractions)
+	putBuffer(buf)
+	span.SetAttributes(attribute.Int("features", len(features)))
+	span.End()
 	if len(features) == 0 {
-		return "", ""
+		return "", 0, fmt.Errorf("no features extracted from capture %s %s", timestamp, url)
 	}
 
 	// Compute SimHash
-	fmt.Printf("calculating simhash\n")
+	j.logger.Debug("calculating simhash", "timestamp", timestamp, "features", len(features))
 
-	// get from config
-	simhashSize := 256
-	encodedSimhash := simhash.GetSimhash(features, simhashSize)
+	_, span = tracer.Start(ctx, "simhash.compute", trace.WithAttributes(attribute.String("timestamp", timestamp)))
+	defer span.End()
+	start = time.Now()
+	defer since(start, &j.costs.simhashTime, &j.costs.hashes)
+	return simhash.GetSimhashCached(features, j.SimhashSize, j.hashCache), size, nil
+}
 
-	// Store result
-	mu.Lock()
-	simhashMap[digest] = encodedSimhash
-	mu.Unlock()
-	return timestamp, encodedSimhash
+// CalculateCapture downloads a single capture of url and computes its simhash
+// without consulting the digest cache or storing the result.
+func (j *Job) CalculateCapture(ctx context.Context, url, timestamp string, opts Options) (string, error) {
+	j.prepareCapture(ctx, url, timestamp, opts)
+	hash, _, err := j.computeSimhash(ctx, url, timestamp)
+	return hash, err
 }
 
-func (j *Job) DownloadCapture(timestamp string) string {
-	j.workerCh <- struct{}{}
+// CaptureFeatures downloads a single capture of url and returns the features
+// extracted from it, with their weights, as they are fed to the simhash.
+func (j *Job) CaptureFeatures(ctx context.Context, url, timestamp string, opts Options) (map[string]int, error) {
+	j.prepareCapture(ctx, url, timestamp, opts)
+	buf := j.download(ctx, url, timestamp)
+	defer putBuffer(buf)
+	if buf == nil || buf.Len() == 0 {
+		return nil, fmt.Errorf("cannot download capture %s %s", timestamp, url)
+	}
+	return extractFeatures(bytes.NewReader(buf.Bytes()), j.Extractor), nil
+}
 
-	fmt.Printf("fetching capture %s %s\n", timestamp, j.URL)
-	apiURL := fmt.Sprintf("https://web.archive.org/web/%sid_/%s", timestamp, j.URL)
+// prepareCapture sets j up to download a single capture of url outside of
+// a job.
+func (j *Job) prepareCapture(ctx context.Context, url, timestamp string, opts Options) {
+	j.startTime = time.Now()
+	j.URL = url
+	j.SimhashSize = opts.SimhashSize
+	j.Extractor = opts.Extractor
+	j.downloads = newDownloadLimit(1)
+	j.archived = make(map[string]ArchiveHeaders)
+	j.logger = slog.With("url", url, "timestamp", timestamp)
+	if requestID := logging.RequestID(ctx); requestID != "" {
+		j.logger = j.logger.With("request_id", requestID)
+	}
+}
+
+// DownloadCapture downloads the capture of the URL of the job at timestamp
+// and returns its body when it is text or HTML.
+func (j *Job) DownloadCapture(ctx context.Context, timestamp string) string {
+	buf := j.download(ctx, j.URL, timestamp)
+	if buf == nil {
+		return ""
+	}
+	defer putBuffer(buf)
+	return buf.String()
+}
+
+// download downloads the capture of url at timestamp and returns its body,
+// in a buffer of the pool to return with putBuffer, when it is text or HTML.
+// It returns nil otherwise.
+func (j *Job) download(ctx context.Context, url, timestamp string) *bytes.Buffer {
+	started := j.downloads.acquire()
+	activeDownloads.Add(1)
+	defer since(started, &j.costs.downloadTime, &j.costs.downloads)
+
+	ctx, span := tracer.Start(ctx, "capture.download", trace.WithAttributes(attribute.String("timestamp", timestamp)))
+	defer span.End()
+
+	j.logger.Debug("fetching capture", "timestamp", timestamp)
+	// The captures of wildcard jobs are downloaded from their original URL,
+	// so the collection is the one of the job.
+	collection, _ := utils.SplitCollection(j.URL)
+	_, rawURL := utils.SplitCollection(url)
+	replay := func(u string) string {
+		if source, ok := j.captureSource(timestamp); ok {
+			return strings.NewReplacer("{timestamp}", timestamp, "{url}", u).Replace(source.ReplayURL)
+		}
+		return replayURL(collection, timestamp, u)
+	}
+	apiURL := replay(rawURL)
 
 	var resp *http.Response
+	var lastErr error
+	// latency is the answer time of the last attempt and troubled is set
+	// when an attempt failed, both feed the download limit of the job.
+	var latency time.Duration
+	troubled := false
 
-	for i := 0; i < MAX_RETRIES; i++ {
-		time.Sleep(exponentialBackoff(i))
-		req, err := j.generateGetRequest(apiURL)
+	for failures, datanodeErrors := 0, 0; failures < MAX_RETRIES; {
+		if failures+datanodeErrors > 0 {
+			j.costs.retries.Add(1)
+		}
+		time.Sleep(exponentialBackoff(failures + datanodeErrors))
+		req, err := j.generateGetRequest(ctx, apiURL)
 		if err != nil {
-			fmt.Printf("cannot fetch capture %s %s, %s\n", timestamp, j.URL, err.Error())
+			j.logger.Warn("cannot fetch capture", "timestamp", timestamp, "error", err)
+			failures++
 			continue
 		}
+		if datanodeErrors > 0 {
+			// Skip the caches that may hold the answer of the failed datanode.
+			req.Header.Set("Cache-Control", "no-cache")
+			req.Header.Set("Pragma", "no-cache")
+		}
 
+		start := time.Now()
 		resp, err = j.httpClient.Do(req)
+		latency = time.Since(start)
+		pool.observeLatency(latency)
 		if err != nil {
-			fmt.Printf("cannot fetch capture %s %s, %s\n", timestamp, j.URL, err.Error())
+			troubled = true
+			lastErr = err
+			span.RecordError(err)
+			failures++
+			j.logger.Warn("cannot fetch capture", "timestamp", timestamp, "attempt", failures, "error", err)
 			continue
 		}
 
+		if resp.StatusCode >= 500 {
+			troubled = true
+		}
+		if resp.StatusCode >= 500 && datanodeErrors < DATANODE_RETRIES {
+			j.logger.Warn("datanode error, retrying", "timestamp", timestamp, "status", resp.StatusCode, "retry", datanodeErrors+1)
+			metrics.Add(metrics.DATANODE_RETRIES, 1)
+			resp.Body.Close()
+			resp = nil
+			if datanodeErrors++; datanodeErrors == DATANODE_RETRIES {
+				apiURL = replay(otherScheme(rawURL))
+			}
+			continue
+		}
 		break
 	}
 
-	<-j.workerCh
+	activeDownloads.Add(-1)
+	j.downloads.release(started, latency, troubled)
 
 	if resp == nil {
-		return ""
+		span.SetStatus(codes.Error, "cannot fetch capture")
+		if lastErr != nil && j.failTransient(url, timestamp) {
+			return nil
+		}
+		if lastErr != nil {
+			j.report(ctx, fmt.Errorf("cannot fetch capture %s, %w", timestamp, lastErr), timestamp)
+		}
+		return nil
 	}
 	defer resp.Body.Close()
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+	archived := parseArchiveHeaders(resp)
+	j.setArchived(timestamp, archived)
+	if archived.Src != "" {
+		span.SetAttributes(attribute.String("archive.src", archived.Src), attribute.Int("archive.original_status", archived.OriginalStatus))
+	}
 
-	// Handle gzip and deflate decompression
-	var reader io.Reader = io.LimitReader(resp.Body, int64(MAP_CAPTURE_DOWNLOAD))
-	if strings.Contains(resp.Header.Get("Content-Encoding"), "gzip") {
-		gzReader, err := gzip.NewReader(resp.Body)
-		if err != nil {
-			fmt.Printf("cannot decompress gzip response %s %s, %s\n", timestamp, j.URL, err.Error())
-			return ""
+	buf, err := readBody(resp)
+	if err != nil && transientError(err, resp) && j.failTransient(url, timestamp) {
+		j.logger.Warn("cannot read response body, retrying at the end of the job", "timestamp", timestamp, "error", err)
+		return nil
+	}
+	if err != nil && encoded(resp) {
+		// The archived encoding may be corrupt, ask for the capture
+		// unencoded before giving up on it.
+		j.logger.Warn("cannot decode capture, requesting it unencoded", "timestamp", timestamp, "encoding", resp.Header.Get("Content-Encoding"), "error", err)
+		metrics.Add(metrics.IDENTITY_RETRIES, 1)
+		j.costs.retries.Add(1)
+		identity, identityErr := j.requestIdentity(ctx, apiURL)
+		if identityErr != nil {
+			j.logger.Warn("cannot fetch capture", "timestamp", timestamp, "error", identityErr)
+			var netErr net.Error
+			if errors.As(identityErr, &netErr) && j.failTransient(url, timestamp) {
+				return nil
+			}
+			span.SetAttributes(attribute.String("skipped", SKIP_UNDECODABLE))
+			j.skip(url, timestamp, SKIP_UNDECODABLE, resp.StatusCode)
+			j.report(ctx, fmt.Errorf("cannot fetch capture %s unencoded, %w", timestamp, identityErr), timestamp)
+			return nil
+		}
+		defer identity.Body.Close()
+		status := identity.StatusCode
+		if buf, err = readBody(identity); err != nil {
+			if transientError(err, identity) && j.failTransient(url, timestamp) {
+				j.logger.Warn("cannot read response body, retrying at the end of the job", "timestamp", timestamp, "error", err)
+				return nil
+			}
+			span.SetAttributes(attribute.String("skipped", SKIP_UNDECODABLE))
+			j.skip(url, timestamp, SKIP_UNDECODABLE, status)
+			return nil
 		}
-		defer gzReader.Close()
-		reader = gzReader
-	} else if strings.Contains(resp.Header.Get("Content-Encoding"), "deflate") {
-		deflateReader := flate.NewReader(resp.Body)
-		defer deflateReader.Close()
-		reader = deflateReader
+		resp = identity
 	}
-
-	// Read decompressed response body
-	data, err := io.ReadAll(reader)
 	if err != nil {
-		fmt.Printf("cannot read response body %s %s, %s\n", timestamp, j.URL, err.Error())
-		return ""
+		j.logger.Warn("cannot read response body", "timestamp", timestamp, "error", err)
+		return nil
+	}
+	if resp.StatusCode >= 500 && j.failTransient(url, timestamp) {
+		putBuffer(buf)
+		return nil
+	}
+	if reason := waybackPage(resp, buf.Bytes()); reason != "" {
+		putBuffer(buf)
+		span.SetAttributes(attribute.String("skipped", reason))
+		j.skip(url, timestamp, reason, resp.StatusCode)
+		return nil
 	}
 
 	// Check if it's text-based content
-	cType := strings.ToLower(resp.Header.Get("Content-Type"))
+	cType := strings.ToLower(archived.contentType(resp))
 	if strings.Contains(cType, "text") || strings.Contains(cType, "html") {
-		return string(data)
+		span.SetAttributes(attribute.Int("bytes", buf.Len()))
+		return buf
+	}
+
+	putBuffer(buf)
+	return nil
+}
+
+// recovered logs the stack trace of a recovered panic and reports it. capture
+// is the CDX line being processed, if any, which then counts as failed.
+func (j *Job) recovered(ctx context.Context, r any, capture string) {
+	j.logger.Error("panic in job", "capture", capture, "panic", r, "stack", string(debug.Stack()))
+	tags := map[string]string{"job_id": j.ID, "url": j.URL, "year": j.Year}
+	if capture != "" {
+		tags["capture"] = capture
+	}
+	reporting.CapturePanic(ctx, r, tags)
+}
+
+// publish fills in the job fields of e and sends it to p. Failures are only
+// logged, events never fail a job. The outcome of the job is also sent to
+// the notifier of its options.
+func (j *Job) publish(ctx context.Context, p *events.Publisher, e events.Event) {
+	e.JobID, e.RequestID, e.URL, e.Year = j.ID, j.RequestID, j.URL, j.Year
+	if err := p.Publish(ctx, e); err != nil {
+		j.logger.Warn("cannot publish job event", "type", e.Type, "error", err)
+	}
+	if e.Type == events.JOB_COMPLETED || e.Type == events.JOB_FAILED {
+		j.opts.Notifier.Notify(notify.Outcome{
+			JobID:     j.ID,
+			URL:       j.URL,
+			Year:      j.Year,
+			State:     string(j.State()),
+			Duration:  time.Since(j.startTime),
+			Processed: e.Processed,
+			Total:     e.Total,
+			Failed:    max(int64(e.Total)-e.Processed, 0),
+			Info:      strings.TrimSpace(e.Info),
+		})
+	}
+}
+
+// uploadArtifacts uploads results, url -> timestamp -> simhash, with
+// opts.Artifacts. Failures are only logged, artifacts never fail a job.
+func (j *Job) uploadArtifacts(ctx context.Context, results map[string]map[string]string) {
+	if j.opts.Artifacts == nil {
+		return
 	}
+	key, err := j.opts.Artifacts.Upload(ctx, artifacts.Manifest{
+		JobID:       j.ID,
+		URL:         j.URL,
+		Year:        j.Year,
+		SimhashSize: j.SimhashSize,
+		Algo:        simhash.Algorithm(j.SimhashSize),
+		Extractor:   j.Extractor,
+		CompletedAt: time.Now().UTC(),
+		Duration:    j.Duration().Seconds(),
+	}, results)
+	if err != nil {
+		j.logger.Warn("cannot upload job artifacts", "error", err)
+		j.report(ctx, err, "")
+		return
+	}
+	j.stateMu.Lock()
+	j.artifactsKey = key
+	j.stateMu.Unlock()
+	j.logger.Info("uploaded job artifacts", "manifest", key)
+}
 
-	return ""
+// report ships err to the error reporting service tagged with the job and,
+// when not empty, the capture timestamp.
+func (j *Job) report(ctx context.Context, err error, timestamp string) {
+	tags := map[string]string{"job_id": j.ID, "url": j.URL, "year": j.Year}
+	if timestamp != "" {
+		tags["timestamp"] = timestamp
+	}
+	reporting.CaptureError(ctx, err, tags)
 }
 
 func exponentialBackoff(retry int) time.Duration {
@@ -307,8 +1152,8 @@ func exponentialBackoff(retry int) time.Duration {
 	return base*time.Duration(math.Pow(2, float64(retry))) + jitter
 }
 
-func (j *Job) generateGetRequest(apiURL string) (*http.Request, error) {
-	req, err := http.NewRequest("GET", apiURL, nil)
+func (j *Job) generateGetRequest(ctx context.Context, apiURL string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -319,8 +1164,7 @@ func (j *Job) generateGetRequest(apiURL string) (*http.Request, error) {
 		"Connection":      "keep-alive",
 	}
 
-	// load from config
-	var cdxAuthToken string = "xxxx-yyy-zzz-www-xxxxx"
+	cdxAuthToken := settings.CDXAuthToken
 
 	if cdxAuthToken != "" {
 		headers["cookie"] = "cdx_auth_token=" + cdxAuthToken
@@ -0,0 +1,99 @@
+package job
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// JOB_LOG_SIZE is the number of log lines kept per job for /job/logs.
+const JOB_LOG_SIZE = 500
+
+// LogEntry is a log line of a job.
+type LogEntry struct {
+	Time    time.Time         `json:"time"`
+	Level   string            `json:"level"`
+	Message string            `json:"message"`
+	Attrs   map[string]string `json:"attrs,omitempty"`
+}
+
+// logBuffer is a bounded ring buffer of the latest log lines of a job.
+type logBuffer struct {
+	mu      sync.Mutex
+	entries []LogEntry
+	next    int
+	full    bool
+}
+
+func newLogBuffer(size int) *logBuffer {
+	return &logBuffer{entries: make([]LogEntry, size)}
+}
+
+func (b *logBuffer) add(e LogEntry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries[b.next] = e
+	b.next = (b.next + 1) % len(b.entries)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// list returns the buffered lines, oldest first.
+func (b *logBuffer) list() []LogEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.full {
+		return append([]LogEntry(nil), b.entries[:b.next]...)
+	}
+	return append(append([]LogEntry(nil), b.entries[b.next:]...), b.entries[:b.next]...)
+}
+
+// bufferHandler passes records to the wrapped handler and keeps those at
+// info level and above in the job's log buffer.
+type bufferHandler struct {
+	slog.Handler
+	buf *logBuffer
+}
+
+func (h bufferHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelInfo || h.Handler.Enabled(ctx, level)
+}
+
+func (h bufferHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelInfo {
+		e := LogEntry{Time: r.Time, Level: r.Level.String(), Message: r.Message}
+		r.Attrs(func(a slog.Attr) bool {
+			// The stack of a recovered panic is too large for the buffer.
+			if a.Key != "stack" {
+				if e.Attrs == nil {
+					e.Attrs = make(map[string]string)
+				}
+				e.Attrs[a.Key] = a.Value.String()
+			}
+			return true
+		})
+		h.buf.add(e)
+	}
+	if !h.Handler.Enabled(ctx, r.Level) {
+		return nil
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h bufferHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return bufferHandler{h.Handler.WithAttrs(attrs), h.buf}
+}
+
+func (h bufferHandler) WithGroup(name string) slog.Handler {
+	return bufferHandler{h.Handler.WithGroup(name), h.buf}
+}
+
+// Logs returns the latest log lines of the job, oldest first.
+func (j *Job) Logs() []LogEntry {
+	if j.logs == nil {
+		return nil
+	}
+	return j.logs.list()
+}
@@ -0,0 +1,104 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/metrics"
+)
+
+// splitMonths reports whether the year of the CDX query params has at least
+// archive.split_months.min_captures captures, so that it is listed per
+// month. It asks for the capture of that rank with offset=, which CDX
+// answers without sending the captures before it. Queries with a limit are
+// never split, CDX stops at the limit anyway.
+func (j *Job) splitMonths(ctx context.Context, endpoint string, params url.Values) bool {
+	cfg := settings.Archive.SplitMonths
+	if !cfg.Enabled || params.Has("limit") || len(params.Get("from")) != 4 || params.Get("from") != params.Get("to") {
+		return false
+	}
+	probe := maps.Clone(params)
+	probe.Set("fl", "timestamp")
+	probe.Set("offset", strconv.Itoa(cfg.MinCaptures-1))
+	probe.Set("limit", "1")
+	lines, err := j.listCaptures(ctx, endpoint, probe)
+	if err != nil {
+		j.logger.Warn("cannot count captures, listing the year at once", "error", err)
+		return false
+	}
+	return len(lines) > 0
+}
+
+// listYear hands the CDX lines selected by params from the timemap endpoint
+// to emit like streamCaptures, but lists huge years, see splitMonths, with a
+// query per month, archive.split_months.concurrency of them at once. The
+// answers are read as fast as CDX sends them, queued and emitted as they
+// arrive, so the lines of different months are interleaved. A year fails
+// when any of its months cannot be listed.
+func (j *Job) listYear(ctx context.Context, endpoint string, params url.Values, emit func(line string)) error {
+	if !j.splitMonths(ctx, endpoint, params) {
+		return j.streamCaptures(ctx, endpoint, params, emit)
+	}
+	metrics.Add(metrics.CDX_MONTHLY_SPLITS, 1)
+	j.logger.Info("listing captures per month")
+
+	var (
+		mu      sync.Mutex
+		pending []string
+		wg      sync.WaitGroup
+	)
+	ready := make(chan struct{}, 1)
+	done := make(chan struct{})
+	sem := make(chan struct{}, settings.Archive.SplitMonths.Concurrency)
+	errs := make([]error, 12)
+	year := params.Get("from")
+	for month := range 12 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			monthParams := maps.Clone(params)
+			from := fmt.Sprintf("%s%02d", year, month+1)
+			monthParams.Set("from", from)
+			monthParams.Set("to", from)
+			err := j.streamCaptures(ctx, endpoint, monthParams, func(line string) {
+				mu.Lock()
+				pending = append(pending, line)
+				mu.Unlock()
+				select {
+				case ready <- struct{}{}:
+				default:
+				}
+			})
+			if err != nil {
+				errs[month] = fmt.Errorf("cannot list captures of %s, %w", from, err)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	for finished := false; !finished; {
+		select {
+		case <-ready:
+		case <-done:
+			finished = true
+		}
+		mu.Lock()
+		lines := pending
+		pending = nil
+		mu.Unlock()
+		for _, line := range lines {
+			emit(line)
+		}
+	}
+	return errors.Join(errs...)
+}
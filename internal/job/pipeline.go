@@ -0,0 +1,113 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/events"
+)
+
+// outcome is the result of the processing of a capture, sent by the workers
+// of a job to its aggregator.
+type outcome struct {
+	url, timestamp, simhash string
+	// failed is set when the processing of the capture panicked, and retry
+	// when it failed transiently, see failTransient, for the CDX line in
+	// capture.
+	failed  bool
+	retry   bool
+	capture string
+}
+
+// process calculates the simhashes of the captures received from in with a
+// pipeline: concurrency workers download and hash them as they arrive, and
+// a single aggregator, the calling goroutine, records their outcomes. The
+// aggregator is the only writer of the results and the progress of the job,
+// which is relative to the captures listed so far. It returns the number of
+// captures whose processing failed and the CDX lines of those that failed
+// transiently, once in is closed and drained.
+func (j *Job) process(ctx context.Context, in <-chan string, concurrency int, opts Options) (int64, []string) {
+	out := make(chan outcome)
+
+	var workers sync.WaitGroup
+	for range concurrency {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for capture := range in {
+				out <- j.processCapture(ctx, capture)
+			}
+		}()
+	}
+	go func() {
+		workers.Wait()
+		close(out)
+	}()
+
+	var failed int64
+	var retry []string
+	for o := range out {
+		if o.failed {
+			failed++
+			continue
+		}
+		if o.retry {
+			retry = append(retry, o.capture)
+			continue
+		}
+		if o.timestamp == "" || o.simhash == "" {
+			continue
+		}
+		j.addResult(o.url, o.timestamp, o.simhash)
+		n := j.processed.Add(1)
+		total := max(int(j.listed.Load()), 1)
+		if n == int64(opts.Preview) {
+			j.preview(ctx, opts)
+		}
+		if n%10 == 0 {
+			j.setInfo(fmt.Sprintf("Processed %d out of %d captures.\n", n, total))
+		}
+		// Publish a progress event each time another tenth of the captures is done.
+		if n*10/int64(total) > (n-1)*10/int64(total) {
+			j.publish(ctx, opts.Events, events.Event{Type: events.JOB_PROGRESS, Processed: n, Total: total})
+		}
+	}
+	return failed, retry
+}
+
+// preview stores the simhashes processed so far and marks the job PARTIAL.
+// The job goes on calculating without a preview when they cannot be stored.
+func (j *Job) preview(ctx context.Context, opts Options) {
+	stored, err := j.Checkpoint(ctx)
+	if err != nil {
+		j.logger.Warn("cannot store preview", "error", err)
+		return
+	}
+	if err := j.setState(PARTIAL); err != nil {
+		j.logger.Warn("cannot mark job partial", "error", err)
+		return
+	}
+	j.logger.Info("stored preview", "stored", stored)
+	j.publish(ctx, opts.Events, events.Event{Type: events.JOB_PARTIAL, Processed: int64(stored), Total: int(j.listed.Load())})
+}
+
+// processCapture calculates the simhash of the capture of a CDX line. A
+// panic is recovered and reported as a failed outcome.
+func (j *Job) processCapture(ctx context.Context, capture string) (o outcome) {
+	defer func() {
+		if r := recover(); r != nil {
+			j.recovered(ctx, r, capture)
+			o = outcome{failed: true}
+		}
+	}()
+	timestamp, simhash := j.GetCalculation(ctx, capture)
+	url, original := j.captureURLs(capture)
+	if simhash == "" {
+		if fields := strings.Fields(capture); len(fields) > 0 && j.takeTransient(original, fields[0]) {
+			return outcome{retry: true, capture: capture}
+		}
+	}
+	return outcome{url: url, timestamp: timestamp, simhash: simhash}
+}
@@ -0,0 +1,157 @@
+package job
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	rtmetrics "runtime/metrics"
+	"sync"
+	"time"
+)
+
+// LATENCY_SMOOTHING is the weight of the latest download in the moving
+// average of upstream latency.
+const LATENCY_SMOOTHING = 0.2
+
+// workerPool bounds the captures downloaded and extracted at once across all
+// jobs. Its limit is adjusted by the autoscaler.
+type workerPool struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	limit   int
+	active  int
+	latency time.Duration
+}
+
+func newWorkerPool(limit int) *workerPool {
+	p := &workerPool{limit: limit}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// pool is unbounded until the autoscaler is started.
+var pool = newWorkerPool(math.MaxInt)
+
+// WorkerLimit returns the current limit of the worker pool, 0 when it is
+// unbounded, and the number of workers in use.
+func WorkerLimit() (limit, active int) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	if pool.limit == math.MaxInt {
+		return 0, pool.active
+	}
+	return pool.limit, pool.active
+}
+
+func (p *workerPool) acquire() {
+	p.mu.Lock()
+	for p.active >= p.limit {
+		p.cond.Wait()
+	}
+	p.active++
+	p.mu.Unlock()
+}
+
+func (p *workerPool) release() {
+	p.mu.Lock()
+	p.active--
+	p.mu.Unlock()
+	p.cond.Signal()
+}
+
+func (p *workerPool) setLimit(limit int) {
+	p.mu.Lock()
+	p.limit = limit
+	p.mu.Unlock()
+	p.cond.Broadcast()
+}
+
+// observeLatency feeds the time web.archive.org took to answer a download
+// into the moving average.
+func (p *workerPool) observeLatency(d time.Duration) {
+	p.mu.Lock()
+	if p.latency == 0 {
+		p.latency = d
+	} else {
+		p.latency = time.Duration(LATENCY_SMOOTHING*float64(d) + (1-LATENCY_SMOOTHING)*float64(p.latency))
+	}
+	p.mu.Unlock()
+}
+
+// StartAutoscaler sizes the worker pool until ctx is done when adaptive
+// workers are configured. Every interval the pool shrinks by a quarter when
+// the process is short of CPU or memory or web.archive.org slows down, and
+// grows by a tenth when it is saturated and none of these hold.
+func StartAutoscaler(ctx context.Context) {
+	cfg := settings.Workers
+	if !cfg.Adaptive {
+		return
+	}
+	pool.setLimit(min(max(settings.Concurrency, cfg.Min), cfg.Max))
+
+	go func() {
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+		cpu := newCPUSampler()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			usage := cpu.sample()
+			heapMB := heapBytes() >> 20
+			pool.mu.Lock()
+			limit, active, latency := pool.limit, pool.active, pool.latency
+			pool.mu.Unlock()
+
+			next := limit
+			switch {
+			case usage > cfg.TargetCPU || heapMB > uint64(cfg.MaxHeapMB) || latency > cfg.TargetLatency:
+				next = max(cfg.Min, limit*3/4)
+			case active >= limit:
+				next = min(cfg.Max, limit+max(1, limit/10))
+			}
+			if next != limit {
+				slog.Debug("resizing worker pool", "from", limit, "to", next, "cpu", usage, "heap_mb", heapMB, "latency", latency)
+				pool.setLimit(next)
+			}
+		}
+	}()
+}
+
+// cpuSampler measures the share of the available CPU time used by the
+// process between samples.
+type cpuSampler struct {
+	samples []rtmetrics.Sample
+	idle    float64
+	total   float64
+}
+
+func newCPUSampler() *cpuSampler {
+	s := &cpuSampler{samples: []rtmetrics.Sample{
+		{Name: "/cpu/classes/idle:cpu-seconds"},
+		{Name: "/cpu/classes/total:cpu-seconds"},
+	}}
+	s.sample()
+	return s
+}
+
+func (s *cpuSampler) sample() float64 {
+	rtmetrics.Read(s.samples)
+	idle, total := s.samples[0].Value.Float64(), s.samples[1].Value.Float64()
+	dIdle, dTotal := idle-s.idle, total-s.total
+	s.idle, s.total = idle, total
+	if dTotal <= 0 {
+		return 0
+	}
+	return 1 - dIdle/dTotal
+}
+
+// heapBytes returns the bytes held by live and not yet swept heap objects.
+func heapBytes() uint64 {
+	sample := []rtmetrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	rtmetrics.Read(sample)
+	return sample[0].Value.Uint64()
+}
@@ -0,0 +1,75 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/metrics"
+)
+
+// RETRY_PASS_DIVISOR divides the concurrency of a job for its retry pass,
+// which goes easy on an archive that just failed it.
+const RETRY_PASS_DIVISOR = 4
+
+// failTransient records that the capture of url at timestamp could not be
+// downloaded for a reason that may go away, a network error, a timeout or a
+// 5xx answer, so that the retry pass of the job tries it again. It returns
+// false when no retry pass follows, i.e. outside of the main pass of a job.
+func (j *Job) failTransient(url, timestamp string) bool {
+	j.resultsMu.Lock()
+	defer j.resultsMu.Unlock()
+	if j.transient == nil {
+		return false
+	}
+	j.transient[url+" "+timestamp] = struct{}{}
+	return true
+}
+
+// transientError reports whether err, reading the body of resp, may go away
+// when the capture is downloaded again: a network error, e.g. a timeout or a
+// reset connection, or a connection closed before the whole body arrived. A
+// compressed body ending early may as well be archived truncated, which is
+// left to the identity retry of download.
+func transientError(err error, resp *http.Response) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) && !encoded(resp)
+}
+
+// takeTransient returns whether the capture of url at timestamp failed
+// transiently, and forgets it.
+func (j *Job) takeTransient(url, timestamp string) bool {
+	j.resultsMu.Lock()
+	defer j.resultsMu.Unlock()
+	key := url + " " + timestamp
+	_, ok := j.transient[key]
+	delete(j.transient, key)
+	return ok
+}
+
+// retryPass processes the CDX lines of the captures that failed transiently
+// during the main pass once more, with a fraction of the concurrency. Their
+// failures are final: 5xx answers are skipped as error pages. It returns the
+// number of captures recovered and of captures whose processing panicked.
+func (j *Job) retryPass(ctx context.Context, captures []string, opts Options) (int, int64) {
+	j.resultsMu.Lock()
+	j.transient = nil
+	j.resultsMu.Unlock()
+	j.logger.Info("retrying failed captures", "count", len(captures))
+	metrics.Add(metrics.RETRY_PASS_CAPTURES, int64(len(captures)))
+
+	in := make(chan string)
+	go func() {
+		defer close(in)
+		for _, capture := range captures {
+			in <- capture
+		}
+	}()
+	before := j.processed.Load()
+	failed, _ := j.process(ctx, in, max(Concurrency()/RETRY_PASS_DIVISOR, 1), opts)
+	recovered := int(j.processed.Load() - before)
+	metrics.Add(metrics.RETRY_PASS_RECOVERED, int64(recovered))
+	return recovered, failed
+}
@@ -0,0 +1,65 @@
+package job
+
+import (
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+)
+
+// Sample describes the captures processed by a job sampling its year, see
+// Options.Sample.
+type Sample struct {
+	// Every is set when every Every-th capture is processed, the first
+	// included, and Fraction when each capture is processed with that
+	// probability.
+	Every    int     `json:"every,omitempty"`
+	Fraction float64 `json:"fraction,omitempty"`
+	// Listed counts the captures listed by CDX, sampled or not.
+	Listed int64 `json:"listed"`
+}
+
+// sampler selects the captures processed by a job, every capture when nil.
+type sampler struct {
+	every    int
+	fraction float64
+	listed   atomic.Int64
+}
+
+func newSampler(sample float64) *sampler {
+	if sample == 0 {
+		return nil
+	}
+	if sample < 1 {
+		return &sampler{fraction: sample}
+	}
+	return &sampler{every: int(sample)}
+}
+
+// keep returns whether the next capture listed is processed.
+func (s *sampler) keep() bool {
+	if s == nil {
+		return true
+	}
+	n := s.listed.Add(1)
+	if s.fraction > 0 {
+		return rand.Float64() < s.fraction
+	}
+	return (n-1)%int64(s.every) == 0
+}
+
+// String describes the sample for the info of the job.
+func (s *sampler) String() string {
+	if s.fraction > 0 {
+		return fmt.Sprintf("sampled %g of %d listed", s.fraction, s.listed.Load())
+	}
+	return fmt.Sprintf("sampled 1 in %d of %d listed", s.every, s.listed.Load())
+}
+
+// Sample returns the sample of the captures processed by the job, nil when
+// it processes every capture.
+func (j *Job) Sample() *Sample {
+	if j.sampler == nil {
+		return nil
+	}
+	return &Sample{Every: j.sampler.every, Fraction: j.sampler.fraction, Listed: j.sampler.listed.Load()}
+}
@@ -0,0 +1,75 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/events"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RunSnapshot executes a new job that captures url now with capture, which
+// returns the timestamp of the new capture, then calculates and stores its
+// simhash. It returns the job_id. The job outlives ctx.
+func (j *Job) RunSnapshot(ctx context.Context, redisClient *redis.Client, url string, opts Options, capture func(context.Context, string) (string, error)) string {
+	jobID := j.init(ctx, redisClient, url, time.Now().UTC().Format("2006"), opts)
+	j.setInfo(fmt.Sprintf("Capturing %s", url))
+
+	ctx = context.WithoutCancel(ctx)
+	runningJobs.Add(1)
+	go func() {
+		defer close(j.done)
+		defer runningJobs.Add(-1)
+		defer j.recordUsage(ctx)
+		defer func() {
+			if r := recover(); r != nil {
+				j.setState(FAILURE)
+				j.setInfo(fmt.Sprintf("job failed unexpectedly, %v", r))
+				j.recovered(ctx, r, "")
+				j.publish(ctx, opts.Events, events.Event{Type: events.JOB_FAILED, Info: j.Info()})
+			}
+		}()
+		fail := func(info string, err error) {
+			j.setState(FAILURE)
+			j.setInfo(fmt.Sprintf("%s, %s", info, err.Error()))
+			j.logger.Error(info, "error", err)
+			j.report(ctx, err, "")
+			j.publish(ctx, opts.Events, events.Event{Type: events.JOB_FAILED, Info: j.Info()})
+		}
+
+		j.setState(STARTED)
+		timestamp, err := capture(ctx, url)
+		if err != nil {
+			fail(fmt.Sprintf("cannot capture %s", url), err)
+			return
+		}
+
+		j.setState(PROGRESS)
+		j.setInfo(fmt.Sprintf("Calculating the simhash of capture %s", timestamp))
+		j.publish(ctx, opts.Events, events.Event{Type: events.JOB_STARTED, Total: 1})
+		hash, _, err := j.computeSimhash(ctx, url, timestamp)
+		if err != nil {
+			fail(fmt.Sprintf("cannot calculate the simhash of capture %s", timestamp), err)
+			return
+		}
+		j.processed.Add(1)
+		results := map[string]string{timestamp: hash}
+		if err := j.storeResults(ctx, redisClient, results, opts); err != nil {
+			fail("cannot store simhashes", err)
+			return
+		}
+
+		j.setDuration(time.Since(j.startTime))
+		j.uploadArtifacts(ctx, map[string]map[string]string{url: results})
+		j.setInfo(fmt.Sprintf("Captured %s at %s.\n", url, timestamp))
+		if err := j.setState(SUCCESS); err != nil {
+			j.logger.Warn("cannot complete job", "error", err)
+		}
+		j.logger.Info("snapshot simhash calculated", "duration_sec", j.Duration().Seconds(), "timestamp", timestamp)
+		j.publish(ctx, opts.Events, events.Event{Type: events.JOB_COMPLETED, Processed: 1, Total: 1, Info: j.Info()})
+	}()
+
+	return jobID
+}
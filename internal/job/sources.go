@@ -0,0 +1,137 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/config"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/utils"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// archiveSources returns the configured archive followed by the further
+// archives whose captures are merged with its own.
+func archiveSources() []config.ArchiveSource {
+	primary := config.ArchiveSource{
+		Name:       settings.Archive.Name,
+		TimemapURL: settings.Archive.TimemapURL,
+		ReplayURL:  settings.Archive.ReplayURL,
+	}
+	return append([]config.ArchiveSource{primary}, settings.Archive.Sources...)
+}
+
+// fetchMerged requests the CDX lines selected by params from every archive
+// and merges them, see mergeCaptures. The merged captures are limited to
+// limit, unless -1, like those of a single archive. A job fails when any
+// archive cannot be listed, so that recalculations do not drop the
+// simhashes of its captures.
+func (j *Job) fetchMerged(ctx context.Context, params url.Values, limit int) ([]string, error) {
+	sources := archiveSources()
+	lists := make([][]string, len(sources))
+	errs := make([]error, len(sources))
+	var wg sync.WaitGroup
+	for i, source := range sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lists[i], errs[i] = j.listCaptures(ctx, source.TimemapURL, params)
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("cannot list captures of archive %s, %w", sources[i].Name, err)
+		}
+	}
+
+	captures, bySource := mergeCaptures(lists)
+	if limit != -1 && len(captures) > limit {
+		captures = captures[:limit]
+	}
+	j.resultsMu.Lock()
+	j.sources = bySource
+	j.resultsMu.Unlock()
+	for i, source := range sources {
+		j.logger.Debug("listed captures of archive", "archive", source.Name, "captures", len(lists[i]))
+	}
+	return captures, nil
+}
+
+// mergeCaptures merges the "timestamp digest" CDX lines of several archives,
+// in the order of the archives, into lines sorted by timestamp. A capture is
+// dropped when an earlier one has the same timestamp, or the same digest in
+// the same collapse window, the first 9 digits of the timestamp. It also
+// returns the index of the archive of each timestamp kept.
+func mergeCaptures(lists [][]string) ([]string, map[string]int) {
+	var merged []string
+	sources := make(map[string]int)
+	seen := make(map[string]bool)
+	for i, lines := range lists {
+		for _, line := range lines {
+			parts := strings.Fields(line)
+			if len(parts) < 2 {
+				continue
+			}
+			timestamp, digest := parts[0], parts[1]
+			window := timestamp[:min(9, len(timestamp))] + " " + digest
+			if _, ok := sources[timestamp]; ok || seen[window] {
+				continue
+			}
+			seen[window] = true
+			sources[timestamp] = i
+			merged = append(merged, timestamp+" "+digest)
+		}
+	}
+	slices.Sort(merged)
+	return merged, sources
+}
+
+// captureSource returns the archive the capture at timestamp is downloaded
+// from, false when captures are not merged from several archives.
+func (j *Job) captureSource(timestamp string) (config.ArchiveSource, bool) {
+	j.resultsMu.Lock()
+	i, ok := j.sources[timestamp]
+	j.resultsMu.Unlock()
+	if !ok {
+		return config.ArchiveSource{}, false
+	}
+	return archiveSources()[i], true
+}
+
+// sourceLabels returns the archive name of each timestamp of results, nil
+// when captures are not merged from several archives.
+func (j *Job) sourceLabels(results map[string]string) map[string]string {
+	j.resultsMu.Lock()
+	defer j.resultsMu.Unlock()
+	if j.sources == nil {
+		return nil
+	}
+	sources := archiveSources()
+	labels := make(map[string]string, len(results))
+	for timestamp := range results {
+		if i, ok := j.sources[timestamp]; ok {
+			labels[timestamp] = sources[i].Name
+		}
+	}
+	return labels
+}
+
+// storeSources writes the archive of each capture of results next to their
+// simhashes stored under urlKey.
+func (j *Job) storeSources(ctx context.Context, redisClient *redis.Client, urlKey string, results map[string]string) error {
+	labels := j.sourceLabels(results)
+	if len(labels) == 0 {
+		return nil
+	}
+	sourcesKey := utils.SourcesKey(urlKey)
+	pipe := redisClient.TxPipeline()
+	pipe.HSet(ctx, sourcesKey, labels)
+	pipe.Expire(ctx, sourcesKey, settings.Simhash.ExpireAfter)
+	_, err := pipe.Exec(ctx)
+	return err
+}
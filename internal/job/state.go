@@ -0,0 +1,118 @@
+package job
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// State is the state of a job. The names are the Celery states exposed by
+// the Python service the API replaces.
+type State string
+
+const (
+	// PENDING jobs are accepted and not started yet.
+	PENDING State = "PENDING"
+	// STARTED jobs are fetching their captures from CDX.
+	STARTED State = "STARTED"
+	// PROGRESS jobs are calculating the simhashes of their captures.
+	PROGRESS State = "PROGRESS"
+	// PARTIAL jobs stored the simhashes of their first captures, which can
+	// be read already, and are calculating the rest, see Options.Preview.
+	PARTIAL State = "PARTIAL"
+	// SUCCESS jobs finished and stored their simhashes.
+	SUCCESS State = "SUCCESS"
+	// FAILURE jobs stopped on an error.
+	FAILURE State = "FAILURE"
+	// REVOKED jobs were interrupted, e.g. by a shutdown.
+	REVOKED State = "REVOKED"
+)
+
+// transitions lists the states each state may move to.
+var transitions = map[State][]State{
+	PENDING:  {STARTED, FAILURE, REVOKED},
+	STARTED:  {PROGRESS, FAILURE, REVOKED},
+	PROGRESS: {PARTIAL, SUCCESS, FAILURE, REVOKED},
+	PARTIAL:  {SUCCESS, FAILURE, REVOKED},
+}
+
+// Running reports whether a job in state s has not finished yet.
+func (s State) Running() bool {
+	return s == PENDING || s == STARTED || s == PROGRESS || s == PARTIAL
+}
+
+// Transition records when a job entered a state.
+type Transition struct {
+	State State     `json:"state"`
+	At    time.Time `json:"at"`
+}
+
+// State returns the current state of the job.
+func (j *Job) State() State {
+	j.stateMu.Lock()
+	defer j.stateMu.Unlock()
+	return j.state
+}
+
+// Info describes the progress of the job, or why it failed.
+func (j *Job) Info() string {
+	j.stateMu.Lock()
+	defer j.stateMu.Unlock()
+	return j.info
+}
+
+func (j *Job) setInfo(info string) {
+	j.stateMu.Lock()
+	defer j.stateMu.Unlock()
+	j.info = info
+}
+
+// Duration is how long the job took, zero until it is done.
+func (j *Job) Duration() time.Duration {
+	j.stateMu.Lock()
+	defer j.stateMu.Unlock()
+	return j.duration
+}
+
+func (j *Job) setDuration(duration time.Duration) {
+	j.stateMu.Lock()
+	defer j.stateMu.Unlock()
+	j.duration = duration
+}
+
+// ArtifactsKey is the key of the manifest of the uploaded results, empty
+// until they are uploaded.
+func (j *Job) ArtifactsKey() string {
+	j.stateMu.Lock()
+	defer j.stateMu.Unlock()
+	return j.artifactsKey
+}
+
+// Transitions returns the states the job went through, oldest first.
+func (j *Job) Transitions() []Transition {
+	j.stateMu.Lock()
+	defer j.stateMu.Unlock()
+	return slices.Clone(j.transitions)
+}
+
+// setState moves the job to state. It fails when the current state cannot
+// move to it, e.g. once the job has finished.
+func (j *Job) setState(state State) error {
+	j.stateMu.Lock()
+	defer j.stateMu.Unlock()
+	if j.state != "" && !slices.Contains(transitions[j.state], state) {
+		return fmt.Errorf("job %s cannot move from %s to %s", j.ID, j.state, state)
+	}
+	j.state = state
+	j.transitions = append(j.transitions, Transition{State: state, At: time.Now().UTC()})
+	return nil
+}
+
+// Revoke marks a running job interrupted with info.
+func (j *Job) Revoke(info string) error {
+	if err := j.setState(REVOKED); err != nil {
+		return err
+	}
+	j.setInfo(info)
+	return nil
+}
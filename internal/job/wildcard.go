@@ -0,0 +1,130 @@
+package job
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/utils"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// IsWildcard reports whether url ends with /*, matching every URL below the
+// prefix, e.g. example.com/*.
+func IsWildcard(url string) bool {
+	return strings.HasSuffix(url, "/*")
+}
+
+// URLProgress is the progress of one URL of a wildcard job.
+type URLProgress struct {
+	URL       string `json:"url"`
+	Captures  int    `json:"captures"`
+	Processed int    `json:"processed"`
+}
+
+// URLs returns the progress of each URL matched by a wildcard job, sorted by
+// URL, and nil for other jobs.
+func (j *Job) URLs() []URLProgress {
+	j.resultsMu.Lock()
+	defer j.resultsMu.Unlock()
+	if len(j.urlTotals) == 0 {
+		return nil
+	}
+	progress := make([]URLProgress, 0, len(j.urlTotals))
+	for u, total := range j.urlTotals {
+		progress = append(progress, URLProgress{URL: u, Captures: total, Processed: len(j.urlResults[u])})
+	}
+	slices.SortFunc(progress, func(a, b URLProgress) int { return strings.Compare(a.URL, b.URL) })
+	return progress
+}
+
+// groupByURL turns the "timestamp digest original" lines of a prefix CDX
+// query, sorted by URL then timestamp, into capture lines naming the URL each
+// capture is stored under, the original without its scheme and default port.
+// Captures of a
+// URL are collapsed on the first 9 digits of their timestamp, like the CDX
+// query of a single URL. Names are scoped to the Archive-It collection when
+// not empty. It also returns the number of captures of each URL.
+func groupByURL(lines []string, collection string) ([]string, map[string]int) {
+	last := make(map[string]string)
+	totals := make(map[string]int)
+	var captures []string
+	for _, line := range lines {
+		parts := strings.Fields(line)
+		if len(parts) < 3 {
+			continue
+		}
+		timestamp, digest, original := parts[0], parts[1], parts[2]
+		name, ok := utils.TrimScheme(original)
+		if !ok {
+			name = original
+		}
+		name = utils.InCollection(name, collection)
+		if len(timestamp) < 9 || last[name] == timestamp[:9] {
+			continue
+		}
+		last[name] = timestamp[:9]
+		totals[name]++
+		captures = append(captures, strings.Join([]string{timestamp, digest, name, original}, " "))
+	}
+	return captures, totals
+}
+
+// captureURLs returns the URL a capture line is stored under and the URL it
+// is downloaded from, both the URL of the job unless it is a wildcard job.
+func (j *Job) captureURLs(capture string) (string, string) {
+	parts := strings.Fields(capture)
+	if len(parts) < 4 {
+		return j.URL, j.URL
+	}
+	return parts[2], parts[3]
+}
+
+// addResult records the simhash of a capture of url.
+func (j *Job) addResult(url, timestamp, simhash string) {
+	j.resultsMu.Lock()
+	defer j.resultsMu.Unlock()
+	if url == j.URL {
+		j.results[timestamp] = simhash
+		return
+	}
+	if j.urlResults[url] == nil {
+		j.urlResults[url] = make(map[string]string)
+	}
+	j.urlResults[url][timestamp] = simhash
+}
+
+// resultsByURL returns a copy of the simhashes computed so far, url ->
+// timestamp -> simhash.
+func (j *Job) resultsByURL() map[string]map[string]string {
+	j.resultsMu.Lock()
+	defer j.resultsMu.Unlock()
+	byURL := make(map[string]map[string]string, len(j.urlResults)+1)
+	if len(j.results) > 0 {
+		byURL[j.URL] = maps.Clone(j.results)
+	}
+	for u, results := range j.urlResults {
+		byURL[u] = maps.Clone(results)
+	}
+	return byURL
+}
+
+// storeAll writes the simhashes of every URL of the job under the URL's own
+// key, as storeResults does for the URL of the job.
+func (j *Job) storeAll(ctx context.Context, redisClient *redis.Client, byURL map[string]map[string]string, opts Options) error {
+	for u, results := range byURL {
+		if u == j.URL {
+			if err := j.storeResults(ctx, redisClient, results, opts); err != nil {
+				return err
+			}
+			continue
+		}
+		view := &Job{URL: u, Year: j.Year, SimhashSize: j.SimhashSize, Extractor: j.Extractor, logger: j.logger.With("capture_url", u)}
+		if err := view.storeResults(ctx, redisClient, results, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
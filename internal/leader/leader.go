@@ -0,0 +1,146 @@
+package leader
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// renewScript extends the lease in KEYS[1] when it is held by ARGV[1].
+var renewScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseScript deletes the lease in KEYS[1] when it is held by ARGV[1].
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// Elector elects one instance of the cluster as leader through a lease in
+// Redis. A nil Elector, used when election is disabled, is always leader.
+type Elector struct {
+	redisClient *redis.Client
+	key         string
+	id          string
+	ttl         time.Duration
+	leader      atomic.Bool
+}
+
+// New returns an elector for cfg, or nil when election is disabled.
+func New(redisClient *redis.Client, cfg config.LeaderConfig) *Elector {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &Elector{redisClient: redisClient, key: cfg.Key, id: instanceID(), ttl: cfg.TTL}
+}
+
+// ID returns the ID of this instance in the election.
+func (e *Elector) ID() string {
+	if e == nil {
+		return ""
+	}
+	return e.id
+}
+
+// IsLeader reports whether this instance currently holds the lease.
+func (e *Elector) IsLeader() bool {
+	return e == nil || e.leader.Load()
+}
+
+// Run campaigns for the lease and renews it until ctx is done.
+func (e *Elector) Run(ctx context.Context) {
+	if e == nil {
+		return
+	}
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+	for {
+		e.campaign(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// campaign acquires the lease when it is free or renews it when held.
+func (e *Elector) campaign(ctx context.Context) {
+	held, err := e.redisClient.SetNX(ctx, e.key, e.id, e.ttl).Result()
+	if err == nil && !held {
+		var renewed int64
+		renewed, err = renewScript.Run(ctx, e.redisClient, []string{e.key}, e.id, e.ttl.Milliseconds()).Int64()
+		held = renewed == 1
+	}
+	if err != nil {
+		// Without Redis the lease cannot be renewed, so another instance may
+		// take over once it expires.
+		slog.Warn("leader election failed", "key", e.key, "error", err)
+		held = false
+	}
+
+	if was := e.leader.Swap(held); was != held {
+		if held {
+			slog.Info("elected leader", "key", e.key, "id", e.id)
+		} else {
+			slog.Info("lost leadership", "key", e.key, "id", e.id)
+		}
+	}
+}
+
+// Resign gives the lease up so another instance can take over at once. It
+// is called on shutdown, after the context of Run is done.
+func (e *Elector) Resign() {
+	if e == nil || !e.leader.Swap(false) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := releaseScript.Run(ctx, e.redisClient, []string{e.key}, e.id).Err(); err != nil {
+		slog.Warn("cannot release leadership", "key", e.key, "error", err)
+	}
+}
+
+// Every runs task every interval until ctx is done, on the leader only, so
+// it runs once across the cluster.
+func (e *Elector) Every(ctx context.Context, name string, interval time.Duration, task func(context.Context) error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if !e.IsLeader() {
+				continue
+			}
+			if err := task(ctx); err != nil {
+				slog.Warn("background task failed", "task", name, "error", err)
+			}
+		}
+	}()
+}
+
+// instanceID identifies this process among the instances of the cluster.
+func instanceID() string {
+	host, _ := os.Hostname()
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(b))
+}
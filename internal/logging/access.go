@@ -0,0 +1,66 @@
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/config"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// AccessLog writes one line per HTTP request to a rotated file, separately
+// from the application logs.
+type AccessLog struct {
+	*slog.Logger
+	file *lumberjack.Logger
+	stop chan struct{}
+}
+
+// NewAccessLog opens the access log described by cfg. The file is rotated
+// when it grows over cfg.MaxSizeMB and, when cfg.RotateInterval is set, on
+// that interval regardless of its size.
+func NewAccessLog(cfg config.AccessLogConfig) (*AccessLog, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("access log path is required")
+	}
+	file := &lumberjack.Logger{
+		Filename:   cfg.Path,
+		MaxSize:    cfg.MaxSizeMB,
+		MaxAge:     cfg.MaxAgeDays,
+		MaxBackups: cfg.MaxBackups,
+		Compress:   cfg.Compress,
+	}
+	handler, err := newHandler(file, slog.LevelInfo, cfg.Format)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	a := &AccessLog{Logger: slog.New(handler), file: file, stop: make(chan struct{})}
+	if cfg.RotateInterval > 0 {
+		go a.rotateEvery(cfg.RotateInterval)
+	}
+	return a, nil
+}
+
+func (a *AccessLog) rotateEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := a.file.Rotate(); err != nil {
+				slog.Warn("cannot rotate access log", "path", a.file.Filename, "error", err)
+			}
+		case <-a.stop:
+			return
+		}
+	}
+}
+
+// Close stops the time based rotation and closes the file.
+func (a *AccessLog) Close() error {
+	close(a.stop)
+	return a.file.Close()
+}
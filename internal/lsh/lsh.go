@@ -0,0 +1,163 @@
+package lsh
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/utils"
+	"github.com/Yaxhveer/wayback-discover-diff-go/pkg/simhash"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// BAND_BYTES is the width of a band. A simhash of n bytes is split into
+// n/BAND_BYTES bands, so two hashes within a hamming distance smaller than
+// the number of bands are guaranteed to share at least one bucket.
+const BAND_BYTES = 2
+
+// Member identifies a capture stored in the index.
+type Member struct {
+	URL       string
+	Timestamp string
+}
+
+// Match is a capture found within the queried distance.
+type Match struct {
+	URL       string `json:"url"`
+	Timestamp string `json:"timestamp"`
+	Distance  int    `json:"distance"`
+}
+
+// bucketKeys returns the Redis keys of the buckets hash falls into.
+func bucketKeys(hash []byte) []string {
+	keys := make([]string, 0, (len(hash)+BAND_BYTES-1)/BAND_BYTES)
+	for band, i := 0, 0; i < len(hash); band, i = band+1, i+BAND_BYTES {
+		keys = append(keys, fmt.Sprintf("lsh:%d:%d:%s", len(hash)*8, band, hex.EncodeToString(hash[i:min(i+BAND_BYTES, len(hash))])))
+	}
+	return keys
+}
+
+// encodeMember packs a capture into a bucket member; the timestamp has a
+// fixed width so the URL can contain any character.
+func encodeMember(url, timestamp string) string {
+	return timestamp + " " + url
+}
+
+func decodeMember(member string) (Member, bool) {
+	if len(member) < 16 || member[14] != ' ' {
+		return Member{}, false
+	}
+	return Member{URL: member[15:], Timestamp: member[:14]}, true
+}
+
+// MaxGuaranteedDistance is the largest distance for which a query over
+// simhashes of size bits cannot miss a match.
+func MaxGuaranteedDistance(size int) int {
+	return (size/8+BAND_BYTES-1)/BAND_BYTES - 1
+}
+
+// Index adds the base64 simhashes of url's captures (timestamp -> simhash) to
+// the LSH buckets. Buckets expire together with the stored simhashes.
+func Index(ctx context.Context, redisClient *redis.Client, url string, simhashes map[string]string, expire time.Duration) error {
+	pipe := redisClient.Pipeline()
+	touched := make(map[string]struct{})
+	for timestamp, encoded := range simhashes {
+		hash, err := simhash.Decode(encoded, simhash.EncodingBase64)
+		if err != nil {
+			return fmt.Errorf("cannot decode simhash of %s at %s, %w", url, timestamp, err)
+		}
+		for _, key := range bucketKeys(hash) {
+			pipe.SAdd(ctx, key, encodeMember(url, timestamp))
+			touched[key] = struct{}{}
+		}
+	}
+	for key := range touched {
+		pipe.Expire(ctx, key, expire)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Remove drops the base64 simhashes of url's captures (timestamp -> simhash)
+// from the LSH buckets.
+func Remove(ctx context.Context, redisClient *redis.Client, url string, simhashes map[string]string) error {
+	pipe := redisClient.Pipeline()
+	for timestamp, encoded := range simhashes {
+		hash, err := simhash.Decode(encoded, simhash.EncodingBase64)
+		if err != nil {
+			return fmt.Errorf("cannot decode simhash of %s at %s, %w", url, timestamp, err)
+		}
+		for _, key := range bucketKeys(hash) {
+			pipe.SRem(ctx, key, encodeMember(url, timestamp))
+		}
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Candidates returns every indexed capture sharing at least one band with hash.
+func Candidates(ctx context.Context, redisClient *redis.Client, hash []byte) ([]Member, error) {
+	members, err := redisClient.SUnion(ctx, bucketKeys(hash)...).Result()
+	if err != nil {
+		return nil, err
+	}
+	candidates := make([]Member, 0, len(members))
+	for _, m := range members {
+		if member, ok := decodeMember(m); ok {
+			candidates = append(candidates, member)
+		}
+	}
+	return candidates, nil
+}
+
+// Query returns the indexed captures within maxDistance of hash, closest
+// first. When url is not empty only captures of that URL are considered.
+func Query(ctx context.Context, redisClient *redis.Client, hash []byte, maxDistance int, url string) ([]Match, error) {
+	candidates, err := Candidates(ctx, redisClient, hash)
+	if err != nil {
+		return nil, err
+	}
+	if url != "" {
+		filtered := candidates[:0]
+		for _, m := range candidates {
+			if m.URL == url {
+				filtered = append(filtered, m)
+			}
+		}
+		candidates = filtered
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	pipe := redisClient.Pipeline()
+	cmds := make([]*redis.StringCmd, len(candidates))
+	for i, m := range candidates {
+		cmds[i] = pipe.HGet(ctx, utils.Surt(m.URL), m.Timestamp)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	var matches []Match
+	for i, cmd := range cmds {
+		other, err := simhash.Decode(cmd.Val(), simhash.EncodingBase64)
+		if err != nil || len(other) != len(hash) {
+			// expired or overwritten at a different size since it was indexed
+			continue
+		}
+		if distance, _ := simhash.Hamming(hash, other); distance <= maxDistance {
+			matches = append(matches, Match{URL: candidates[i].URL, Timestamp: candidates[i].Timestamp, Distance: distance})
+		}
+	}
+	sort.Slice(matches, func(a, b int) bool {
+		if matches[a].Distance != matches[b].Distance {
+			return matches[a].Distance < matches[b].Distance
+		}
+		return matches[a].Timestamp < matches[b].Timestamp
+	})
+	return matches, nil
+}
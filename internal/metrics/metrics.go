@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/config"
+	"github.com/cactus/go-statsd-client/v5/statsd"
+)
+
+// Counter names.
+const (
+	DIGEST_CACHE_HITS      = "digest_cache.hits"
+	DIGEST_CACHE_MISSES    = "digest_cache.misses"
+	HASH_CACHE_HITS        = "hash_cache.hits"
+	HASH_CACHE_MISSES      = "hash_cache.misses"
+	DOWNLOAD_BYTES         = "download.bytes"
+	DOWNLOAD_BYTES_AVOIDED = "download.bytes_avoided"
+	MEMORY_BUDGET_WAITS    = "memory_budget.waits"
+	RATE_LIMITED           = "rate_limit.refused"
+	CDX_FALLBACKS          = "cdx.fallbacks"
+	CDX_MONTHLY_SPLITS     = "cdx.monthly_splits"
+	CAPTURES_SKIPPED       = "captures.skipped"
+	DATANODE_RETRIES       = "download.datanode_retries"
+	IDENTITY_RETRIES       = "download.identity_retries"
+	CONCURRENCY_DECREASES  = "download.concurrency_decreases"
+	RETRY_PASS_CAPTURES    = "retry_pass.captures"
+	RETRY_PASS_RECOVERED   = "retry_pass.recovered"
+)
+
+var (
+	mu       sync.RWMutex
+	counters = make(map[string]*atomic.Int64)
+	statter  statsd.Statter
+)
+
+// Setup starts shipping counters to the statsd server of cfg when enabled.
+// The returned function flushes and closes the client.
+func Setup(cfg config.StatsdConfig) (func() error, error) {
+	if !cfg.Enabled {
+		return func() error { return nil }, nil
+	}
+	client, err := statsd.NewClientWithConfig(&statsd.ClientConfig{
+		Address:       cfg.Address,
+		Prefix:        cfg.Prefix,
+		UseBuffered:   true,
+		FlushInterval: time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot create statsd client, %w", err)
+	}
+	statter = client
+	return client.Close, nil
+}
+
+// Add increments the counter name by n.
+func Add(name string, n int64) {
+	if n == 0 {
+		return
+	}
+	counter(name).Add(n)
+	if statter != nil {
+		if err := statter.Inc(name, n, 1); err != nil {
+			slog.Debug("cannot send statsd counter", "name", name, "error", err)
+		}
+	}
+}
+
+func counter(name string) *atomic.Int64 {
+	mu.RLock()
+	c, ok := counters[name]
+	mu.RUnlock()
+	if ok {
+		return c
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if c, ok = counters[name]; !ok {
+		c = new(atomic.Int64)
+		counters[name] = c
+	}
+	return c
+}
+
+// Snapshot returns the current value of every counter.
+func Snapshot() map[string]int64 {
+	mu.RLock()
+	defer mu.RUnlock()
+	values := make(map[string]int64, len(counters))
+	for name, c := range counters {
+		values[name] = c.Load()
+	}
+	return values
+}
+
+// Ratio returns hits/(hits+misses), or 0 before any lookup.
+func Ratio(hits, misses int64) float64 {
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
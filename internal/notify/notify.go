@@ -0,0 +1,134 @@
+// Package notify tells operators about job outcomes through Slack and email.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/config"
+)
+
+// SEND_TIMEOUT bounds the delivery of a notification to each channel.
+const SEND_TIMEOUT = 30 * time.Second
+
+// Outcome is the outcome of a job, the data of the message template.
+type Outcome struct {
+	JobID     string
+	URL       string
+	Year      string
+	State     string
+	Duration  time.Duration
+	Processed int64
+	Total     int
+	Failed    int64
+	Info      string
+}
+
+// Notifier sends the outcomes of jobs to the configured channels. A nil
+// Notifier sends nothing.
+type Notifier struct {
+	cfg        config.NotifyConfig
+	template   *template.Template
+	httpClient *http.Client
+	wg         sync.WaitGroup
+}
+
+// New returns a notifier for cfg, or nil when no channel is enabled.
+func New(cfg config.NotifyConfig) *Notifier {
+	if !cfg.Slack.Enabled && !cfg.Email.Enabled {
+		return nil
+	}
+	return &Notifier{
+		cfg:        cfg,
+		template:   template.Must(template.New("notify").Parse(cfg.Template)),
+		httpClient: &http.Client{Timeout: SEND_TIMEOUT},
+	}
+}
+
+// Notify sends o in the background when its job failed, or completed after
+// running for at least the configured duration.
+func (n *Notifier) Notify(o Outcome) {
+	if n == nil {
+		return
+	}
+	failed := o.State == "FAILURE" || o.State == "REVOKED"
+	if failed && !n.cfg.OnFailure || !failed && (!n.cfg.OnCompletion || o.Duration < n.cfg.MinDuration) {
+		return
+	}
+	o.Duration = o.Duration.Round(time.Second)
+	var buf bytes.Buffer
+	if err := n.template.Execute(&buf, o); err != nil {
+		slog.Warn("cannot render notification", "job_id", o.JobID, "error", err)
+		return
+	}
+	text := strings.TrimSpace(buf.String())
+	subject := fmt.Sprintf("[wayback-discover-diff] job %s %s", o.State, o.URL)
+
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), SEND_TIMEOUT)
+		defer cancel()
+		if n.cfg.Slack.Enabled {
+			if err := n.postSlack(ctx, text); err != nil {
+				slog.Warn("cannot notify Slack", "job_id", o.JobID, "error", err)
+			}
+		}
+		if n.cfg.Email.Enabled {
+			if err := n.sendEmail(subject, text); err != nil {
+				slog.Warn("cannot notify by email", "job_id", o.JobID, "error", err)
+			}
+		}
+	}()
+}
+
+// Wait waits for the notifications being sent.
+func (n *Notifier) Wait() {
+	if n != nil {
+		n.wg.Wait()
+	}
+}
+
+// postSlack posts text to the Slack incoming webhook.
+func (n *Notifier) postSlack(ctx context.Context, text string) error {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.cfg.Slack.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// sendEmail mails text with subject to the configured recipients.
+func (n *Notifier) sendEmail(subject, text string) error {
+	cfg := n.cfg.Email
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		host, _, _ := strings.Cut(cfg.Addr, ":")
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, host)
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n",
+		cfg.From, strings.Join(cfg.To, ", "), subject, time.Now().Format(time.RFC1123Z), text)
+	return smtp.SendMail(cfg.Addr, auth, cfg.From, cfg.To, []byte(msg))
+}
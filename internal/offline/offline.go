@@ -0,0 +1,142 @@
+package offline
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/job"
+)
+
+// EXTENSIONS are the file extensions hashed by default when walking a
+// directory.
+var EXTENSIONS = []string{".html", ".htm", ".xhtml"}
+
+// Options configures how local documents are hashed.
+type Options struct {
+	SimhashSize int
+	Extractor   string
+	// Extensions selects the files hashed when walking a directory, all
+	// files when empty. Files named explicitly are always hashed.
+	Extensions []string
+	// Workers is the number of documents hashed at once.
+	Workers int
+}
+
+// Result is the simhash of a local document, or the error hashing it.
+type Result struct {
+	Path    string `json:"path"`
+	Simhash string `json:"simhash,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Hash computes the simhash of each file of paths, and of each file with one
+// of the selected extensions below the directories of paths, with the same
+// extraction and algorithm as jobs use for captures. Results are passed to fn
+// as they complete, one at a time and in no particular order. Hash stops at
+// the first error returned by fn, when walking a directory fails or when ctx
+// is done.
+func Hash(ctx context.Context, paths []string, opts Options, fn func(Result) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	files := make(chan string)
+	results := make(chan Result)
+	var wg sync.WaitGroup
+	for range max(opts.Workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range files {
+				select {
+				case results <- hashFile(path, opts):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	walkErr := make(chan error, 1)
+	go func() {
+		defer close(files)
+		walkErr <- walk(ctx, paths, opts.Extensions, files)
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var err error
+	for result := range results {
+		if err == nil {
+			if err = fn(result); err != nil {
+				cancel()
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if err := <-walkErr; err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// walk sends the files to hash to files.
+func walk(ctx context.Context, paths, extensions []string, files chan<- string) error {
+	send := func(path string) error {
+		select {
+		case files <- path:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	for _, root := range paths {
+		info, err := os.Stat(root)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			if err := send(root); err != nil {
+				return err
+			}
+			continue
+		}
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.Type().IsRegular() && selected(path, extensions) {
+				return send(path)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func selected(path string, extensions []string) bool {
+	return len(extensions) == 0 || slices.Contains(extensions, strings.ToLower(filepath.Ext(path)))
+}
+
+func hashFile(path string, opts Options) Result {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Result{Path: path, Error: err.Error()}
+	}
+	hash, err := job.HashDocument(string(data), opts.SimhashSize, opts.Extractor)
+	if err != nil {
+		return Result{Path: path, Error: err.Error()}
+	}
+	return Result{Path: path, Simhash: hash}
+}
@@ -0,0 +1,273 @@
+// Package parquet writes flat tables as Apache Parquet files, the columnar
+// format data-science tools read best. It only supports what the simhash
+// datasets need: required string, int32 and int64 columns, PLAIN encoded in
+// GZIP compressed pages.
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// MAGIC starts and ends every Parquet file.
+const MAGIC = "PAR1"
+
+// ROW_GROUP_ROWS is the number of rows of each row group, so that a writer
+// holds a bounded number of rows in memory.
+const ROW_GROUP_ROWS = 100_000
+
+// CREATED_BY names the writer in the footer.
+const CREATED_BY = "wayback-discover-diff"
+
+// Values of the Parquet format enums.
+const (
+	TYPE_INT32       = 1
+	TYPE_INT64       = 2
+	TYPE_BYTE_ARRAY  = 6
+	REQUIRED         = 0
+	CONVERTED_UTF8   = 0
+	ENCODING_PLAIN   = 0
+	ENCODING_RLE     = 3
+	CODEC_GZIP       = 2
+	PAGE_DATA        = 0
+	FORMAT_VERSION_1 = 1
+)
+
+// Type is the type of a column.
+type Type int
+
+const (
+	STRING Type = iota
+	INT32
+	INT64
+)
+
+// Column describes a column of the table.
+type Column struct {
+	Name string
+	Type Type
+}
+
+func (c Column) physicalType() int32 {
+	switch c.Type {
+	case INT32:
+		return TYPE_INT32
+	case INT64:
+		return TYPE_INT64
+	}
+	return TYPE_BYTE_ARRAY
+}
+
+// columnChunk is a column of a written row group.
+type columnChunk struct {
+	offset             int64
+	uncompressed, size int64
+}
+
+type rowGroup struct {
+	rows    int64
+	bytes   int64
+	columns []columnChunk
+}
+
+// Writer writes rows to a Parquet file. Close must be called to write the
+// footer.
+type Writer struct {
+	w        io.Writer
+	offset   int64
+	columns  []Column
+	metadata map[string]string
+	// values holds the PLAIN encoded values of each column of the current
+	// row group.
+	values    []bytes.Buffer
+	rows      int64
+	rowGroups []rowGroup
+	err       error
+}
+
+// NewWriter returns a writer of a table with columns to w. metadata is
+// stored as the key-value metadata of the file.
+func NewWriter(w io.Writer, columns []Column, metadata map[string]string) *Writer {
+	pw := &Writer{w: w, columns: columns, metadata: metadata, values: make([]bytes.Buffer, len(columns))}
+	pw.write([]byte(MAGIC))
+	return pw
+}
+
+func (w *Writer) write(data []byte) {
+	if w.err != nil {
+		return
+	}
+	n, err := w.w.Write(data)
+	w.offset += int64(n)
+	w.err = err
+}
+
+// Write adds a row holding a value for each column: a string for STRING
+// columns and an int, int32 or int64 for the others.
+func (w *Writer) Write(row ...any) error {
+	if w.err != nil {
+		return w.err
+	}
+	if len(row) != len(w.columns) {
+		return fmt.Errorf("parquet: row of %d values for %d columns", len(row), len(w.columns))
+	}
+	for i, v := range row {
+		if err := w.encode(i, v); err != nil {
+			return err
+		}
+	}
+	w.rows++
+	if w.rows == ROW_GROUP_ROWS {
+		w.flush()
+	}
+	return w.err
+}
+
+// encode appends v PLAIN encoded to the values of column i.
+func (w *Writer) encode(i int, v any) error {
+	column, buf := w.columns[i], &w.values[i]
+	var n int64
+	switch v := v.(type) {
+	case string:
+		if column.Type != STRING {
+			return fmt.Errorf("parquet: string value for column %s", column.Name)
+		}
+		buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(v))))
+		buf.WriteString(v)
+		return nil
+	case int:
+		n = int64(v)
+	case int32:
+		n = int64(v)
+	case int64:
+		n = v
+	default:
+		return fmt.Errorf("parquet: unsupported %T value for column %s", v, column.Name)
+	}
+	switch column.Type {
+	case INT32:
+		buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(n)))
+	case INT64:
+		buf.Write(binary.LittleEndian.AppendUint64(nil, uint64(n)))
+	default:
+		return fmt.Errorf("parquet: integer value for column %s", column.Name)
+	}
+	return nil
+}
+
+// flush writes the rows buffered as a row group of one data page per column.
+func (w *Writer) flush() {
+	if w.rows == 0 || w.err != nil {
+		return
+	}
+	group := rowGroup{rows: w.rows}
+	for i := range w.columns {
+		values := w.values[i].Bytes()
+		var compressed bytes.Buffer
+		zw := gzip.NewWriter(&compressed)
+		zw.Write(values)
+		if err := zw.Close(); err != nil {
+			w.err = err
+			return
+		}
+
+		var header thrift
+		header.structure(func() {
+			header.i32(1, PAGE_DATA)
+			header.i32(2, int32(len(values)))
+			header.i32(3, int32(compressed.Len()))
+			header.structField(5, func() {
+				header.i32(1, int32(w.rows))
+				header.i32(2, ENCODING_PLAIN)
+				header.i32(3, ENCODING_RLE)
+				header.i32(4, ENCODING_RLE)
+			})
+		})
+
+		chunk := columnChunk{
+			offset:       w.offset,
+			uncompressed: int64(header.buf.Len() + len(values)),
+			size:         int64(header.buf.Len() + compressed.Len()),
+		}
+		w.write(header.buf.Bytes())
+		w.write(compressed.Bytes())
+		group.columns = append(group.columns, chunk)
+		group.bytes += chunk.uncompressed
+		w.values[i].Reset()
+	}
+	w.rowGroups = append(w.rowGroups, group)
+	w.rows = 0
+}
+
+// Close writes the buffered rows and the footer. It does not close the
+// underlying writer.
+func (w *Writer) Close() error {
+	w.flush()
+	if w.err != nil {
+		return w.err
+	}
+	var numRows int64
+	for _, group := range w.rowGroups {
+		numRows += group.rows
+	}
+	keys := make([]string, 0, len(w.metadata))
+	for k := range w.metadata {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	var footer thrift
+	footer.structure(func() {
+		footer.i32(1, FORMAT_VERSION_1)
+		footer.structList(2, len(w.columns)+1, func(i int) {
+			if i == 0 {
+				footer.string(4, "schema")
+				footer.i32(5, int32(len(w.columns)))
+				return
+			}
+			column := w.columns[i-1]
+			footer.i32(1, column.physicalType())
+			footer.i32(3, REQUIRED)
+			footer.string(4, column.Name)
+			if column.Type == STRING {
+				footer.i32(6, CONVERTED_UTF8)
+			}
+		})
+		footer.i64(3, numRows)
+		footer.structList(4, len(w.rowGroups), func(g int) {
+			group := w.rowGroups[g]
+			footer.structList(1, len(group.columns), func(i int) {
+				chunk, column := group.columns[i], w.columns[i]
+				footer.i64(2, chunk.offset)
+				footer.structField(3, func() {
+					footer.i32(1, column.physicalType())
+					footer.i32List(2, ENCODING_PLAIN, ENCODING_RLE)
+					footer.stringList(3, column.Name)
+					footer.i32(4, CODEC_GZIP)
+					footer.i64(5, group.rows)
+					footer.i64(6, chunk.uncompressed)
+					footer.i64(7, chunk.size)
+					footer.i64(9, chunk.offset)
+				})
+			})
+			footer.i64(2, group.bytes)
+			footer.i64(3, group.rows)
+		})
+		if len(keys) > 0 {
+			footer.structList(5, len(keys), func(i int) {
+				footer.string(1, keys[i])
+				footer.string(2, w.metadata[keys[i]])
+			})
+		}
+		footer.string(6, CREATED_BY)
+	})
+
+	w.write(footer.buf.Bytes())
+	w.write(binary.LittleEndian.AppendUint32(nil, uint32(footer.buf.Len())))
+	w.write([]byte(MAGIC))
+	return w.err
+}
@@ -0,0 +1,295 @@
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// decoder reads the Thrift compact protocol independently of the encoder,
+// so that the tests check the files against the format rather than against
+// the code that wrote them.
+type decoder struct {
+	t   *testing.T
+	b   []byte
+	pos int
+}
+
+func (d *decoder) byte() byte {
+	if d.pos >= len(d.b) {
+		d.t.Fatalf("thrift: read past the end at %d", d.pos)
+	}
+	d.pos++
+	return d.b[d.pos-1]
+}
+
+func (d *decoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.b[d.pos:])
+	if n <= 0 {
+		d.t.Fatalf("thrift: bad varint at %d", d.pos)
+	}
+	d.pos += n
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	v, n := binary.Varint(d.b[d.pos:])
+	if n <= 0 {
+		d.t.Fatalf("thrift: bad varint at %d", d.pos)
+	}
+	d.pos += n
+	return v
+}
+
+func (d *decoder) value(typ byte) any {
+	switch typ {
+	case 1:
+		return true
+	case 2:
+		return false
+	case 3:
+		return d.byte()
+	case THRIFT_I32, THRIFT_I64, 4:
+		return d.varint()
+	case THRIFT_BINARY:
+		n := int(d.uvarint())
+		s := string(d.b[d.pos : d.pos+n])
+		d.pos += n
+		return s
+	case THRIFT_LIST:
+		header := d.byte()
+		size, elem := int(header>>4), header&0x0F
+		if size == 15 {
+			size = int(d.uvarint())
+		}
+		list := make([]any, size)
+		for i := range list {
+			list[i] = d.value(elem)
+		}
+		return list
+	case THRIFT_STRUCT:
+		return d.structure()
+	}
+	d.t.Fatalf("thrift: unsupported type %d at %d", typ, d.pos)
+	return nil
+}
+
+// structure reads a struct into its values by field ID.
+func (d *decoder) structure() map[int16]any {
+	fields := make(map[int16]any)
+	var last int16
+	for {
+		header := d.byte()
+		if header == 0 {
+			return fields
+		}
+		typ, delta := header&0x0F, int16(header>>4)
+		id := last + delta
+		if delta == 0 {
+			id = int16(d.varint())
+		}
+		fields[id] = d.value(typ)
+		last = id
+	}
+}
+
+func field[T any](t *testing.T, s map[int16]any, id int16) T {
+	t.Helper()
+	v, ok := s[id].(T)
+	if !ok {
+		t.Fatalf("field %d is %T, not %T", id, s[id], v)
+	}
+	return v
+}
+
+// readFile decodes a Parquet file written by Writer and returns its footer
+// and the values of each column, strings or int64s, in row order.
+func readFile(t *testing.T, file []byte) (map[int16]any, [][]any) {
+	t.Helper()
+	if len(file) < 12 || string(file[:4]) != MAGIC || string(file[len(file)-4:]) != MAGIC {
+		t.Fatalf("file does not start and end with %s", MAGIC)
+	}
+	footerLen := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	footerStart := len(file) - 8 - footerLen
+	if footerStart < 4 {
+		t.Fatalf("footer length %d exceeds the file", footerLen)
+	}
+	d := &decoder{t: t, b: file[:len(file)-8], pos: footerStart}
+	footer := d.structure()
+	if d.pos != len(file)-8 {
+		t.Fatalf("footer decoded to %d, want %d", d.pos, len(file)-8)
+	}
+
+	schema := field[[]any](t, footer, 2)
+	columns := make([][]any, len(schema)-1)
+	for _, g := range field[[]any](t, footer, 4) {
+		group := g.(map[int16]any)
+		rows := field[int64](t, group, 3)
+		for i, c := range field[[]any](t, group, 1) {
+			meta := field[map[int16]any](t, c.(map[int16]any), 3)
+			if codec := field[int64](t, meta, 4); codec != CODEC_GZIP {
+				t.Fatalf("column %d codec %d, want %d", i, codec, CODEC_GZIP)
+			}
+			if n := field[int64](t, meta, 5); n != rows {
+				t.Fatalf("column %d has %d values in a group of %d rows", i, n, rows)
+			}
+			offset := int(field[int64](t, meta, 9))
+			pd := &decoder{t: t, b: file, pos: offset}
+			page := pd.structure()
+			if typ := field[int64](t, page, 1); typ != PAGE_DATA {
+				t.Fatalf("column %d page type %d, want %d", i, typ, PAGE_DATA)
+			}
+			if size := int64(pd.pos - offset + int(field[int64](t, page, 3))); size != field[int64](t, meta, 7) {
+				t.Fatalf("column %d chunk of %d bytes, footer says %d", i, size, field[int64](t, meta, 7))
+			}
+			zr, err := gzip.NewReader(bytes.NewReader(file[pd.pos : pd.pos+int(field[int64](t, page, 3))]))
+			if err != nil {
+				t.Fatal(err)
+			}
+			values, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(values)) != field[int64](t, page, 2) {
+				t.Fatalf("column %d page of %d bytes, header says %d", i, len(values), field[int64](t, page, 2))
+			}
+			if n := field[int64](t, field[map[int16]any](t, page, 5), 1); n != rows {
+				t.Fatalf("column %d page of %d values, want %d", i, n, rows)
+			}
+			typ := field[int64](t, schema[i+1].(map[int16]any), 1)
+			for range rows {
+				switch typ {
+				case TYPE_BYTE_ARRAY:
+					n := int(binary.LittleEndian.Uint32(values))
+					columns[i] = append(columns[i], string(values[4:4+n]))
+					values = values[4+n:]
+				case TYPE_INT32:
+					columns[i] = append(columns[i], int64(int32(binary.LittleEndian.Uint32(values))))
+					values = values[4:]
+				case TYPE_INT64:
+					columns[i] = append(columns[i], int64(binary.LittleEndian.Uint64(values)))
+					values = values[8:]
+				}
+			}
+			if len(values) != 0 {
+				t.Fatalf("column %d has %d bytes left after its values", i, len(values))
+			}
+		}
+	}
+	return footer, columns
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	columns := []Column{{Name: "timestamp", Type: STRING}, {Name: "size", Type: INT32}, {Name: "bytes", Type: INT64}}
+	rows := [][]any{
+		{"20200101000000", 256, int64(1) << 40},
+		{"20200102000000", int32(64), int64(-7)},
+		{"", 512, 0},
+	}
+	var buf bytes.Buffer
+	w := NewWriter(&buf, columns, map[string]string{"url": "example.com", "algo": "simhash256"})
+	for _, row := range rows {
+		if err := w.Write(row...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	footer, values := readFile(t, buf.Bytes())
+	if v := field[int64](t, footer, 1); v != FORMAT_VERSION_1 {
+		t.Errorf("version %d, want %d", v, FORMAT_VERSION_1)
+	}
+	if n := field[int64](t, footer, 3); n != int64(len(rows)) {
+		t.Errorf("num_rows %d, want %d", n, len(rows))
+	}
+	if by := field[string](t, footer, 6); by != CREATED_BY {
+		t.Errorf("created_by %q, want %q", by, CREATED_BY)
+	}
+	schema := field[[]any](t, footer, 2)
+	if root := schema[0].(map[int16]any); field[string](t, root, 4) != "schema" || field[int64](t, root, 5) != int64(len(columns)) {
+		t.Errorf("root schema element %v", root)
+	}
+	for i, column := range columns {
+		element := schema[i+1].(map[int16]any)
+		if name := field[string](t, element, 4); name != column.Name {
+			t.Errorf("column %d named %q, want %q", i, name, column.Name)
+		}
+		if typ := field[int64](t, element, 1); typ != int64(column.physicalType()) {
+			t.Errorf("column %s of type %d, want %d", column.Name, typ, column.physicalType())
+		}
+		if _, utf8 := element[6]; utf8 != (column.Type == STRING) {
+			t.Errorf("column %s UTF8 annotation %v", column.Name, utf8)
+		}
+	}
+	// Key-value metadata is sorted by key.
+	kv := field[[]any](t, footer, 5)
+	got := fmt.Sprint(field[string](t, kv[0].(map[int16]any), 1), "=", field[string](t, kv[0].(map[int16]any), 2), " ",
+		field[string](t, kv[1].(map[int16]any), 1), "=", field[string](t, kv[1].(map[int16]any), 2))
+	if got != "algo=simhash256 url=example.com" {
+		t.Errorf("metadata %s", got)
+	}
+
+	want := [][]any{
+		{"20200101000000", "20200102000000", ""},
+		{int64(256), int64(64), int64(512)},
+		{int64(1) << 40, int64(-7), int64(0)},
+	}
+	if fmt.Sprint(values) != fmt.Sprint(want) {
+		t.Errorf("values %v, want %v", values, want)
+	}
+}
+
+func TestWriterRowGroups(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, []Column{{Name: "n", Type: INT64}}, nil)
+	total := ROW_GROUP_ROWS + 3
+	for i := range total {
+		if err := w.Write(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	footer, values := readFile(t, buf.Bytes())
+	if groups := field[[]any](t, footer, 4); len(groups) != 2 {
+		t.Fatalf("%d row groups, want 2", len(groups))
+	}
+	if n := field[int64](t, footer, 3); n != int64(total) {
+		t.Errorf("num_rows %d, want %d", n, total)
+	}
+	if _, ok := footer[5]; ok {
+		t.Errorf("key-value metadata written without metadata")
+	}
+	for i, v := range values[0] {
+		if v != int64(i) {
+			t.Fatalf("row %d holds %v", i, v)
+		}
+	}
+}
+
+func TestWriterEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewWriter(&buf, []Column{{Name: "s", Type: STRING}}, nil).Close(); err != nil {
+		t.Fatal(err)
+	}
+	footer, _ := readFile(t, buf.Bytes())
+	if n := field[int64](t, footer, 3); n != 0 {
+		t.Errorf("num_rows %d, want 0", n)
+	}
+}
+
+func TestWriterRejectsBadRows(t *testing.T) {
+	w := NewWriter(io.Discard, []Column{{Name: "s", Type: STRING}, {Name: "n", Type: INT32}}, nil)
+	for _, row := range [][]any{{"a"}, {1, 1}, {"a", "b"}, {"a", 1.5}} {
+		if err := w.Write(row...); err == nil {
+			t.Errorf("row %v accepted", row)
+		}
+	}
+}
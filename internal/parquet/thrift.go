@@ -0,0 +1,114 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Types of the Thrift compact protocol.
+const (
+	THRIFT_I32    = 5
+	THRIFT_I64    = 6
+	THRIFT_BINARY = 8
+	THRIFT_LIST   = 9
+	THRIFT_STRUCT = 12
+)
+
+// thrift encodes a struct with the Thrift compact protocol, which Parquet
+// uses for its page headers and footer.
+type thrift struct {
+	buf bytes.Buffer
+	// last is the ID of the last field written in the current struct and
+	// parents those of the enclosing structs.
+	last    int16
+	parents []int16
+}
+
+func (t *thrift) field(id int16, typ byte) {
+	if delta := id - t.last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.varint(int64(id))
+	}
+	t.last = id
+}
+
+// varint writes v zigzag encoded.
+func (t *thrift) varint(v int64) {
+	t.buf.Write(binary.AppendVarint(nil, v))
+}
+
+func (t *thrift) uvarint(v uint64) {
+	t.buf.Write(binary.AppendUvarint(nil, v))
+}
+
+func (t *thrift) binary(s string) {
+	t.uvarint(uint64(len(s)))
+	t.buf.WriteString(s)
+}
+
+func (t *thrift) listHeader(size int, typ byte) {
+	if size < 15 {
+		t.buf.WriteByte(byte(size)<<4 | typ)
+		return
+	}
+	t.buf.WriteByte(0xF0 | typ)
+	t.uvarint(uint64(size))
+}
+
+func (t *thrift) i32(id int16, v int32) {
+	t.field(id, THRIFT_I32)
+	t.varint(int64(v))
+}
+
+func (t *thrift) i64(id int16, v int64) {
+	t.field(id, THRIFT_I64)
+	t.varint(v)
+}
+
+func (t *thrift) string(id int16, s string) {
+	t.field(id, THRIFT_BINARY)
+	t.binary(s)
+}
+
+// structure writes the fields of a struct with fields, then its stop byte.
+func (t *thrift) structure(fields func()) {
+	t.parents = append(t.parents, t.last)
+	t.last = 0
+	fields()
+	t.buf.WriteByte(0)
+	t.last = t.parents[len(t.parents)-1]
+	t.parents = t.parents[:len(t.parents)-1]
+}
+
+func (t *thrift) structField(id int16, fields func()) {
+	t.field(id, THRIFT_STRUCT)
+	t.structure(fields)
+}
+
+// structList writes a list of n structs, the fields of the i-th written by
+// fields(i).
+func (t *thrift) structList(id int16, n int, fields func(i int)) {
+	t.field(id, THRIFT_LIST)
+	t.listHeader(n, THRIFT_STRUCT)
+	for i := range n {
+		t.structure(func() { fields(i) })
+	}
+}
+
+func (t *thrift) i32List(id int16, values ...int32) {
+	t.field(id, THRIFT_LIST)
+	t.listHeader(len(values), THRIFT_I32)
+	for _, v := range values {
+		t.varint(int64(v))
+	}
+}
+
+func (t *thrift) stringList(id int16, values ...string) {
+	t.field(id, THRIFT_LIST)
+	t.listHeader(len(values), THRIFT_BINARY)
+	for _, v := range values {
+		t.binary(v)
+	}
+}
@@ -0,0 +1,61 @@
+package parquet
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestThriftGolden(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields func(*thrift)
+		want   []byte
+	}{
+		{
+			name:   "field deltas",
+			fields: func(th *thrift) { th.i32(1, 1); th.i32(3, -1) },
+			// Field 1 i32 1 zigzag 2, field 3 is 2 after 1, i32 -1 zigzag 1.
+			want: []byte{0x15, 0x02, 0x25, 0x01, 0x00},
+		},
+		{
+			name:   "long field delta",
+			fields: func(th *thrift) { th.i64(20, 300) },
+			// Type byte, then the ID zigzag varint 40, then 600 as a varint.
+			want: []byte{0x06, 0x28, 0xD8, 0x04, 0x00},
+		},
+		{
+			name:   "string",
+			fields: func(th *thrift) { th.string(4, "ab") },
+			want:   []byte{0x48, 0x02, 'a', 'b', 0x00},
+		},
+		{
+			name: "nested struct restores the field ID",
+			fields: func(th *thrift) {
+				th.i32(1, 0)
+				th.structField(5, func() { th.i32(1, 2) })
+				th.i32(6, 0)
+			},
+			want: []byte{0x15, 0x00, 0x4C, 0x15, 0x04, 0x00, 0x15, 0x00, 0x00},
+		},
+		{
+			name:   "short list",
+			fields: func(th *thrift) { th.i32List(2, 0, 3) },
+			want:   []byte{0x29, 0x25, 0x00, 0x06, 0x00},
+		},
+		{
+			name:   "long list",
+			fields: func(th *thrift) { th.stringList(3, strings.Split(strings.Repeat("x", 15), "")...) },
+			want:   append([]byte{0x39, 0xF8, 0x0F}, append(bytes.Repeat([]byte{0x01, 'x'}, 15), 0x00)...),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var th thrift
+			th.structure(func() { tt.fields(&th) })
+			if got := th.buf.Bytes(); !bytes.Equal(got, tt.want) {
+				t.Errorf("got % x, want % x", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,5 @@
+// Package pb holds the protobuf messages of the API responses, generated
+// from proto/discoverdiff.proto.
+package pb
+
+//go:generate protoc --proto_path=../../proto --go_out=. --go_opt=paths=source_relative discoverdiff.proto
@@ -0,0 +1,37 @@
+package profiling
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/config"
+)
+
+// Handler serves the net/http/pprof endpoints under /debug/pprof/.
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// Start serves the net/http/pprof endpoints on cfg.Addr, which should only be
+// reachable by operators, and returns the server so it can be shut down.
+func Start(cfg config.ProfilingConfig) *http.Server {
+	runtime.SetBlockProfileRate(cfg.BlockProfileRate)
+	runtime.SetMutexProfileFraction(cfg.MutexProfileFraction)
+
+	srv := &http.Server{Addr: cfg.Addr, Handler: Handler()}
+	go func() {
+		slog.Info("profiling server is running", "addr", srv.Addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("profiling listen failed", "error", err)
+		}
+	}()
+	return srv
+}
@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// KEY_PREFIX prefixes the Redis hashes holding the token buckets.
+const KEY_PREFIX = "ratelimit:"
+
+// takeScript takes a token from the bucket in KEYS[1], refilled with ARGV[1]
+// tokens per second up to ARGV[2] tokens. It returns 1 when a token was
+// taken, and 0 and the milliseconds until the next token otherwise. The
+// clock of Redis is used so all instances agree on the refill.
+var takeScript = redis.NewScript(`
+local rate, burst = tonumber(ARGV[1]), tonumber(ARGV[2])
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens, ts = tonumber(bucket[1]) or burst, tonumber(bucket[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+local taken, wait = 0, 0
+if tokens >= 1 then
+	tokens, taken = tokens - 1, 1
+else
+	wait = math.ceil((1 - tokens) * 1000 / rate)
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+return {taken, wait}
+`)
+
+// Limiter limits requests per client address and per API key with token
+// buckets shared by all instances through Redis.
+type Limiter struct {
+	redisClient *redis.Client
+	perIP       config.RateConfig
+	perKey      config.RateConfig
+}
+
+// New returns the limiter of cfg, or nil when rate limiting is disabled.
+func New(redisClient *redis.Client, cfg config.RateLimitConfig) *Limiter {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &Limiter{redisClient: redisClient, perIP: cfg.PerIP, perKey: cfg.PerKey}
+}
+
+// Allow takes a token from the bucket of ip and, when key is not empty, from
+// the bucket of key. When either is empty it returns false and how long to
+// wait before retrying.
+func (l *Limiter) Allow(ctx context.Context, ip, key string) (bool, time.Duration, error) {
+	if l == nil {
+		return true, 0, nil
+	}
+	if ok, wait, err := l.take(ctx, "ip:"+ip, l.perIP); !ok || err != nil {
+		return ok, wait, err
+	}
+	if key == "" {
+		return true, 0, nil
+	}
+	return l.take(ctx, "key:"+key, l.perKey)
+}
+
+// take takes a token from the bucket called name.
+func (l *Limiter) take(ctx context.Context, name string, rate config.RateConfig) (bool, time.Duration, error) {
+	if rate.Rate <= 0 {
+		return true, 0, nil
+	}
+	res, err := takeScript.Run(ctx, l.redisClient, []string{KEY_PREFIX + name}, rate.Rate, rate.Burst).Int64Slice()
+	if err != nil {
+		return true, 0, fmt.Errorf("cannot rate limit %s, %w", name, err)
+	}
+	return res[0] == 1, time.Duration(res[1]) * time.Millisecond, nil
+}
@@ -0,0 +1,56 @@
+package reporting
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/config"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/logging"
+	"github.com/getsentry/sentry-go"
+)
+
+// Setup initializes the Sentry client when cfg.DSN is set and returns a
+// function flushing buffered events, to be called on shutdown. Without a DSN
+// every capture is a no-op.
+func Setup(cfg config.SentryConfig, release string) (func(time.Duration) bool, error) {
+	if cfg.DSN == "" {
+		return func(time.Duration) bool { return true }, nil
+	}
+	err := sentry.Init(sentry.ClientOptions{
+		Dsn:              cfg.DSN,
+		Environment:      cfg.Environment,
+		Release:          release,
+		SampleRate:       cfg.SampleRate,
+		AttachStacktrace: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot initialize sentry, %w", err)
+	}
+	return sentry.Flush, nil
+}
+
+// CaptureError reports err with tags such as job_id, url or timestamp, and
+// the request ID carried by ctx.
+func CaptureError(ctx context.Context, err error, tags map[string]string) {
+	hub := hubWithTags(ctx, tags)
+	hub.CaptureException(err)
+}
+
+// CapturePanic reports a recovered panic value with tags and the request ID
+// carried by ctx.
+func CapturePanic(ctx context.Context, recovered any, tags map[string]string) {
+	hub := hubWithTags(ctx, tags)
+	hub.Recover(recovered)
+}
+
+func hubWithTags(ctx context.Context, tags map[string]string) *sentry.Hub {
+	hub := sentry.CurrentHub().Clone()
+	hub.ConfigureScope(func(scope *sentry.Scope) {
+		if id := logging.RequestID(ctx); id != "" {
+			scope.SetTag("request_id", id)
+		}
+		scope.SetTags(tags)
+	})
+	return hub
+}
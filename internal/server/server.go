@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/config"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Server is the HTTP server of the API. With autocert it also runs the
+// plain HTTP server answering ACME challenges.
+type Server struct {
+	*http.Server
+	cfg       config.ServerConfig
+	challenge *http.Server
+}
+
+// New returns the HTTP server of the API, serving handler on cfg.Addr with
+// the timeouts, TLS and HTTP/2 settings of cfg.
+func New(cfg config.ServerConfig, handler http.Handler) *Server {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(cfg.HTTP2.Enabled)
+	protocols.SetUnencryptedHTTP2(cfg.HTTP2.H2C)
+
+	return &Server{
+		Server: &http.Server{
+			Addr:              cfg.Addr,
+			Handler:           handler,
+			ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+			ReadTimeout:       cfg.ReadTimeout,
+			WriteTimeout:      cfg.WriteTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
+			MaxHeaderBytes:    cfg.MaxHeaderBytes,
+			Protocols:         protocols,
+			HTTP2:             &http.HTTP2Config{MaxConcurrentStreams: cfg.HTTP2.MaxConcurrentStreams},
+		},
+		cfg: cfg,
+	}
+}
+
+// ListenAndServe listens on the sockets passed by systemd, or on the TCP
+// address and the Unix socket of the configuration, and serves HTTPS with the configured certificate or with
+// certificates obtained from Let's Encrypt, and plain HTTP otherwise. It
+// returns when any listener fails, or with http.ErrServerClosed on shutdown.
+func (s *Server) ListenAndServe() error {
+	listeners, err := s.listen()
+	if err != nil {
+		return err
+	}
+
+	tls := s.cfg.TLS
+	if tls.Autocert.Enabled {
+		s.startAutocert()
+	}
+	errc := make(chan error, len(listeners))
+	for _, l := range listeners {
+		slog.Info("server is running", "network", l.Addr().Network(), "addr", l.Addr().String())
+		go func() {
+			if tls.Autocert.Enabled || tls.CertFile != "" {
+				errc <- s.Server.ServeTLS(l, tls.CertFile, tls.KeyFile)
+			} else {
+				errc <- s.Server.Serve(l)
+			}
+		}()
+	}
+	return <-errc
+}
+
+// listen returns the sockets passed by systemd socket activation, or opens
+// the listeners of the configuration.
+func (s *Server) listen() ([]net.Listener, error) {
+	listeners, err := activatedListeners()
+	if err != nil || listeners != nil {
+		return listeners, err
+	}
+	if s.cfg.Addr != "" {
+		l, err := net.Listen("tcp", s.cfg.Addr)
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	if path := s.cfg.UnixSocket.Path; path != "" {
+		l, err := listenUnix(path, s.cfg.UnixSocket.Mode)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// listenUnix listens on the Unix socket at path with the permissions mode,
+// an octal string such as "0660". A socket left behind by a previous run is
+// replaced. The socket file is removed when the listener is closed.
+func listenUnix(path, mode string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&fs.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("cannot remove stale socket %s, %w", path, err)
+		}
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if mode != "" {
+		perm, _ := strconv.ParseUint(mode, 8, 32)
+		if err := os.Chmod(path, fs.FileMode(perm)); err != nil {
+			l.Close()
+			return nil, fmt.Errorf("cannot set permissions of socket %s, %w", path, err)
+		}
+	}
+	return l, nil
+}
+
+// startAutocert configures certificates from Let's Encrypt and starts the
+// server answering the ACME challenges.
+func (s *Server) startAutocert() {
+	cfg := s.cfg.TLS.Autocert
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(cfg.Domains...),
+		Cache:      autocert.DirCache(cfg.CacheDir),
+		Email:      cfg.Email,
+	}
+	s.TLSConfig = m.TLSConfig()
+	s.challenge = &http.Server{
+		Addr:              cfg.HTTPAddr,
+		Handler:           m.HTTPHandler(nil),
+		ReadHeaderTimeout: s.cfg.ReadHeaderTimeout,
+	}
+	go func() {
+		slog.Info("ACME challenge server is running", "addr", s.challenge.Addr)
+		if err := s.challenge.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("ACME challenge listen failed", "error", err)
+		}
+	}()
+}
+
+// Shutdown gracefully shuts the server and the ACME challenge server down.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.challenge != nil {
+		s.challenge.Shutdown(ctx)
+	}
+	return s.Server.Shutdown(ctx)
+}
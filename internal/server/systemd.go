@@ -0,0 +1,52 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// LISTEN_FDS_START is the first file descriptor passed by systemd.
+const LISTEN_FDS_START = 3
+
+// activatedListeners returns the sockets passed by systemd socket activation
+// (LISTEN_PID and LISTEN_FDS), or nil when the process was not
+// socket-activated. The variables are cleared so child processes do not
+// inherit them.
+func activatedListeners() ([]net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make([]net.Listener, 0, n)
+	for fd := LISTEN_FDS_START; fd < LISTEN_FDS_START+n; fd++ {
+		syscall.CloseOnExec(fd)
+		name := "LISTEN_FD_" + strconv.Itoa(fd)
+		if i := fd - LISTEN_FDS_START; i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(fd), name)
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("cannot use socket %s passed by systemd, %w", name, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
@@ -0,0 +1,125 @@
+// Package sitemap lists the URLs of sitemaps, live or archived in the Wayback
+// Machine, following sitemap indexes.
+package sitemap
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// MAX_URLS is the number of URLs listed at most, the limit of a single
+// sitemap in the sitemaps protocol.
+const MAX_URLS = 50000
+
+// MAX_DEPTH is the number of nested sitemap indexes followed.
+const MAX_DEPTH = 3
+
+// MAX_SIZE is the size of a sitemap read at most, uncompressed.
+const MAX_SIZE = 50 << 20
+
+// document holds both a urlset and a sitemapindex, only one is filled.
+type document struct {
+	URLs     []entry `xml:"url"`
+	Sitemaps []entry `xml:"sitemap"`
+}
+
+type entry struct {
+	Loc string `xml:"loc"`
+}
+
+// Fetch returns the URLs listed by the sitemap at u and the sitemaps it
+// indexes, without duplicates. With a timestamp the sitemaps are read from
+// their captures closest to it, at the URL replay returns, instead of the
+// live site.
+func Fetch(ctx context.Context, client *http.Client, u, timestamp string, replay func(timestamp, url string) string) ([]string, error) {
+	f := fetcher{client: client, timestamp: timestamp, replay: replay, seen: make(map[string]bool)}
+	if err := f.fetch(ctx, u, 0); err != nil {
+		return nil, err
+	}
+	if len(f.urls) == 0 {
+		return nil, fmt.Errorf("no URLs in sitemap %s", u)
+	}
+	return f.urls, nil
+}
+
+type fetcher struct {
+	client    *http.Client
+	timestamp string
+	replay    func(timestamp, url string) string
+	seen      map[string]bool
+	urls      []string
+}
+
+func (f *fetcher) fetch(ctx context.Context, u string, depth int) error {
+	doc, err := f.get(ctx, u)
+	if err != nil {
+		return err
+	}
+	for _, e := range doc.URLs {
+		loc := strings.TrimSpace(e.Loc)
+		if loc == "" || f.seen[loc] {
+			continue
+		}
+		if len(f.urls) == MAX_URLS {
+			return nil
+		}
+		f.seen[loc] = true
+		f.urls = append(f.urls, loc)
+	}
+	if depth == MAX_DEPTH {
+		return nil
+	}
+	for _, e := range doc.Sitemaps {
+		loc := strings.TrimSpace(e.Loc)
+		if loc == "" || f.seen[loc] {
+			continue
+		}
+		f.seen[loc] = true
+		if err := f.fetch(ctx, loc, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// get downloads and parses the sitemap at u, gunzipping it when needed.
+func (f *fetcher) get(ctx context.Context, u string) (*document, error) {
+	src := u
+	if f.timestamp != "" {
+		src = f.replay(f.timestamp, u)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "wayback-discover-diff")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch sitemap %s, %w", u, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cannot fetch sitemap %s, status: %d", u, resp.StatusCode)
+	}
+
+	var body io.Reader = bufio.NewReader(io.LimitReader(resp.Body, MAX_SIZE))
+	if magic, _ := body.(*bufio.Reader).Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read sitemap %s, %w", u, err)
+		}
+		defer gz.Close()
+		body = io.LimitReader(gz, MAX_SIZE)
+	}
+	var doc document
+	if err := xml.NewDecoder(body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("cannot parse sitemap %s, %w", u, err)
+	}
+	return &doc, nil
+}
@@ -0,0 +1,114 @@
+// Package spn captures URLs on demand with the Save Page Now API of the
+// Wayback Machine.
+package spn
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/config"
+)
+
+// Client starts Save Page Now captures and waits for them to complete.
+type Client struct {
+	cfg        config.SPNConfig
+	httpClient *http.Client
+}
+
+// New returns a client for cfg, or nil when Save Page Now is disabled.
+func New(cfg config.SPNConfig) *Client {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &Client{cfg: cfg, httpClient: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// status is the answer of the capture and status endpoints.
+type status struct {
+	JobID     string `json:"job_id"`
+	Status    string `json:"status"`
+	Timestamp string `json:"timestamp"`
+	Message   string `json:"message"`
+}
+
+// Save captures u and returns the timestamp of the new capture once it is
+// in the Wayback Machine. It gives up after the configured timeout.
+func (c *Client) Save(ctx context.Context, u string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	form := url.Values{"url": {u}}
+	req, err := c.newRequest(ctx, http.MethodPost, c.cfg.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	started, err := c.do(req)
+	if err != nil {
+		return "", fmt.Errorf("cannot start capture of %s, %w", u, err)
+	}
+	if started.JobID == "" {
+		return "", fmt.Errorf("cannot start capture of %s, %s", u, started.Message)
+	}
+
+	ticker := time.NewTicker(c.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("capture of %s did not complete in %s", u, c.cfg.Timeout)
+		case <-ticker.C:
+		}
+		req, err := c.newRequest(ctx, http.MethodGet, strings.TrimSuffix(c.cfg.URL, "/")+"/status/"+started.JobID, nil)
+		if err != nil {
+			return "", err
+		}
+		s, err := c.do(req)
+		if ctx.Err() != nil {
+			continue
+		} else if err != nil {
+			return "", fmt.Errorf("cannot check capture of %s, %w", u, err)
+		}
+		switch s.Status {
+		case "success":
+			return s.Timestamp, nil
+		case "error":
+			return "", fmt.Errorf("capture of %s failed, %s", u, s.Message)
+		}
+	}
+}
+
+// newRequest returns an authenticated request to the Save Page Now API.
+func (c *Client) newRequest(ctx context.Context, method, u string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "wayback-discover-diff")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("LOW %s:%s", c.cfg.AccessKey, c.cfg.SecretKey))
+	return req, nil
+}
+
+// do sends req and decodes the answer.
+func (c *Client) do(req *http.Request) (status, error) {
+	var s status
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return s, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+		return s, err
+	}
+	return s, nil
+}
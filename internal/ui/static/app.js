@@ -0,0 +1,122 @@
+"use strict";
+
+const form = document.getElementById("query");
+const statusLine = document.getElementById("status");
+
+function setStatus(text, isError) {
+  statusLine.textContent = text;
+  statusLine.className = isError ? "error" : "";
+}
+
+async function getJSON(path, params) {
+  const resp = await fetch(path + "?" + new URLSearchParams(params));
+  const body = await resp.json();
+  if (!resp.ok || body.status === "error" || body.status === "ERROR") {
+    throw new Error(body.info || body.message || resp.statusText);
+  }
+  return body;
+}
+
+const sleep = (ms) => new Promise((resolve) => setTimeout(resolve, ms));
+
+// calculate starts a job for url and year and waits for it to finish.
+async function calculate(url, year) {
+  const started = await getJSON("../calculate-simhash", { url, year });
+  for (;;) {
+    const job = await getJSON("../job", { job_id: started.job_id });
+    const state = job.status || job.state;
+    setStatus("Job " + state + ": " + (job.info || ""));
+    if (state === "SUCCESS") return;
+    if (state === "FAILURE" || state === "REVOKED") throw new Error(job.info || state);
+    await sleep(2000);
+  }
+}
+
+// hamming counts the differing bits of two bit strings.
+function hamming(a, b) {
+  let d = 0;
+  for (let i = 0; i < a.length; i++) if (a[i] !== b[i]) d++;
+  return d;
+}
+
+function waybackURL(timestamp, url) {
+  return "https://web.archive.org/web/" + timestamp + "/" + url;
+}
+
+function svgElement(name, attrs) {
+  const el = document.createElementNS("http://www.w3.org/2000/svg", name);
+  for (const [k, v] of Object.entries(attrs)) el.setAttribute(k, v);
+  return el;
+}
+
+function drawTimeline(url, captures, size) {
+  const svg = document.getElementById("timeline");
+  svg.replaceChildren();
+  const width = svg.clientWidth || 1000, height = 220, pad = 20;
+  const points = captures.slice(1).map((c, i) => ({
+    timestamp: c.Timestamp,
+    distance: hamming(captures[i].Simhash, c.Simhash),
+  }));
+  const max = Math.max(1, ...points.map((p) => p.distance));
+  const barWidth = Math.max(1, (width - 2 * pad) / Math.max(1, points.length));
+  points.forEach((p, i) => {
+    const h = ((height - 2 * pad) * p.distance) / max;
+    const rect = svgElement("rect", { x: pad + i * barWidth, y: height - pad - h, width: Math.max(1, barWidth - 1), height: Math.max(1, h) });
+    const title = svgElement("title", {});
+    title.textContent = p.timestamp + ": " + p.distance + " of " + size + " bits changed";
+    rect.appendChild(title);
+    rect.addEventListener("click", () => window.open(waybackURL(p.timestamp, url)));
+    svg.appendChild(rect);
+  });
+  const label = svgElement("text", { x: pad, y: pad - 6 });
+  label.textContent = "max " + max + " bits";
+  svg.appendChild(label);
+  document.getElementById("timeline-section").hidden = false;
+}
+
+function drawClusters(url, clusters) {
+  const container = document.getElementById("clusters");
+  container.replaceChildren();
+  clusters.forEach((timestamps, i) => {
+    const div = document.createElement("div");
+    div.className = "cluster";
+    div.append("#" + (i + 1) + " (" + timestamps.length + " captures) ");
+    timestamps.forEach((ts) => {
+      const a = document.createElement("a");
+      a.href = waybackURL(ts, url);
+      a.target = "_blank";
+      a.textContent = ts;
+      div.appendChild(a);
+    });
+    container.appendChild(div);
+  });
+  document.getElementById("clusters-section").hidden = false;
+}
+
+form.addEventListener("submit", async (event) => {
+  event.preventDefault();
+  const data = new FormData(form);
+  const url = data.get("url").trim(), year = data.get("year").trim();
+  try {
+    if (data.get("calculate")) {
+      setStatus("Starting calculation...");
+      await calculate(url, year);
+    }
+    setStatus("Loading simhashes...");
+    const result = await getJSON("../simhash", { url, year, format: "bits" });
+    const captures = result.captures || [];
+    if (captures.length < 2) {
+      setStatus("Not enough captures, calculate them first.", true);
+      return;
+    }
+    drawTimeline(url, captures, result.simhash_size);
+
+    const params = { url, year };
+    if (data.get("distance")) params.distance = data.get("distance");
+    const clusters = await getJSON("../clusters", params);
+    drawClusters(url, clusters.clusters);
+    setStatus(captures.length + " captures, " + clusters.total_clusters + " clusters within " + clusters.distance + " bits.");
+  } catch (err) {
+    setStatus(err.message, true);
+  }
+});
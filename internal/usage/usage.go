@@ -0,0 +1,77 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// USAGE_KEY_PREFIX prefixes the Redis hashes of the daily usage of each API
+// key, e.g. usage:research:20250301.
+const USAGE_KEY_PREFIX = "usage:"
+
+// RETENTION is how long daily usage is kept.
+const RETENTION = 90 * 24 * time.Hour
+
+// Usage is what an API key consumed.
+type Usage struct {
+	Jobs     int64 `json:"jobs"`
+	Captures int64 `json:"captures"`
+	Bytes    int64 `json:"bytes"`
+}
+
+// Day is the usage of one UTC day, formatted YYYY-MM-DD.
+type Day struct {
+	Date string `json:"date"`
+	Usage
+}
+
+func dayKey(key string, day time.Time) string {
+	return USAGE_KEY_PREFIX + key + ":" + day.Format("20060102")
+}
+
+// Record adds u to today's usage of key.
+func Record(ctx context.Context, redisClient *redis.Client, key string, u Usage) error {
+	k := dayKey(key, time.Now().UTC())
+	pipe := redisClient.TxPipeline()
+	pipe.HIncrBy(ctx, k, "jobs", u.Jobs)
+	pipe.HIncrBy(ctx, k, "captures", u.Captures)
+	pipe.HIncrBy(ctx, k, "bytes", u.Bytes)
+	pipe.Expire(ctx, k, RETENTION)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("cannot record usage of api key %s, %w", key, err)
+	}
+	return nil
+}
+
+// Query returns the usage of key over the last days UTC days, oldest first,
+// and its total.
+func Query(ctx context.Context, redisClient *redis.Client, key string, days int) ([]Day, Usage, error) {
+	today := time.Now().UTC()
+	pipe := redisClient.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, days)
+	for i := range cmds {
+		cmds[i] = pipe.HGetAll(ctx, dayKey(key, today.AddDate(0, 0, i-days+1)))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, Usage{}, fmt.Errorf("cannot read usage of api key %s, %w", key, err)
+	}
+
+	var total Usage
+	result := make([]Day, days)
+	for i, cmd := range cmds {
+		fields := cmd.Val()
+		d := Day{Date: today.AddDate(0, 0, i-days+1).Format(time.DateOnly)}
+		d.Jobs, _ = strconv.ParseInt(fields["jobs"], 10, 64)
+		d.Captures, _ = strconv.ParseInt(fields["captures"], 10, 64)
+		d.Bytes, _ = strconv.ParseInt(fields["bytes"], 10, 64)
+		total.Jobs += d.Jobs
+		total.Captures += d.Captures
+		total.Bytes += d.Bytes
+		result[i] = d
+	}
+	return result, total, nil
+}
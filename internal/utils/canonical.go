@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"path"
+	"strings"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/config"
+)
+
+// canonicalization holds the rewrites of Canonicalize, see SetCanonicalization.
+var canonicalization config.CanonicalizeConfig
+
+// SetCanonicalization sets the rewrites Canonicalize applies to URLs.
+func SetCanonicalization(cfg config.CanonicalizeConfig) {
+	canonicalization = cfg
+}
+
+// Canonicalize rewrites url as configured, stripping its fragment and
+// tracking params, lowercasing its host and removing its default port, so
+// that variants of a URL are stored and listed in CDX as one. URLs with or
+// without a scheme and scoped to an Archive-It collection are supported. It
+// returns url unchanged when canonicalization is disabled.
+func Canonicalize(url string) string {
+	c := canonicalization
+	if !c.Enabled || url == "" {
+		return url
+	}
+	collection, url := SplitCollection(url)
+	scheme, rest, ok := strings.Cut(url, "://")
+	if !ok {
+		scheme, rest = "", url
+	}
+	if c.StripFragment {
+		rest, _, _ = strings.Cut(rest, "#")
+	}
+	host, tail := rest, ""
+	if i := strings.IndexAny(rest, "/?#"); i >= 0 {
+		host, tail = rest[:i], rest[i:]
+	}
+	if c.LowercaseHost {
+		scheme, host = strings.ToLower(scheme), strings.ToLower(host)
+	}
+	if c.DefaultPorts {
+		if scheme != "https" {
+			host = strings.TrimSuffix(host, ":80")
+		}
+		if scheme != "http" {
+			host = strings.TrimSuffix(host, ":443")
+		}
+	}
+	if len(c.StripParams) > 0 {
+		tail = stripParams(tail, c.StripParams)
+	}
+	url = host + tail
+	if scheme != "" {
+		url = scheme + "://" + url
+	}
+	return InCollection(url, collection)
+}
+
+// stripParams removes the query params of tail, the path, query and
+// fragment of a URL, whose name matches one of patterns. The order of the
+// other params is kept.
+func stripParams(tail string, patterns []string) string {
+	base, query, ok := strings.Cut(tail, "?")
+	if !ok {
+		return tail
+	}
+	query, fragment, hasFragment := strings.Cut(query, "#")
+	var kept []string
+	for _, param := range strings.Split(query, "&") {
+		name, _, _ := strings.Cut(param, "=")
+		if !matchesAny(name, patterns) {
+			kept = append(kept, param)
+		}
+	}
+	if len(kept) > 0 {
+		base += "?" + strings.Join(kept, "&")
+	}
+	if hasFragment {
+		base += "#" + fragment
+	}
+	return base
+}
+
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -4,22 +4,101 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"math"
+	"net"
+	neturl "net/url"
 	"regexp"
 	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/pkg/simhash"
 
 	"github.com/redis/go-redis/v9"
+	"golang.org/x/net/idna"
 	"golang.org/x/net/publicsuffix"
 )
 
 type CaptureResult struct {
 	Timestamp string
 	Simhash   string
+	// Source is the archive the capture was downloaded from, set when
+	// captures are merged from several archives.
+	Source string `json:",omitempty"`
+	// Distance is the hamming distance of the capture from its baseline,
+	// set when requested, see SetDistances.
+	Distance *int `json:",omitempty"`
+}
+
+// Baselines of the distances of captures, see SetDistances.
+const (
+	DISTANCES_FIRST    = "first"
+	DISTANCES_PREVIOUS = "previous"
+)
+
+// SetDistances sets the Distance of each of captures, the stored simhashes
+// of consecutive captures of a year, to its hamming distance from the first
+// capture of the year (DISTANCES_FIRST) or from the capture before it
+// (DISTANCES_PREVIOUS). before is the stored simhash of that baseline for
+// captures[0], see DistanceBaseline, "" when captures[0] is the first
+// capture of the year.
+func SetDistances(captures []CaptureResult, baseline, before string) error {
+	var prev simhash.Simhash
+	if before != "" {
+		var err error
+		if prev, err = simhash.Parse(before, simhash.EncodingBase64); err != nil {
+			return err
+		}
+	}
+	for i := range captures {
+		hash, err := simhash.Parse(captures[i].Simhash, simhash.EncodingBase64)
+		if err != nil {
+			return err
+		}
+		if prev == nil {
+			prev = hash
+		}
+		distance, err := hash.Hamming(prev)
+		if err != nil {
+			return err
+		}
+		captures[i].Distance = &distance
+		if baseline == DISTANCES_PREVIOUS {
+			prev = hash
+		}
+	}
+	return nil
+}
+
+// DistanceBaseline returns the stored simhash the distance of the first
+// capture of page of the year of url is measured from, "" when it is the
+// first capture of the year. See SetDistances and YearSimhash for page.
+func DistanceBaseline(redisClient *redis.Client, url, year string, page, snapshotsPerPage int, baseline string) (string, error) {
+	if page <= 1 {
+		return "", nil
+	}
+	ctx := context.Background()
+	key := Surt(url)
+	timestamps, err := redisClient.HKeys(ctx, key).Result()
+	if err != nil {
+		return "", err
+	}
+	timestamps = slices.DeleteFunc(timestamps, func(ts string) bool { return ts == year || !strings.HasPrefix(ts, year) })
+	slices.Sort(timestamps)
+	totalPages := int(math.Ceil(float64(len(timestamps)) / float64(snapshotsPerPage)))
+	start := (min(page, totalPages) - 1) * snapshotsPerPage
+	if start <= 0 {
+		return "", nil
+	}
+	ts := timestamps[0]
+	if baseline == DISTANCES_PREVIOUS {
+		ts = timestamps[start-1]
+	}
+	return redisClient.HGet(ctx, key, ts).Result()
 }
 
 // YearSimhash retrieves stored simhash data from Redis for a given URL and year.
@@ -66,14 +145,21 @@ func handleResults(redisClient *redis.Client, timestamps []string, key string, s
 
 	results, err := redisClient.HMGet(context.Background(), key, timestamps...).Result()
 	if err != nil {
-		log.Printf("cannot fetch results for %s page %d: %v", key, page, err)
+		slog.Error("cannot fetch results", "key", key, "page", page, "error", err)
+		return nil
+	}
+
+	sources, err := redisClient.HMGet(context.Background(), SourcesKey(key), timestamps...).Result()
+	if err != nil {
+		slog.Error("cannot fetch sources", "key", key, "page", page, "error", err)
 		return nil
 	}
 
 	captureResults := make([]CaptureResult, 0, len(results))
 	for i, simhash := range results {
 		if simhashStr, ok := simhash.(string); ok {
-			captureResults = append(captureResults, CaptureResult{Timestamp: timestamps[i], Simhash: simhashStr})
+			source, _ := sources[i].(string)
+			captureResults = append(captureResults, CaptureResult{Timestamp: timestamps[i], Simhash: simhashStr, Source: source})
 		}
 	}
 	return captureResults
@@ -81,20 +167,25 @@ func handleResults(redisClient *redis.Client, timestamps []string, key string, s
 
 // TimestampSimHash retrieves stored simhash data from Redis for a given URL and timestamp.
 func TimestampSimHash(redisClient *redis.Client, url, timestamp string) (map[string]string, error) {
-	if url == "" || timestamp == "" || !validateTimestamp(timestamp) {
+	if url == "" || !CaptureTimestampIsValid(timestamp) {
 		return nil, errors.New("invalid URL or timestamp")
 	}
 	key := Surt(url)
 
+	// A missing capture or year is not an error, it is reported below.
 	result, err := redisClient.HGet(context.Background(), key, timestamp).Result()
-	if err != nil {
+	if err != nil && err != redis.Nil {
 		return nil, fmt.Errorf("error loading simhash data for url %s timestamp %s (%s)", url, timestamp, err)
 	} else if len(result) != 0 {
-		return map[string]string{"simhash": result}, nil
+		resultsMap := map[string]string{"simhash": result}
+		if source, err := redisClient.HGet(context.Background(), SourcesKey(key), timestamp).Result(); err == nil {
+			resultsMap["source"] = source
+		}
+		return resultsMap, nil
 	}
 
 	result, err = redisClient.HGet(context.Background(), key, timestamp[:4]).Result()
-	if err != nil {
+	if err != nil && err != redis.Nil {
 		return nil, fmt.Errorf("error loading simhash data for url %s timestamp %s (%s)", url, timestamp, err)
 	} else if len(result) != 0 {
 		return map[string]string{"status": "error", "message": "NO_CAPTURES"}, nil
@@ -103,67 +194,401 @@ func TimestampSimHash(redisClient *redis.Client, url, timestamp string) (map[str
 	return map[string]string{"status": "error", "message": "CAPTURE_NOT_FOUND"}, nil
 }
 
+// SimhashesAt retrieves the stored simhashes of url for the given timestamps.
+// Timestamps without a stored simhash are absent from the returned map.
+func SimhashesAt(redisClient *redis.Client, url string, timestamps []string) (map[string]string, error) {
+	for _, ts := range timestamps {
+		if !CaptureTimestampIsValid(ts) {
+			return nil, fmt.Errorf("invalid timestamp %s", ts)
+		}
+	}
+
+	results, err := redisClient.HMGet(context.Background(), Surt(url), timestamps...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error loading simhash data for url %s (%s)", url, err)
+	}
+
+	simhashes := make(map[string]string, len(results))
+	for i, result := range results {
+		if simhash, ok := result.(string); ok && simhash != "" {
+			simhashes[timestamps[i]] = simhash
+		}
+	}
+	return simhashes, nil
+}
+
+// AllSimhashes retrieves every stored simhash of url, keyed by timestamp.
+func AllSimhashes(redisClient *redis.Client, url string) (map[string]string, error) {
+	results, err := redisClient.HGetAll(context.Background(), Surt(url)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error loading simhash data for url %s (%s)", url, err)
+	}
+	for ts := range results {
+		if !CaptureTimestampIsValid(ts) {
+			delete(results, ts)
+		}
+	}
+	return results, nil
+}
+
+// DeleteSimhashes removes the simhashes of url stored at timestamps and bumps
+// the revision. When timestamps is nil every simhash of url and its metadata
+// are removed.
+func DeleteSimhashes(redisClient *redis.Client, url string, timestamps []string) error {
+	ctx := context.Background()
+	key := Surt(url)
+	if timestamps == nil {
+		if err := redisClient.Del(ctx, key, MetaKey(key), SourcesKey(key)).Err(); err != nil {
+			return fmt.Errorf("cannot delete simhashes of %s, %w", url, err)
+		}
+		return nil
+	}
+	if len(timestamps) == 0 {
+		return nil
+	}
+
+	revision, err := NextRevision(ctx, redisClient)
+	if err != nil {
+		return fmt.Errorf("cannot delete simhashes of %s, %w", url, err)
+	}
+	pipe := redisClient.TxPipeline()
+	pipe.HDel(ctx, key, timestamps...)
+	pipe.HDel(ctx, SourcesKey(key), timestamps...)
+	pipe.HSet(ctx, MetaKey(key), "revision", revision)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("cannot delete simhashes of %s, %w", url, err)
+	}
+	return nil
+}
+
+// JobKey returns the Redis key holding the record of job id.
+func JobKey(id string) string {
+	return "job:" + id
+}
+
+// SaveJob writes fields to the record of job id, which expires after ttl.
+func SaveJob(redisClient *redis.Client, id string, fields map[string]any, ttl time.Duration) error {
+	ctx := context.Background()
+	pipe := redisClient.TxPipeline()
+	pipe.HSet(ctx, JobKey(id), fields)
+	pipe.Expire(ctx, JobKey(id), ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("cannot save job %s, %w", id, err)
+	}
+	return nil
+}
+
+// MetaKey returns the Redis key holding metadata (such as the simhash size)
+// for the simhashes stored under key.
+func MetaKey(key string) string {
+	return key + ":meta"
+}
+
+// SourcesKey returns the Redis key holding the archive of each capture
+// (timestamp -> archive name) of the simhashes stored under key, when they
+// were merged from several archives.
+func SourcesKey(key string) string {
+	return key + ":sources"
+}
+
+// Metadata describes how the simhashes stored for a URL were computed.
+type Metadata struct {
+	SimhashSize int
+	Algorithm   string
+	Extractor   string
+	Revision    int64
+}
+
+// StoredMetadata returns the metadata recorded for url. Fields are zero when
+// nothing has been recorded; data written before the algorithm was recorded
+// reports the algorithm implied by its size and the default extractor.
+func StoredMetadata(redisClient *redis.Client, url string) (Metadata, error) {
+	fields, err := redisClient.HGetAll(context.Background(), MetaKey(Surt(url))).Result()
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	var meta Metadata
+	meta.SimhashSize, _ = strconv.Atoi(fields["simhash_size"])
+	meta.Revision, _ = strconv.ParseInt(fields["revision"], 10, 64)
+	meta.Algorithm = fields["algo"]
+	meta.Extractor = fields["extractor"]
+	if meta.SimhashSize != 0 {
+		if meta.Algorithm == "" {
+			meta.Algorithm = fmt.Sprintf("simhash%d", meta.SimhashSize)
+		}
+		if meta.Extractor == "" {
+			meta.Extractor = "default"
+		}
+	}
+	return meta, nil
+}
+
+// StoredSimhashSize returns the simhash size recorded for url, or 0 when
+// nothing has been recorded yet.
+func StoredSimhashSize(redisClient *redis.Client, url string) (int, error) {
+	size, err := redisClient.HGet(context.Background(), MetaKey(Surt(url)), "simhash_size").Int()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return size, err
+}
+
+// REVISION_KEY is the Redis counter the revisions of stored simhashes are
+// drawn from.
+const REVISION_KEY = "simhash:revision"
+
+// NextRevision returns a new revision for simhashes being written. Revisions
+// come from one counter rather than one per URL, so a URL whose simhashes
+// expired or were deleted never reuses the revision of older results.
+func NextRevision(ctx context.Context, redisClient *redis.Client) (int64, error) {
+	return redisClient.Incr(ctx, REVISION_KEY).Result()
+}
+
+// StoredRevision returns the revision of the simhashes stored for url. It
+// changes on every write, so a changed revision means cached results are
+// stale.
+func StoredRevision(redisClient *redis.Client, url string) (int64, error) {
+	revision, err := redisClient.HGet(context.Background(), MetaKey(Surt(url)), "revision").Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return revision, err
+}
+
+// TrimScheme returns an http(s) URL without its scheme, its default port and
+// the trailing slash of a bare host, the form URLs are passed to the API in.
+// It returns false for other URLs.
+func TrimScheme(rawURL string) (string, bool) {
+	url, ok := strings.CutPrefix(rawURL, "https://")
+	if !ok {
+		url, ok = strings.CutPrefix(rawURL, "http://")
+	}
+	if !ok || url == "" {
+		return "", false
+	}
+	host, path, _ := strings.Cut(url, "/")
+	host = strings.TrimSuffix(strings.TrimSuffix(host, ":80"), ":443")
+	if path == "" {
+		return host, true
+	}
+	return host + "/" + path, true
+}
+
+// COLLECTION_PREFIX starts the URLs scoped to an Archive-It collection,
+// archive-it:COLLECTION:URL. Scoped URLs are stored, indexed and calculated
+// apart from the same URLs in the Wayback Machine.
+const COLLECTION_PREFIX = "archive-it:"
+
+// InCollection returns url scoped to the Archive-It collection, or url
+// itself when url or collection is empty.
+func InCollection(url, collection string) string {
+	if url == "" || collection == "" {
+		return url
+	}
+	return COLLECTION_PREFIX + collection + ":" + url
+}
+
+// SplitCollection returns the Archive-It collection of url and url without
+// it. The collection is empty for URLs of the Wayback Machine.
+func SplitCollection(url string) (string, string) {
+	rest, ok := strings.CutPrefix(url, COLLECTION_PREFIX)
+	if !ok {
+		return "", url
+	}
+	collection, rawURL, ok := strings.Cut(rest, ":")
+	if !ok {
+		return "", url
+	}
+	return collection, rawURL
+}
+
+// CollectionIsValid reports whether collection is the numeric ID of an
+// Archive-It collection.
+func CollectionIsValid(collection string) bool {
+	_, err := strconv.ParseUint(collection, 10, 32)
+	return err == nil
+}
+
 // Surt converts a URL into a SURT (Sort-friendly URI Reordering Transform)
+// after canonicalizing it, see Canonicalize.
 func Surt(url string) string {
-	domainParts := strings.Split(url, ".")
+	domainParts := strings.Split(Canonicalize(url), ".")
 	sort.Strings(domainParts)
 	return strings.Join(domainParts, ",")
 }
 
-// URLIsValid validates the URL using regex.
 var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9_.+-]+@[a-zA-Z0-9-]+\.[a-zA-Z0-9-.]+$`)
 
-func URLIsValid(url string) bool {
-	if url == "" || emailRegex.MatchString(url) {
+// hostProfile converts hosts to ASCII like browsers do, mapping and
+// validating internationalized labels, but allows underscores, which are
+// common in the hosts of archived URLs.
+var hostProfile = idna.New(idna.MapForLookup(), idna.BidiRule(), idna.StrictDomainName(false))
+
+// CheckURL returns why rawURL is not an http(s) URL, or a URL without a
+// scheme such as example.com/page, whose host is an IP address or a domain
+// under a public suffix. Internationalized domains are accepted in Unicode
+// or punycode. The returned error completes "invalid url, ...".
+func CheckURL(rawURL string) error {
+	switch {
+	case rawURL == "":
+		return errors.New("must not be empty")
+	case strings.ContainsFunc(rawURL, unicode.IsSpace):
+		return errors.New("must not contain whitespace")
+	case emailRegex.MatchString(rawURL):
+		return errors.New("is an e-mail address, not a URL")
+	}
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		var urlErr *neturl.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("cannot be parsed, %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme %q must be http or https", u.Scheme)
+	}
+	host := u.Hostname()
+	if host == "" {
+		return errors.New("must have a host")
+	}
+	if port := u.Port(); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("port %s must be from 1 to 65535", port)
+		}
+	}
+	if net.ParseIP(host) != nil {
+		return nil
+	}
+	ascii, err := hostProfile.ToASCII(strings.TrimSuffix(host, "."))
+	if err != nil {
+		return fmt.Errorf("host %q is not a valid domain name, %w", host, err)
+	}
+	if !strings.Contains(ascii, ".") {
+		return fmt.Errorf("host %q must be a domain under a public suffix, e.g. example.com", host)
+	}
+	// Unlisted suffixes fall back to the last label, which is not ICANN.
+	// Private suffixes such as blogspot.com are sites of their own.
+	suffix, icann := publicsuffix.PublicSuffix(ascii)
+	if !icann && !strings.Contains(suffix, ".") {
+		return fmt.Errorf("host %q does not end with a known public suffix", host)
+	}
+	if icann && suffix == ascii {
+		return fmt.Errorf("host %q is a public suffix, not a domain", host)
+	}
+	return nil
+}
+
+// MIN_YEAR is the year of the first captures of the Wayback Machine.
+const MIN_YEAR = 1996
+
+// YearIsValid reports whether year is a 4-digit year from MIN_YEAR to the
+// current year.
+func YearIsValid(year string) bool {
+	y, err := strconv.Atoi(year)
+	return err == nil && len(year) == 4 && y >= MIN_YEAR && y <= time.Now().UTC().Year()
+}
+
+// TimestampIsValid reports whether ts is a 14-digit Wayback timestamp, or a
+// partial one such as 2020, 202001 or 20200115, denoting a valid date in a
+// valid year.
+func TimestampIsValid(ts string) bool {
+	if len(ts) < 4 || len(ts) > 14 || len(ts)%2 != 0 || strings.Trim(ts, "0123456789") != "" {
 		return false
 	}
-	suffix, _ := publicsuffix.PublicSuffix(url)
-	return suffix != ""
+	if _, err := time.Parse("20060102150405"[:len(ts)], ts); err != nil {
+		return false
+	}
+	return YearIsValid(ts[:4])
 }
 
-// CompressCaptures compresses capture timestamps and returns structured data.
+// CaptureTimestampIsValid reports whether ts is a 14-digit Wayback timestamp
+// denoting a valid date in a valid year, as single captures are addressed.
+func CaptureTimestampIsValid(ts string) bool {
+	return len(ts) == 14 && TimestampIsValid(ts)
+}
+
+// CompressCaptures groups captures by day, in the format of the Python
+// service:
+//
+//	captures: [[year, [month, [day, [[hhmmss, hash_id], ...]], ...], ...], ...]
+//	hashes:   [simhash, ...]
+//
+// Years, months, days and the captures of a day are sorted in ascending
+// order, and hash_id indexes hashes, which lists each distinct SimHash once in
+// the order of its first capture, so the same captures always compress to
+// the same output.
 func CompressCaptures(captures []CaptureResult) ([][]interface{}, []string) {
-	hashDict := make(map[string]int)
-	grouped := make(map[int]map[int]map[int][][]interface{})
+	captures = slices.Clone(captures)
+	slices.SortStableFunc(captures, func(a, b CaptureResult) int {
+		return strings.Compare(a.Timestamp, b.Timestamp)
+	})
 
+	hashIDs := make(map[string]int)
+	hashes := make([]string, 0)
+	newCaptures := make([][]interface{}, 0)
 	for _, capture := range captures {
 		ts, simhash := capture.Timestamp, capture.Simhash
 		year, month, day := atoi(ts[:4]), atoi(ts[4:6]), atoi(ts[6:8])
-		hms := ts[8:]
 
-		if _, exists := hashDict[simhash]; !exists {
-			hashDict[simhash] = len(hashDict)
+		hashID, exists := hashIDs[simhash]
+		if !exists {
+			hashID = len(hashes)
+			hashIDs[simhash] = hashID
+			hashes = append(hashes, simhash)
 		}
-		hashID := hashDict[simhash]
 
-		if _, ok := grouped[year]; !ok {
-			grouped[year] = make(map[int]map[int][][]interface{})
+		// Captures are sorted, so a capture belongs to the last year, month
+		// and day entries or starts new ones.
+		if len(newCaptures) == 0 || newCaptures[len(newCaptures)-1][0] != year {
+			newCaptures = append(newCaptures, []interface{}{year})
 		}
-		if _, ok := grouped[year][month]; !ok {
-			grouped[year][month] = make(map[int][][]interface{})
+		y := newCaptures[len(newCaptures)-1]
+		if len(y) == 1 || y[len(y)-1].([]interface{})[0] != month {
+			y = append(y, []interface{}{month})
 		}
-		grouped[year][month][day] = append(grouped[year][month][day], []interface{}{hms, hashID})
-	}
-
-	newCaptures := make([][]interface{}, 0)
-	for y, yc := range grouped {
-		yearEntry := []interface{}{y}
-		for m, mc := range yc {
-			monthEntry := []interface{}{m}
-			for d, dc := range mc {
-				monthEntry = append(monthEntry, []interface{}{d, dc})
-			}
-			yearEntry = append(yearEntry, monthEntry)
+		m := y[len(y)-1].([]interface{})
+		if len(m) == 1 || m[len(m)-1].([]interface{})[0] != day {
+			m = append(m, []interface{}{day, [][]interface{}{}})
 		}
-		newCaptures = append(newCaptures, yearEntry)
+		d := m[len(m)-1].([]interface{})
+		d[1] = append(d[1].([][]interface{}), []interface{}{ts[8:], hashID})
+		y[len(y)-1] = m
+		newCaptures[len(newCaptures)-1] = y
 	}
 
-	sortedHashes := make([]string, len(hashDict))
-	for hash, id := range hashDict {
-		sortedHashes[id] = hash
-	}
+	return newCaptures, hashes
+}
 
-	return newCaptures, sortedHashes
+// XORDelta returns the stored simhashes of hashes with every hash but the
+// first replaced by its XOR with the hash before it. Hash i is reconstructed
+// as the XOR of delta i and hash i-1. Versions of a page usually differ in a
+// few bits, so the deltas are mostly zero bytes.
+func XORDelta(hashes []string) ([]string, error) {
+	deltas := make([]string, len(hashes))
+	var prev []byte
+	for i, hash := range hashes {
+		data, err := simhash.Decode(hash, simhash.EncodingBase64)
+		if err != nil {
+			return nil, err
+		}
+		if prev != nil && len(prev) != len(data) {
+			return nil, fmt.Errorf("cannot XOR simhashes of %d and %d bytes", len(prev), len(data))
+		}
+		delta := slices.Clone(data)
+		for k := range prev {
+			delta[k] ^= prev[k]
+		}
+		if deltas[i], err = simhash.Encode(delta, simhash.EncodingBase64); err != nil {
+			return nil, err
+		}
+		prev = data
+	}
+	return deltas, nil
 }
 
 // Atoi safely converts string to int
@@ -171,8 +596,3 @@ func atoi(s string) int {
 	val, _ := strconv.Atoi(s)
 	return val
 }
-
-func validateTimestamp(ts string) bool {
-	_, err := time.Parse("20060102150405", ts)
-	return err == nil
-}
@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"slices"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of testdata")
+
+// COMPRESS_CAPTURES_INPUT spans several years, months and days, repeats
+// SimHashes across days and years, and is shuffled.
+var COMPRESS_CAPTURES_INPUT = []CaptureResult{
+	{Timestamp: "20210301120000", Simhash: "C"},
+	{Timestamp: "20200115093000", Simhash: "B"},
+	{Timestamp: "20200101000000", Simhash: "A"},
+	{Timestamp: "20200115000000", Simhash: "A"},
+	{Timestamp: "20201231235959", Simhash: "B"},
+	{Timestamp: "20200201000000", Simhash: "A"},
+	{Timestamp: "20210101000000", Simhash: "A"},
+	{Timestamp: "20200101060000", Simhash: "B"},
+	{Timestamp: "20210301000000", Simhash: "D"},
+	{Timestamp: "20200115120000", Simhash: "C"},
+}
+
+func TestCompressCaptures(t *testing.T) {
+	input := slices.Clone(COMPRESS_CAPTURES_INPUT)
+	captures, hashes := CompressCaptures(input)
+	got, err := json.MarshalIndent(map[string]any{"captures": captures, "hashes": hashes}, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, '\n')
+
+	const golden = "testdata/compress_captures.json"
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("CompressCaptures returned\n%s\nwant\n%s", got, want)
+	}
+	if !slices.Equal(input, COMPRESS_CAPTURES_INPUT) {
+		t.Errorf("CompressCaptures reordered its input")
+	}
+}
+
+func TestCompressCapturesOrder(t *testing.T) {
+	// Any order of the same captures compresses to the same output.
+	captures, hashes := CompressCaptures(COMPRESS_CAPTURES_INPUT)
+	want, _ := json.Marshal([]any{captures, hashes})
+	reversed := slices.Clone(COMPRESS_CAPTURES_INPUT)
+	slices.Reverse(reversed)
+	captures, hashes = CompressCaptures(reversed)
+	got, _ := json.Marshal([]any{captures, hashes})
+	if !bytes.Equal(got, want) {
+		t.Errorf("reversed input compressed to %s, want %s", got, want)
+	}
+}
+
+func TestCompressCapturesEmpty(t *testing.T) {
+	captures, hashes := CompressCaptures(nil)
+	if len(captures) != 0 || len(hashes) != 0 {
+		t.Errorf("CompressCaptures(nil) = %v, %v", captures, hashes)
+	}
+}
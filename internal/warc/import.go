@@ -0,0 +1,282 @@
+package warc
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/job"
+	"github.com/Yaxhveer/wayback-discover-diff-go/internal/utils"
+	"github.com/Yaxhveer/wayback-discover-diff-go/pkg/simhash"
+	"github.com/redis/go-redis/v9"
+)
+
+// FLUSH_SIZE is the number of simhashes held in memory before they are
+// written to Redis.
+const FLUSH_SIZE = 1000
+
+// Options configures an import.
+type Options struct {
+	SimhashSize int
+	Extractor   string
+	// Override replaces the simhashes of URLs stored with another algorithm
+	// or extractor, which are skipped otherwise.
+	Override bool
+	// Workers is the number of payloads hashed at once.
+	Workers int
+}
+
+// Stats counts the records of an import.
+type Stats struct {
+	Records int `json:"records"`
+	// Responses are the response records with an HTML payload.
+	Responses int `json:"responses"`
+	Stored    int `json:"stored"`
+	// Failed are the payloads no features could be extracted from.
+	Failed int `json:"failed"`
+	// Skipped are the simhashes of URLs stored with another algorithm or
+	// extractor.
+	Skipped int `json:"skipped"`
+	URLs    int `json:"urls"`
+}
+
+// capture is the HTML payload of a response record.
+type capture struct {
+	url       string
+	timestamp string
+	body      string
+	simhash   string
+}
+
+// Import reads the response records of the WARC files at paths, computes
+// the simhashes of their HTML payloads and stores them in Redis under the
+// URL and timestamp of the record, as jobs store the captures they download,
+// so archives can be backfilled without fetching captures from the Wayback
+// Machine. URLs are stored without their scheme, e.g. example.com/page.
+func Import(ctx context.Context, redisClient *redis.Client, paths []string, opts Options) (Stats, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	captures := make(chan capture)
+	hashed := make(chan capture)
+	var wg sync.WaitGroup
+	for range max(opts.Workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range captures {
+				c.simhash, _ = job.HashDocument(c.body, opts.SimhashSize, opts.Extractor)
+				c.body = ""
+				hashed <- c
+			}
+		}()
+	}
+
+	var stats Stats
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(captures)
+		for _, path := range paths {
+			if err := readFile(ctx, path, &stats, captures); err != nil {
+				readErr <- fmt.Errorf("cannot read %s, %w", path, err)
+				return
+			}
+		}
+		readErr <- nil
+	}()
+	go func() {
+		wg.Wait()
+		close(hashed)
+	}()
+
+	s := &store{redisClient: redisClient, opts: opts, pending: make(map[string]map[string]string), urls: make(map[string]writeMode)}
+	var storeErr error
+	for c := range hashed {
+		if c.simhash == "" {
+			stats.Failed++
+			continue
+		}
+		if storeErr == nil {
+			if storeErr = s.add(ctx, c, &stats); storeErr != nil {
+				cancel()
+			}
+		}
+	}
+	if storeErr == nil {
+		storeErr = s.flush(ctx, &stats)
+	}
+	stats.URLs = len(s.urls)
+	if storeErr != nil {
+		return stats, storeErr
+	}
+	return stats, <-readErr
+}
+
+// readFile sends the HTML payloads of the response records of the WARC file
+// at path to captures.
+func readFile(ctx context.Context, path string, stats *Stats, captures chan<- capture) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := NewReader(f)
+	if err != nil {
+		return err
+	}
+
+	for {
+		record, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		stats.Records++
+		c, ok := responseCapture(record)
+		if !ok {
+			continue
+		}
+		stats.Responses++
+		select {
+		case captures <- c:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// responseCapture returns the capture of a response record with a
+// successful HTML payload.
+func responseCapture(record *Record) (capture, bool) {
+	if record.Type() != "response" || !strings.HasPrefix(record.Header.Get("Content-Type"), "application/http") {
+		return capture{}, false
+	}
+	date, err := time.Parse(time.RFC3339, record.Header.Get("WARC-Date"))
+	if err != nil {
+		return capture{}, false
+	}
+	url, ok := captureURL(record.Header.Get("WARC-Target-URI"))
+	if !ok {
+		return capture{}, false
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(record.Content), nil)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return capture{}, false
+	}
+	defer resp.Body.Close()
+	cType := strings.ToLower(resp.Header.Get("Content-Type"))
+	if !strings.Contains(cType, "text") && !strings.Contains(cType, "html") {
+		return capture{}, false
+	}
+
+	var reader io.Reader = resp.Body
+	switch encoding := resp.Header.Get("Content-Encoding"); {
+	case strings.Contains(encoding, "gzip"):
+		gzReader, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return capture{}, false
+		}
+		defer gzReader.Close()
+		reader = gzReader
+	case strings.Contains(encoding, "deflate"):
+		deflateReader := flate.NewReader(resp.Body)
+		defer deflateReader.Close()
+		reader = deflateReader
+	}
+	body, err := io.ReadAll(io.LimitReader(reader, job.MAP_CAPTURE_DOWNLOAD))
+	if err != nil {
+		return capture{}, false
+	}
+	return capture{url: url, timestamp: date.UTC().Format("20060102150405"), body: string(body)}, true
+}
+
+// captureURL returns the target URI of a record in the form URLs are passed
+// to the API in, see utils.TrimScheme.
+func captureURL(target string) (string, bool) {
+	return utils.TrimScheme(strings.Trim(target, "<>"))
+}
+
+// writeMode is how the simhashes of a URL are written by an import.
+type writeMode int
+
+const (
+	// writeAdd adds the simhashes to the stored ones.
+	writeAdd writeMode = iota + 1
+	// writeReplace replaces the simhashes stored with another algorithm or
+	// extractor, at the first write of the URL.
+	writeReplace
+	// writeSkip drops the simhashes of a URL stored with another algorithm
+	// or extractor without Override.
+	writeSkip
+)
+
+// store batches the simhashes of an import and writes them to Redis.
+type store struct {
+	redisClient *redis.Client
+	opts        Options
+	pending     map[string]map[string]string
+	size        int
+	urls        map[string]writeMode
+}
+
+func (s *store) add(ctx context.Context, c capture, stats *Stats) error {
+	if s.pending[c.url] == nil {
+		s.pending[c.url] = make(map[string]string)
+	}
+	s.pending[c.url][c.timestamp] = c.simhash
+	if s.size++; s.size >= FLUSH_SIZE {
+		return s.flush(ctx, stats)
+	}
+	return nil
+}
+
+func (s *store) flush(ctx context.Context, stats *Stats) error {
+	for url, results := range s.pending {
+		mode := s.urls[url]
+		if mode == 0 {
+			meta, err := utils.StoredMetadata(s.redisClient, url)
+			if err != nil {
+				return err
+			}
+			mode = writeAdd
+			if meta.Algorithm != "" && (meta.Algorithm != simhash.Algorithm(s.opts.SimhashSize) || meta.Extractor != s.opts.Extractor) {
+				mode = writeReplace
+				if !s.opts.Override {
+					slog.Warn("skipping URL stored with another algorithm or extractor", "url", url, "algo", meta.Algorithm, "extractor", meta.Extractor)
+					mode = writeSkip
+				}
+			}
+		}
+		if mode == writeSkip {
+			s.urls[url] = writeSkip
+			stats.Skipped += len(results)
+			continue
+		}
+
+		err := job.StoreSimhashes(ctx, s.redisClient, url, results, job.Options{
+			SimhashSize: s.opts.SimhashSize,
+			Extractor:   s.opts.Extractor,
+			Replace:     mode == writeReplace,
+		})
+		if err != nil {
+			return err
+		}
+		s.urls[url] = writeAdd
+		stats.Stored += len(results)
+	}
+	clear(s.pending)
+	s.size = 0
+	return nil
+}
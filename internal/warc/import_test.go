@@ -0,0 +1,84 @@
+package warc
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestReadFile(t *testing.T) {
+	want := []capture{
+		{url: "example.com", timestamp: "20200102030405", body: "<html><body><p>An example page of the archive.</p></body></html>"},
+		// The payload is gzipped and the WARC-Date is an hour ahead of UTC.
+		{url: "example.com/page", timestamp: "20200304040607", body: "<html><body><p>A gzipped page of the archive.</p></body></html>"},
+	}
+	for _, path := range []string{"testdata/example.warc", "testdata/example.warc.gz"} {
+		t.Run(path, func(t *testing.T) {
+			var stats Stats
+			captures := make(chan capture, len(FIXTURE_TYPES))
+			if err := readFile(context.Background(), path, &stats, captures); err != nil {
+				t.Fatal(err)
+			}
+			close(captures)
+
+			if stats.Records != len(FIXTURE_TYPES) || stats.Responses != len(want) {
+				t.Errorf("%d records and %d responses, want %d and %d", stats.Records, stats.Responses, len(FIXTURE_TYPES), len(want))
+			}
+			var got []capture
+			for c := range captures {
+				got = append(got, c)
+			}
+			if len(got) != len(want) {
+				t.Fatalf("%d captures, want %d", len(got), len(want))
+			}
+			for i := range want {
+				if got[i] != want[i] {
+					t.Errorf("capture %d %+v, want %+v", i, got[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestResponseCapture(t *testing.T) {
+	const response = "HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nContent-Length: 4\r\n\r\nbody"
+	for name, test := range map[string]struct {
+		header string
+		block  string
+		ok     bool
+	}{
+		"response":     {"WARC-Type: response\r\nContent-Type: application/http; msgtype=response\r\n", response, true},
+		"request":      {"WARC-Type: request\r\nContent-Type: application/http; msgtype=request\r\n", "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n", false},
+		"metadata":     {"WARC-Type: metadata\r\nContent-Type: application/warc-fields\r\n", "outlink: http://example.com/\r\n", false},
+		"resource":     {"WARC-Type: resource\r\nContent-Type: text/html\r\n", "<html></html>", false},
+		"date":         {"WARC-Type: response\r\nContent-Type: application/http\r\nWARC-Date: 2020-01-02\r\n", response, false},
+		"scheme":       {"WARC-Type: response\r\nContent-Type: application/http\r\nWARC-Target-URI: dns:example.com\r\n", response, false},
+		"redirect":     {"WARC-Type: response\r\nContent-Type: application/http\r\n", "HTTP/1.1 301 Moved Permanently\r\nLocation: /\r\nContent-Length: 0\r\n\r\n", false},
+		"bad gzip":     {"WARC-Type: response\r\nContent-Type: application/http\r\n", "HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nContent-Encoding: gzip\r\nContent-Length: 4\r\n\r\nbody", false},
+		"bad response": {"WARC-Type: response\r\nContent-Type: application/http\r\n", "not HTTP", false},
+	} {
+		header := "WARC/1.0\r\n" + test.header
+		if !strings.Contains(header, "WARC-Date") {
+			header += "WARC-Date: 2020-01-02T03:04:05Z\r\n"
+		}
+		if !strings.Contains(header, "WARC-Target-URI") {
+			header += "WARC-Target-URI: http://example.com/\r\n"
+		}
+		r, err := NewReader(strings.NewReader(header + "Content-Length: " + strconv.Itoa(len(test.block)) + "\r\n\r\n" + test.block + "\r\n\r\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		record, err := r.Next()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		c, ok := responseCapture(record)
+		if ok != test.ok {
+			t.Errorf("%s: responseCapture returned %v, want %v", name, ok, test.ok)
+		}
+		if ok && c.body != "body" {
+			t.Errorf("%s: body %q", name, c.body)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// Record is a WARC record. Its Content must be read or discarded before the
+// next record is read.
+type Record struct {
+	Header  textproto.MIMEHeader
+	Content io.Reader
+}
+
+// Type returns the WARC-Type of the record, e.g. response.
+func (r *Record) Type() string {
+	return r.Header.Get("WARC-Type")
+}
+
+// Reader reads the records of a WARC file, plain or gzipped.
+type Reader struct {
+	r       *bufio.Reader
+	tp      *textproto.Reader
+	content *io.LimitedReader
+}
+
+// NewReader returns a reader of the WARC records of r, which is decompressed
+// when it starts with the gzip magic number.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		// Each record of a .warc.gz file is a gzip member, which
+		// gzip.Reader reads as one stream.
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		br = bufio.NewReader(zr)
+	}
+	return &Reader{r: br, tp: textproto.NewReader(br)}, nil
+}
+
+// Next returns the next record, or io.EOF after the last one.
+func (r *Reader) Next() (*Record, error) {
+	if r.content != nil {
+		// Skip the rest of the previous record and the blank lines
+		// following it.
+		if _, err := io.Copy(io.Discard, r.content); err != nil {
+			return nil, err
+		}
+		r.content = nil
+	}
+
+	var version string
+	for {
+		line, err := r.tp.ReadLine()
+		if err != nil {
+			if errors.Is(err, io.EOF) && version == "" {
+				return nil, io.EOF
+			}
+			return nil, err
+		}
+		if line != "" {
+			version = line
+			break
+		}
+	}
+	if !strings.HasPrefix(version, "WARC/") {
+		return nil, fmt.Errorf("invalid WARC record version %q", version)
+	}
+	header, err := r.tp.ReadMIMEHeader()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	length, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid WARC record Content-Length %q", header.Get("Content-Length"))
+	}
+	r.content = &io.LimitedReader{R: r.r, N: length}
+	return &Record{Header: header, Content: r.content}, nil
+}
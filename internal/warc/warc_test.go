@@ -0,0 +1,82 @@
+package warc
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// FIXTURE_TYPES are the record types of the fixtures, in order.
+var FIXTURE_TYPES = []string{"warcinfo", "request", "response", "metadata", "response", "response", "response"}
+
+func TestReaderNext(t *testing.T) {
+	for _, path := range []string{"testdata/example.warc", "testdata/example.warc.gz"} {
+		t.Run(path, func(t *testing.T) {
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			r, err := NewReader(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var types []string
+			for {
+				record, err := r.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("record %d: %v", len(types), err)
+				}
+				types = append(types, record.Type())
+				switch len(types) {
+				case 1:
+					// Read the whole content of the warcinfo record.
+					content, err := io.ReadAll(record.Content)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if want := "software: test\r\nformat: WARC File Format 1.0\r\n"; string(content) != want {
+						t.Errorf("warcinfo content %q, want %q", content, want)
+					}
+				case 2:
+					if uri := record.Header.Get("WARC-Target-URI"); uri != "http://example.com/" {
+						t.Errorf("request WARC-Target-URI %q", uri)
+					}
+				case 3:
+					// Read part of the response, Next skips the rest.
+					line := make([]byte, 15)
+					if _, err := io.ReadFull(record.Content, line); err != nil || string(line) != "HTTP/1.1 200 OK" {
+						t.Errorf("response starts %q, %v", line, err)
+					}
+				}
+			}
+			if strings.Join(types, " ") != strings.Join(FIXTURE_TYPES, " ") {
+				t.Errorf("record types %v, want %v", types, FIXTURE_TYPES)
+			}
+			if _, err := r.Next(); err != io.EOF {
+				t.Errorf("Next after the last record returned %v, want io.EOF", err)
+			}
+		})
+	}
+}
+
+func TestReaderNextInvalid(t *testing.T) {
+	for name, file := range map[string]string{
+		"version":        "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n",
+		"content length": "WARC/1.0\r\nWARC-Type: response\r\nContent-Length: -1\r\n\r\n",
+		"no length":      "WARC/1.0\r\nWARC-Type: response\r\n\r\n",
+	} {
+		r, err := NewReader(strings.NewReader(file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Next(); err == nil || err == io.EOF {
+			t.Errorf("%s: Next returned %v", name, err)
+		}
+	}
+}
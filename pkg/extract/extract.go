@@ -0,0 +1,145 @@
+// Package extract extracts the weighted word features of HTML documents that
+// wayback-discover-diff feeds to SimHash, see package simhash.
+//
+// The text of a document outside of the stripped elements is lowercased,
+// punctuation is replaced by spaces and the text is split into words. Each
+// occurrence of a word counts once, or the weight of the innermost weighted
+// element around it when weights are set.
+//
+//	features, err := extract.Features(resp.Body, extract.Weighted)
+//
+// Default and Weighted are the profiles of the service. Features extracted
+// with them are stable within a major version of the module, like the
+// fingerprints of package simhash.
+package extract
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Options configures how features are extracted from a document.
+type Options struct {
+	// StripTags are the elements whose text is ignored, DefaultStripTags
+	// when nil.
+	StripTags []string
+	// Weights count the words inside an element several times. A word
+	// counts with the largest weight of the elements it is in, and once
+	// outside of them.
+	Weights map[string]int
+	// Tokenizer splits text into words, Tokenize when nil.
+	Tokenizer func(text string) []string
+	// MaxBytes limits the bytes of a document read, 0 for no limit.
+	MaxBytes int64
+	// MaxFeatures limits the distinct words extracted, 0 for no limit. Words
+	// first seen once the limit is reached are ignored.
+	MaxFeatures int
+}
+
+// DefaultStripTags are the elements whose content carries no text of the
+// page.
+var DefaultStripTags = []string{"script", "style", "noscript", "meta", "img", "audio", "video"}
+
+// Profiles of the service, selected with its extractor param.
+var (
+	// Default counts every word once.
+	Default = Options{}
+	// Weighted counts words in the title and headings several times, so
+	// changes to them weigh more.
+	Weighted = Options{Weights: map[string]int{
+		"title": 4,
+		"h1":    3,
+		"h2":    2,
+		"h3":    2,
+	}}
+)
+
+// Profile returns the options of the named profile of the service, default
+// or weighted.
+func Profile(name string) (Options, bool) {
+	switch name {
+	case "default":
+		return Default, true
+	case "weighted":
+		return Weighted, true
+	}
+	return Options{}, false
+}
+
+// ErrNoFeatures is returned for documents without any word.
+var ErrNoFeatures = errors.New("no features extracted")
+
+// Features reads an HTML document from r and returns its words with their
+// weights.
+func Features(r io.Reader, opts Options) (map[string]int, error) {
+	if opts.MaxBytes > 0 {
+		r = io.LimitReader(r, opts.MaxBytes)
+	}
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	stripTags := opts.StripTags
+	if stripTags == nil {
+		stripTags = DefaultStripTags
+	}
+	strip := make(map[string]struct{}, len(stripTags))
+	for _, tag := range stripTags {
+		strip[tag] = struct{}{}
+	}
+	tokenize := opts.Tokenizer
+	if tokenize == nil {
+		tokenize = Tokenize
+	}
+
+	features := make(map[string]int)
+	var extract func(*html.Node, int)
+	extract = func(n *html.Node, weight int) {
+		if n.Type == html.TextNode {
+			for _, word := range tokenize(n.Data) {
+				if _, seen := features[word]; seen || opts.MaxFeatures <= 0 || len(features) < opts.MaxFeatures {
+					features[word] += weight
+				}
+			}
+		} else if n.Type == html.ElementNode {
+			if _, found := strip[n.Data]; found {
+				return
+			}
+			if w, ok := opts.Weights[n.Data]; ok {
+				weight = max(weight, w)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			extract(c, weight)
+		}
+	}
+	extract(doc, 1)
+
+	if len(features) == 0 {
+		return nil, ErrNoFeatures
+	}
+	return features, nil
+}
+
+// Tokenize lowercases text, replaces ASCII punctuation by spaces and splits
+// it into words at white space.
+func Tokenize(text string) []string {
+	return strings.Fields(removePunctuation(strings.ToLower(text)))
+}
+
+// removePunctuation replaces ASCII punctuation by spaces.
+func removePunctuation(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x80 && strings.ContainsRune(PUNCTUATION, r) {
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+// PUNCTUATION are the characters Tokenize treats as spaces.
+const PUNCTUATION = "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~"
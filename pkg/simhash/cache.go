@@ -0,0 +1,81 @@
+package simhash
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+const cacheShards = 16
+
+// HashCache memoizes feature hashes so that a token repeated across the
+// captures of a job is hashed once. It is safe for concurrent use and holds
+// at most a fixed number of entries, evicting arbitrary ones when full.
+type HashCache struct {
+	shards   [cacheShards]cacheShard
+	capacity int
+	hits     atomic.Uint64
+	misses   atomic.Uint64
+}
+
+type cacheShard struct {
+	mu      sync.RWMutex
+	entries map[string]words
+}
+
+// NewHashCache returns a cache holding up to maxEntries feature hashes.
+func NewHashCache(maxEntries int) *HashCache {
+	c := &HashCache{capacity: max(maxEntries/cacheShards, 1)}
+	for i := range c.shards {
+		c.shards[i].entries = make(map[string]words)
+	}
+	return c
+}
+
+// hash returns the hash of feature, computing and storing it on a miss.
+// A nil cache always computes the hash.
+func (c *HashCache) hash(feature string) words {
+	if c == nil {
+		return hashFunc(feature)
+	}
+
+	shard := &c.shards[fnv32(feature)%cacheShards]
+	shard.mu.RLock()
+	h, ok := shard.entries[feature]
+	shard.mu.RUnlock()
+	if ok {
+		c.hits.Add(1)
+		return h
+	}
+	c.misses.Add(1)
+
+	h = hashFunc(feature)
+	shard.mu.Lock()
+	if len(shard.entries) >= c.capacity {
+		for k := range shard.entries {
+			delete(shard.entries, k)
+			break
+		}
+	}
+	shard.entries[feature] = h
+	shard.mu.Unlock()
+	return h
+}
+
+// Stats returns the number of lookups answered from the cache and of those
+// that had to hash the feature.
+func (c *HashCache) Stats() (hits, misses uint64) {
+	if c == nil {
+		return 0, 0
+	}
+	return c.hits.Load(), c.misses.Load()
+}
+
+// fnv32 is the 32-bit FNV-1a hash of s, used to pick a cache shard.
+func fnv32(s string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(s); i++ {
+		h ^= uint32(s[i])
+		h *= 16777619
+	}
+	return h
+}
@@ -0,0 +1,67 @@
+package simhash
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+// Hamming returns the number of differing bits between two packed simhashes.
+func Hamming(a, b []byte) (int, error) {
+	if len(a) != len(b) {
+		return 0, fmt.Errorf("simhash sizes differ: %d and %d bits", len(a)*8, len(b)*8)
+	}
+	return hamming(a, b), nil
+}
+
+// hamming counts differing bits of two equally sized slices, eight bytes at a time.
+func hamming(a, b []byte) int {
+	distance := 0
+	i := 0
+	for ; i+8 <= len(a); i += 8 {
+		distance += bits.OnesCount64(binary.LittleEndian.Uint64(a[i:]) ^ binary.LittleEndian.Uint64(b[i:]))
+	}
+	for ; i < len(a); i++ {
+		distance += bits.OnesCount8(a[i] ^ b[i])
+	}
+	return distance
+}
+
+// Similarity returns the share of equal bits between two packed simhashes,
+// from 0 (every bit differs) to 1 (identical).
+func Similarity(a, b []byte) (float64, error) {
+	distance, err := Hamming(a, b)
+	if err != nil {
+		return 0, err
+	}
+	if len(a) == 0 {
+		return 1, nil
+	}
+	return 1 - float64(distance)/float64(len(a)*8), nil
+}
+
+// HammingMany returns the hamming distance between a and each of others.
+func HammingMany(a []byte, others [][]byte) ([]int, error) {
+	distances := make([]int, len(others))
+	for i, b := range others {
+		if len(a) != len(b) {
+			return nil, fmt.Errorf("simhash sizes differ: %d and %d bits", len(a)*8, len(b)*8)
+		}
+		distances[i] = hamming(a, b)
+	}
+	return distances, nil
+}
+
+// HammingEncoded decodes two simhashes in the given encoding and returns
+// their hamming distance.
+func HammingEncoded(a, b, encoding string) (int, error) {
+	da, err := Decode(a, encoding)
+	if err != nil {
+		return 0, err
+	}
+	db, err := Decode(b, encoding)
+	if err != nil {
+		return 0, err
+	}
+	return Hamming(da, db)
+}
@@ -0,0 +1,27 @@
+// Package simhash computes the SimHash fingerprints of web pages stored by
+// wayback-discover-diff.
+//
+// Each weighted feature, usually a word extracted from a page, is hashed
+// with Blake2b-512. Every bit of the fingerprint is set when the features
+// whose hash has that bit set outweigh those where it is clear. Fingerprints
+// of similar pages differ in few bits, which Hamming counts.
+//
+//	h, err := simhash.Sum(map[string]int{"hello": 2, "world": 1}, simhash.Options{Size: 256})
+//	if err != nil {
+//		return err
+//	}
+//	stored, err := simhash.Parse(encoded, simhash.EncodingBase64)
+//	distance, err := h.Hamming(stored)
+//
+// A Simhash is packed as little-endian bytes, least significant bit first,
+// and the service stores it base64 encoded.
+//
+// # Stability
+//
+// The package follows semantic versioning with the module. Within a major
+// version the exported API only grows, and the fingerprint of given features
+// and size never changes, so fingerprints stored by one release compare with
+// those computed by any later one. A change of the algorithm would be
+// released under a new algorithm name, see Algorithm, or a new major
+// version.
+package simhash
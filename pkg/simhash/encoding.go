@@ -0,0 +1,105 @@
+package simhash
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Supported textual encodings of a packed simhash. Base64 is the format
+// stored in Redis; the others are offered to consumers that embed hashes
+// in URLs or databases.
+const (
+	EncodingBase64    = "base64"
+	EncodingBase64URL = "base64url"
+	EncodingHex       = "hex"
+)
+
+// ValidEncoding reports whether name is a supported encoding.
+// An empty name is treated as the default (base64).
+func ValidEncoding(name string) bool {
+	switch name {
+	case "", EncodingBase64, EncodingBase64URL, EncodingHex:
+		return true
+	}
+	return false
+}
+
+// Encode converts packed simhash bytes to the given encoding.
+func Encode(data []byte, encoding string) (string, error) {
+	switch encoding {
+	case "", EncodingBase64:
+		return base64.StdEncoding.EncodeToString(data), nil
+	case EncodingBase64URL:
+		return base64.RawURLEncoding.EncodeToString(data), nil
+	case EncodingHex:
+		return hex.EncodeToString(data), nil
+	}
+	return "", fmt.Errorf("unsupported encoding %q", encoding)
+}
+
+// Decode converts an encoded simhash back to its packed bytes.
+// base64url input is accepted with or without padding.
+func Decode(s, encoding string) ([]byte, error) {
+	switch encoding {
+	case "", EncodingBase64:
+		return base64.StdEncoding.DecodeString(s)
+	case EncodingBase64URL:
+		return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	case EncodingHex:
+		return hex.DecodeString(s)
+	}
+	return nil, fmt.Errorf("unsupported encoding %q", encoding)
+}
+
+// Reencode converts a simhash between two encodings.
+func Reencode(s, from, to string) (string, error) {
+	if from == to || (from == "" && to == EncodingBase64) || (from == EncodingBase64 && to == "") {
+		return s, nil
+	}
+	data, err := Decode(s, from)
+	if err != nil {
+		return "", err
+	}
+	return Encode(data, to)
+}
+
+// Alternative representations of a simhash for clients that work on the
+// numeric value rather than the packed bytes.
+const (
+	FormatBits = "bits"
+	FormatUint = "uint"
+)
+
+// ValidFormat reports whether name is a supported representation.
+// An empty name means the encoded string form.
+func ValidFormat(name string) bool {
+	switch name {
+	case "", FormatBits, FormatUint:
+		return true
+	}
+	return false
+}
+
+// toInt interprets packed little-endian simhash bytes as an unsigned integer.
+func toInt(data []byte) *big.Int {
+	be := make([]byte, len(data))
+	for i, b := range data {
+		be[len(data)-1-i] = b
+	}
+	return new(big.Int).SetBytes(be)
+}
+
+// FormatAsBits renders packed simhash bytes as a bit string, most significant
+// bit first, zero padded to the full simhash size.
+func FormatAsBits(data []byte) string {
+	bits := toInt(data).Text(2)
+	return strings.Repeat("0", len(data)*8-len(bits)) + bits
+}
+
+// FormatAsUint renders packed simhash bytes as a decimal integer.
+func FormatAsUint(data []byte) string {
+	return toInt(data).Text(10)
+}
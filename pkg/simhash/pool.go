@@ -0,0 +1,33 @@
+package simhash
+
+import (
+	"hash"
+	"sync"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// featureHasher is a reusable Blake2b-512 state with its input and digest buffers.
+type featureHasher struct {
+	h   hash.Hash
+	in  []byte
+	sum []byte
+}
+
+// Pools for the per-feature, per-capture and per-result buffers of the hot path,
+// so that hashing a large backfill does not allocate for every feature.
+var (
+	hasherPool = sync.Pool{New: func() any {
+		h, _ := blake2b.New512(nil)
+		return &featureHasher{h: h, sum: make([]byte, 0, blake2b.Size)}
+	}}
+	vectorPool = sync.Pool{New: func() any { return new(vector) }}
+	bytesPool  = sync.Pool{New: func() any { return new([maxWords * 8]byte) }}
+)
+
+// getVector returns a zeroed vector from the pool.
+func getVector() *vector {
+	vec := vectorPool.Get().(*vector)
+	*vec = vector{}
+	return vec
+}
@@ -0,0 +1,181 @@
+package simhash
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultSize is the simhash size in bits used when none is requested.
+const DefaultSize = 256
+
+// Sizes are the supported simhash sizes in bits.
+var Sizes = []int{64, 128, 256, 512}
+
+// ValidSize reports whether size is one of the supported simhash sizes.
+func ValidSize(size int) bool {
+	return slices.Contains(Sizes, size)
+}
+
+// Algorithm returns the name of the fingerprint algorithm producing
+// simhashes of size bits, e.g. simhash256.
+func Algorithm(size int) string {
+	return "simhash" + strconv.Itoa(size)
+}
+
+// AlgorithmSize returns the simhash size of the named algorithm, and false
+// when the algorithm is not supported.
+func AlgorithmSize(name string) (int, bool) {
+	sizeStr, ok := strings.CutPrefix(name, "simhash")
+	if !ok {
+		return 0, false
+	}
+	size, err := strconv.Atoi(sizeStr)
+	return size, err == nil && ValidSize(size)
+}
+
+// GetSimhash computes the simhash of size bits of weighted features and
+// returns it base64 encoded, the form stored by the service.
+func GetSimhash(features map[string]int, size int) string {
+	return GetSimhashCached(features, size, nil)
+}
+
+// GetSimhashCached is GetSimhash looking up feature hashes in cache first.
+func GetSimhashCached(features map[string]int, size int, cache *HashCache) string {
+	simhash := generateSimhash(features, size, cache)
+	return encodeSimhashToBase64(simhash, size)
+}
+
+// maxWords is the number of 64-bit words in a Blake2b-512 digest, which
+// bounds the largest supported simhash size.
+const maxWords = 8
+
+// words holds up to 512 bits, least significant word first.
+type words [maxWords]uint64
+
+// hashFunc hashes data with Blake2b-512. The digest is read as a big-endian
+// integer and split into words, so words[0] holds its lowest 64 bits.
+func hashFunc(data string) words {
+	fh := hasherPool.Get().(*featureHasher)
+	fh.h.Reset()
+	fh.in = append(fh.in[:0], data...)
+	fh.h.Write(fh.in)
+	sum := fh.h.Sum(fh.sum[:0])
+
+	var w words
+	for i := range w {
+		w[i] = binary.BigEndian.Uint64(sum[len(sum)-8*(i+1):])
+	}
+	hasherPool.Put(fh)
+	return w
+}
+
+// parallelThreshold is the number of distinct features per hashing worker;
+// smaller feature sets are hashed on the calling goroutine.
+const parallelThreshold = 4096
+
+// maxHashWorkers bounds the goroutines hashing the features of a single capture.
+const maxHashWorkers = 4
+
+// vector accumulates the weighted bit votes of every feature.
+type vector [maxWords * 64]int
+
+// add hashes feature and adds its weighted votes to the first nWords words of vec.
+func (vec *vector) add(feature string, weight, nWords int, cache *HashCache) {
+	if weight <= 0 {
+		return
+	}
+	h := cache.hash(feature)
+	for w := 0; w < nWords; w++ {
+		accumulate(vec[w*64:w*64+64], h[w], weight)
+	}
+}
+
+func generateSimhash(features map[string]int, size int, cache *HashCache) words {
+	votes := getVector()
+	defer vectorPool.Put(votes)
+	nWords := (size + 63) / 64
+
+	workers := min(runtime.GOMAXPROCS(0), maxHashWorkers, len(features)/parallelThreshold+1)
+	if workers <= 1 {
+		for k, v := range features {
+			votes.add(k, v, nWords, cache)
+		}
+	} else {
+		keys := make([]string, 0, len(features))
+		for k := range features {
+			keys = append(keys, k)
+		}
+
+		// Each worker hashes one shard of the features into its own vector,
+		// the shard vectors are summed once all workers are done.
+		shards := make([]*vector, workers)
+		chunk := (len(keys) + workers - 1) / workers
+		var wg sync.WaitGroup
+		for w := range shards {
+			shard := keys[min(w*chunk, len(keys)):min((w+1)*chunk, len(keys))]
+			shards[w] = getVector()
+			wg.Add(1)
+			go func(vec *vector) {
+				defer wg.Done()
+				for _, k := range shard {
+					vec.add(k, features[k], nWords, cache)
+				}
+			}(shards[w])
+		}
+		wg.Wait()
+
+		for _, shard := range shards {
+			for i := range votes {
+				votes[i] += shard[i]
+			}
+			vectorPool.Put(shard)
+		}
+	}
+
+	var value words
+	for i := 0; i < size; i++ {
+		if votes[i] > 0 {
+			value[i/64] |= 1 << (i % 64)
+		}
+	}
+
+	return value
+}
+
+// accumulate adds weight to vec[i] for every set bit i of word and subtracts
+// it for every clear bit, eight bits per iteration.
+func accumulate(vec []int, word uint64, weight int) {
+	vec = vec[:64]
+	for i := 0; i < 64; i += 8 {
+		b := int(word >> i)
+		vec[i] += weight * ((b&1)<<1 - 1)
+		vec[i+1] += weight * ((b>>1&1)<<1 - 1)
+		vec[i+2] += weight * ((b>>2&1)<<1 - 1)
+		vec[i+3] += weight * ((b>>3&1)<<1 - 1)
+		vec[i+4] += weight * ((b>>4&1)<<1 - 1)
+		vec[i+5] += weight * ((b>>5&1)<<1 - 1)
+		vec[i+6] += weight * ((b>>6&1)<<1 - 1)
+		vec[i+7] += weight * ((b>>7&1)<<1 - 1)
+	}
+}
+
+// packSimhashToBytes serializes the lowest size bits of simhash as
+// little-endian bytes into buf.
+func packSimhashToBytes(simhash words, size int, buf *[maxWords * 8]byte) []byte {
+	for i, w := range simhash {
+		binary.LittleEndian.PutUint64(buf[8*i:], w)
+	}
+	return buf[:size/8]
+}
+
+func encodeSimhashToBase64(simhash words, size int) string {
+	buf := bytesPool.Get().(*[maxWords * 8]byte)
+	encoded := base64.StdEncoding.EncodeToString(packSimhashToBytes(simhash, size, buf))
+	bytesPool.Put(buf)
+	return encoded
+}
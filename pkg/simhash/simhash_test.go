@@ -0,0 +1,134 @@
+package simhash
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"runtime"
+	"testing"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// referenceSimhash is the original big.Int implementation, kept to check
+// that the word-based one computes the same simhashes.
+func referenceSimhash(features map[string]int, size int) string {
+	vector := make([]int, size)
+	mask := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(size)), big.NewInt(1))
+	for k, v := range features {
+		if v <= 0 {
+			continue
+		}
+		sum := blake2b.Sum512([]byte(k))
+		h := new(big.Int).SetBytes(sum[:])
+		h.And(h, mask)
+		for i := 0; i < size; i++ {
+			if h.Bit(i) == 1 {
+				vector[i] += v
+			} else {
+				vector[i] -= v
+			}
+		}
+	}
+	value := big.NewInt(0)
+	for i := 0; i < size; i++ {
+		if vector[i] > 0 {
+			value.SetBit(value, i, 1)
+		}
+	}
+	bytes := value.FillBytes(make([]byte, size/8))
+	for i, j := 0, len(bytes)-1; i < j; i, j = i+1, j-1 {
+		bytes[i], bytes[j] = bytes[j], bytes[i]
+	}
+	return base64.StdEncoding.EncodeToString(bytes)
+}
+
+// features returns n distinct features with varied weights.
+func features(n int) map[string]int {
+	f := make(map[string]int, n)
+	for i := range n {
+		f[fmt.Sprintf("feature-%d", i)] = i%7 + 1
+	}
+	return f
+}
+
+// GOLDEN_FEATURES has features of several weights and features without a
+// positive weight, which are ignored.
+var GOLDEN_FEATURES = map[string]int{"the": 3, "quick": 1, "brown": 2, "fox": 1, "jumps": 1, "ignored": 0, "negative": -2}
+
+// GOLDEN_SIMHASHES are the simhashes of GOLDEN_FEATURES, computed by the
+// big.Int implementation the service stored them with.
+var GOLDEN_SIMHASHES = map[int]string{
+	64:  "pw2hGEIAxPs=",
+	128: "pw2hGEIAxPugiBG4JQIThQ==",
+	256: "pw2hGEIAxPugiBG4JQIThTCsxZKCIUEQT4TySfeFgW8=",
+	512: "pw2hGEIAxPugiBG4JQIThTCsxZKCIUEQT4TySfeFgW8KnQ1AEcLAClEYdEAXKajVixBHEYkT7lpzLi4BjYRBNQ==",
+}
+
+func TestGetSimhashGolden(t *testing.T) {
+	cache := NewHashCache(1024)
+	for _, size := range Sizes {
+		if got := GetSimhash(GOLDEN_FEATURES, size); got != GOLDEN_SIMHASHES[size] {
+			t.Errorf("GetSimhash of size %d = %s, want %s", size, got, GOLDEN_SIMHASHES[size])
+		}
+		if got := referenceSimhash(GOLDEN_FEATURES, size); got != GOLDEN_SIMHASHES[size] {
+			t.Errorf("reference simhash of size %d = %s, want %s", size, got, GOLDEN_SIMHASHES[size])
+		}
+		// Twice, so that the second run reads the cached feature hashes.
+		for range 2 {
+			if got := GetSimhashCached(GOLDEN_FEATURES, size, cache); got != GOLDEN_SIMHASHES[size] {
+				t.Errorf("GetSimhashCached of size %d = %s, want %s", size, got, GOLDEN_SIMHASHES[size])
+			}
+		}
+	}
+}
+
+func TestGetSimhashMatchesReference(t *testing.T) {
+	for _, n := range []int{0, 1, 10, 1000} {
+		f := features(n)
+		for _, size := range Sizes {
+			if got, want := GetSimhash(f, size), referenceSimhash(f, size); got != want {
+				t.Errorf("GetSimhash of %d features and size %d = %s, want %s", n, size, got, want)
+			}
+		}
+	}
+}
+
+func TestGetSimhashParallel(t *testing.T) {
+	// Enough features for every hashing worker, on enough threads to run
+	// them.
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(maxHashWorkers))
+	f := features(parallelThreshold*maxHashWorkers + 1)
+	cache := NewHashCache(len(f))
+	for _, size := range Sizes {
+		want := referenceSimhash(f, size)
+		if got := GetSimhash(f, size); got != want {
+			t.Errorf("parallel GetSimhash of size %d = %s, want %s", size, got, want)
+		}
+		if got := GetSimhashCached(f, size, cache); got != want {
+			t.Errorf("parallel GetSimhashCached of size %d = %s, want %s", size, got, want)
+		}
+	}
+
+	// A single thread hashes the same features serially.
+	runtime.GOMAXPROCS(1)
+	for _, size := range Sizes {
+		if got, want := GetSimhash(f, size), referenceSimhash(f, size); got != want {
+			t.Errorf("serial GetSimhash of size %d = %s, want %s", size, got, want)
+		}
+	}
+}
+
+func BenchmarkGetSimhash(b *testing.B) {
+	for _, n := range []int{100, 1000, parallelThreshold * maxHashWorkers} {
+		f := features(n)
+		for _, size := range Sizes {
+			b.Run(fmt.Sprintf("features=%d/size=%d", n, size), func(b *testing.B) {
+				b.ReportAllocs()
+				for b.Loop() {
+					GetSimhash(f, size)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package simhash
+
+import (
+	"encoding/base64"
+	"fmt"
+)
+
+// Simhash is a packed simhash: its bits, least significant first, as
+// little-endian bytes.
+type Simhash []byte
+
+// Options configures how a simhash is computed.
+type Options struct {
+	// Size is the size of the simhash in bits, one of Sizes, DefaultSize
+	// when 0.
+	Size int
+	// Cache memoizes feature hashes across calls when not nil.
+	Cache *HashCache
+}
+
+// Sum computes the simhash of weighted features. Features with a weight of 0
+// or less are ignored.
+func Sum(features map[string]int, opts Options) (Simhash, error) {
+	size := opts.Size
+	if size == 0 {
+		size = DefaultSize
+	}
+	if !ValidSize(size) {
+		return nil, fmt.Errorf("unsupported simhash size %d", size)
+	}
+	var buf [maxWords * 8]byte
+	return Simhash(packSimhashToBytes(generateSimhash(features, size, opts.Cache), size, &buf)), nil
+}
+
+// Parse decodes a simhash in the given encoding, base64 when empty.
+func Parse(s, encoding string) (Simhash, error) {
+	data, err := Decode(s, encoding)
+	if err != nil {
+		return nil, err
+	}
+	if !ValidSize(len(data) * 8) {
+		return nil, fmt.Errorf("unsupported simhash size %d", len(data)*8)
+	}
+	return Simhash(data), nil
+}
+
+// Size returns the size of s in bits.
+func (s Simhash) Size() int {
+	return len(s) * 8
+}
+
+// Hamming returns the number of bits differing between s and other, which
+// must have the same size.
+func (s Simhash) Hamming(other Simhash) (int, error) {
+	return Hamming(s, other)
+}
+
+// Similarity returns the share of bits equal in s and other, from 0 when
+// every bit differs to 1 when they are identical.
+func (s Simhash) Similarity(other Simhash) (float64, error) {
+	return Similarity(s, other)
+}
+
+// Encode returns s in the given encoding, base64 when empty.
+func (s Simhash) Encode(encoding string) (string, error) {
+	return Encode(s, encoding)
+}
+
+// String returns s base64 encoded, the form stored by the service.
+func (s Simhash) String() string {
+	return base64.StdEncoding.EncodeToString(s)
+}